@@ -26,7 +26,12 @@ import (
 
 	"github.com/gocraft/web"
 
+	"github.com/trustedanalytics-ng/tap-api-service/audit"
+	containerStreamApi "github.com/trustedanalytics-ng/tap-api-service/container-stream-connector"
+	kubernetesApi "github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/leftovers"
 	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/serviceaccounts"
 	uaaApi "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
 	userManagementApi "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
 	"github.com/trustedanalytics-ng/tap-api-service/utils"
@@ -63,9 +68,15 @@ type Config struct {
 	BlobStoreApi             blobStoreApi.TapBlobStoreApi
 	CatalogApi               catalogApi.TapCatalogApi
 	ContainerBrokerApi       api.TapContainerBrokerApi
+	ContainerStreamApi       containerStreamApi.ContainerStreamApi
+	KubernetesApi            kubernetesApi.KubernetesApi
 	ImageFactoryApi          imageFactoryApi.TapApiImageFactoryApi
 	UaaApi                   uaaApi.UaaApi
 	UserManagementApiFactory userManagementApi.UserManagementFactory
+	AuditSink                audit.Sink
+	AccessPolicy             *models.AccessPolicy
+	ServiceAccountStore      serviceaccounts.Store
+	LeftoversStore           leftovers.Store
 }
 type Context struct {
 	*models.Context
@@ -76,6 +87,14 @@ type Context struct {
 	K8sVersion       string
 	CoreOrganization string
 	Username         string
+	IsAdmin          bool
+	Scopes           []string
+	Permissions      []models.Permission
+
+	Organization          string
+	OrganizationRequested bool
+	callerOrganizations   []userManagementApi.Organization
+	auditRecorded         bool
 }
 
 // broker service instance doesn't have an offer
@@ -85,74 +104,118 @@ const mockInstanceIdForNotCreatedYetInstance = "api-service-fake-instance-id"
 var BrokerConfig *Config
 var logger, _ = commonLogger.InitLogger("api")
 
-func route(router *web.Router, context *Context, oauthMiddlewareActivated bool) {
-	routeUser(router, context, oauthMiddlewareActivated)
-	routeAdmin(router, context, oauthMiddlewareActivated)
+func route(router *web.Router, oauthMiddlewareActivated bool) {
+	routeUser(router, oauthMiddlewareActivated)
+	routeAdmin(router, oauthMiddlewareActivated)
 }
 
-func routeUser(router *web.Router, context *Context, oauthMiddlewareActivated bool) {
-	apiRouter := router.Subrouter(*context, "")
+func routeUser(router *web.Router, oauthMiddlewareActivated bool) {
+	subrouter := router.Subrouter(Context{}, "")
 	if oauthMiddlewareActivated {
-		apiRouter.Middleware(context.Oauth2AuthorizeMiddleware)
-	}
-
-	apiRouter.Get("/platform_info", context.GetPlatformInfo)
-	apiRouter.Get("/platform_components", context.GetPlatformComponents)
-
-	apiRouter.Get("/offerings", context.GetCatalog)
-	apiRouter.Post("/offerings/application", context.CreateOfferingFromApplication)
-	apiRouter.Get("/offerings/:offeringId", context.GetCatalogItem)
-
-	apiRouter.Get("/applications", context.GetApplicationInstances)
-	apiRouter.Post("/applications", context.CreateApplicationInstance)
-	apiRouter.Get("/applications/:applicationId", context.GetApplicationInstance)
-	apiRouter.Delete("/applications/:applicationId", context.DeleteApplication)
-	apiRouter.Get("/applications/:applicationId/logs", context.GetApplicationInstanceLogs)
-	apiRouter.Put("/applications/:applicationId/scale", context.ScaleApplicationInstance)
-	apiRouter.Put("/applications/:applicationId/stop", context.StopApplicationInstance)
-	apiRouter.Put("/applications/:applicationId/start", context.StartApplicationInstance)
-	apiRouter.Put("/applications/:applicationId/restart", context.RestartApplicationInstance)
-	apiRouter.Get("/applications/:applicationId/bindings", context.GetApplicationInstanceBindings)
-	apiRouter.Post("/applications/:applicationId/bindings", context.BindToApplicationInstance)
-	apiRouter.Delete("/applications/:applicationId/bindings/services/:serviceId", context.UnbindServiceFromApplicationInstance)
-	apiRouter.Delete("/applications/:dstApplicationId/bindings/applications/:srcApplicationId", context.UnbindApplicationFromApplicationInstance)
-
-	apiRouter.Get("/services", context.GetServicesInstances)
-	apiRouter.Post("/services", context.CreateServiceInstance)
-	apiRouter.Get("/services/:serviceId", context.GetServiceInstance)
-	apiRouter.Delete("/services/:serviceId", context.DeleteInstance)
-	apiRouter.Get("/services/:serviceId/logs", context.GetServiceInstanceLogs)
-	apiRouter.Put("/services/:serviceId/stop", context.StopServiceInstance)
-	apiRouter.Put("/services/:serviceId/start", context.StartServiceInstance)
-	apiRouter.Put("/services/:serviceId/restart", context.RestartServiceInstance)
-	apiRouter.Get("/services/:serviceId/bindings", context.GetServiceInstanceBindings)
-	apiRouter.Post("/services/:serviceId/bindings", context.BindToServiceInstance)
-	apiRouter.Delete("/services/:dstServiceId/bindings/services/:srcServiceId", context.UnbindServiceFromServiceInstance)
-	apiRouter.Delete("/services/:serviceId/bindings/applications/:applicationId", context.UnbindApplicationFromServiceInstance)
-	apiRouter.Get("/services/:serviceId/credentials", context.GetServiceInstanceCredentials)
-	apiRouter.Put("/services/:instanceId/expose", context.Expose)
-
-	apiRouter.Post("/users/invitations/resend", context.ResendUserInvitation)
-	apiRouter.Get("/users/invitations", context.ListInvitations)
-	apiRouter.Delete("/users/invitations", context.DeleteUserInvitation)
-	apiRouter.Get("/users", context.ListUsers)
-	apiRouter.Delete("/users", context.DeleteUser)
-	apiRouter.Put("/users/current/password", context.ChangeCurrentUserPassword)
-
-	apiRouter.Get("/resources/cli/:resourceId", context.GetTapCliResource)
-}
-
-func routeAdmin(router *web.Router, context *Context, oauthMiddlewareActivated bool) {
-	adminRouter := router.Subrouter(*context, "")
+		subrouter.Middleware((*Context).Oauth2AuthorizeMiddleware)
+	}
+	subrouter.Middleware((*Context).OrganizationMiddleware)
+	subrouter.Middleware((*Context).OwnershipMiddleware)
+	apiRouter := permissionRouter{subrouter}
+
+	apiRouter.Get("/platform_info", models.PermissionPlatformRead, (*Context).GetPlatformInfo)
+	apiRouter.Get("/platform_components", models.PermissionPlatformRead, (*Context).GetPlatformComponents)
+
+	apiRouter.Get("/offerings", models.PermissionOfferingsRead, (*Context).GetCatalog)
+	apiRouter.Post("/offerings/application", models.PermissionOfferingsApplicationWrite, (*Context).CreateOfferingFromApplication)
+	apiRouter.Get("/offerings/:offeringId", models.PermissionOfferingsRead, (*Context).GetCatalogItem)
+
+	apiRouter.Get("/applications", models.PermissionApplicationsRead, (*Context).GetApplicationInstances)
+	apiRouter.Post("/applications", models.PermissionApplicationsWrite, (*Context).CreateApplicationInstance)
+	apiRouter.Get("/applications/:applicationId", models.PermissionApplicationsRead, (*Context).GetApplicationInstance)
+	apiRouter.Delete("/applications/:applicationId", models.PermissionApplicationsWrite, (*Context).DeleteApplication)
+	apiRouter.Get("/applications/:applicationId/logs", models.PermissionApplicationsRead, (*Context).GetApplicationInstanceLogs)
+	apiRouter.Get("/applications/:applicationId/exec", models.PermissionApplicationsExec, (*Context).ExecInApplicationInstance)
+	apiRouter.Put("/applications/:applicationId/sharing", models.PermissionApplicationsWrite, (*Context).ShareApplication)
+	apiRouter.Put("/applications/:applicationId/scale", models.PermissionApplicationsWrite, (*Context).ScaleApplicationInstance)
+	apiRouter.Put("/applications/:applicationId/stop", models.PermissionApplicationsWrite, (*Context).StopApplicationInstance)
+	apiRouter.Put("/applications/:applicationId/start", models.PermissionApplicationsWrite, (*Context).StartApplicationInstance)
+	apiRouter.Put("/applications/:applicationId/restart", models.PermissionApplicationsWrite, (*Context).RestartApplicationInstance)
+	apiRouter.Put("/applications/:applicationId/blob", models.PermissionApplicationsWrite, (*Context).RedeployApplication)
+	apiRouter.Get("/applications/:applicationId/versions", models.PermissionApplicationsRead, (*Context).GetApplicationVersions)
+	apiRouter.Post("/applications/:applicationId/rollback", models.PermissionApplicationsWrite, (*Context).RollbackApplication)
+	apiRouter.Get("/applications/:applicationId/env", models.PermissionApplicationsRead, (*Context).GetApplicationEnv)
+	apiRouter.Put("/applications/:applicationId/env", models.PermissionApplicationsWrite, (*Context).UpdateApplicationEnv)
+	apiRouter.Get("/applications/:applicationId/bindings", models.PermissionApplicationsRead, (*Context).GetApplicationInstanceBindings)
+	apiRouter.Post("/applications/:applicationId/bindings", models.PermissionApplicationsWrite, (*Context).BindToApplicationInstance)
+	apiRouter.Delete("/applications/:applicationId/bindings/services/:serviceId", models.PermissionApplicationsWrite, (*Context).UnbindServiceFromApplicationInstance)
+	apiRouter.Delete("/applications/:dstApplicationId/bindings/applications/:srcApplicationId", models.PermissionApplicationsWrite, (*Context).UnbindApplicationFromApplicationInstance)
+
+	apiRouter.Get("/services", models.PermissionServicesRead, (*Context).GetServicesInstances)
+	apiRouter.Post("/services", models.PermissionServicesWrite, (*Context).CreateServiceInstance)
+	apiRouter.Get("/services/:serviceId", models.PermissionServicesRead, (*Context).GetServiceInstance)
+	apiRouter.Patch("/services/:serviceId", models.PermissionServicesWrite, (*Context).UpdateServiceInstance)
+	apiRouter.Delete("/services/:serviceId", models.PermissionServicesWrite, (*Context).DeleteInstance)
+	apiRouter.Get("/services/:serviceId/logs", models.PermissionServicesRead, (*Context).GetServiceInstanceLogs)
+	apiRouter.Get("/services/:serviceId/exec", models.PermissionServicesExec, (*Context).ExecInServiceInstance)
+	apiRouter.Get("/services/:serviceId/tunnel", models.PermissionServicesExec, (*Context).OpenServiceTunnel)
+	apiRouter.Put("/services/:serviceId/sharing", models.PermissionServicesWrite, (*Context).ShareServiceInstance)
+	apiRouter.Put("/services/:serviceId/stop", models.PermissionServicesWrite, (*Context).StopServiceInstance)
+	apiRouter.Put("/services/:serviceId/start", models.PermissionServicesWrite, (*Context).StartServiceInstance)
+	apiRouter.Put("/services/:serviceId/restart", models.PermissionServicesWrite, (*Context).RestartServiceInstance)
+	apiRouter.Get("/services/:serviceId/bindings", models.PermissionServicesRead, (*Context).GetServiceInstanceBindings)
+	apiRouter.Post("/services/:serviceId/bindings", models.PermissionServicesWrite, (*Context).BindToServiceInstance)
+	apiRouter.Delete("/services/:dstServiceId/bindings/services/:srcServiceId", models.PermissionServicesWrite, (*Context).UnbindServiceFromServiceInstance)
+	apiRouter.Delete("/services/:serviceId/bindings/applications/:applicationId", models.PermissionServicesWrite, (*Context).UnbindApplicationFromServiceInstance)
+	apiRouter.Get("/services/:serviceId/credentials", models.PermissionServicesCredentialsRead, (*Context).GetServiceInstanceCredentials)
+	apiRouter.Put("/services/:instanceId/expose", models.PermissionServicesWrite, (*Context).Expose)
+
+	apiRouter.Get("/organizations", models.PermissionOrganizationsRead, (*Context).ListOrganizations)
+	apiRouter.Get("/organizations/:orgId/users", models.PermissionOrganizationsRead, (*Context).ListOrganizationUsers)
+
+	apiRouter.Post("/users/invitations/resend", models.PermissionUsersInvitationsManage, (*Context).ResendUserInvitation)
+	apiRouter.Get("/users/invitations", models.PermissionUsersInvitationsManage, (*Context).ListInvitations)
+	apiRouter.Delete("/users/invitations", models.PermissionUsersInvitationsManage, (*Context).DeleteUserInvitation)
+	apiRouter.Get("/users", models.PermissionUsersRead, (*Context).ListUsers)
+	apiRouter.Delete("/users", models.PermissionUsersDelete, (*Context).DeleteUser)
+	apiRouter.Put("/users/current/password", permissionAuthenticated, (*Context).ChangeCurrentUserPassword)
+	apiRouter.Get("/users/current/permissions", permissionAuthenticated, (*Context).GetCurrentUserPermissions)
+
+	apiRouter.Get("/metrics/single", models.PermissionMetricsRead, (*Context).GetSingleMetric)
+	apiRouter.Get("/metrics/platform", models.PermissionMetricsRead, (*Context).GetPlatformMetrics)
+	apiRouter.Get("/metrics/organizations/:orgId", models.PermissionMetricsRead, (*Context).GetOrganizationMetrics)
+	apiRouter.Get("/events", models.PermissionEventsRead, (*Context).StreamEvents)
+	apiRouter.Get("/operations/:operationId", models.PermissionOperationsRead, (*Context).GetOperation)
+	apiRouter.Get("/quotas", models.PermissionQuotasRead, (*Context).GetQuotas)
+
+	apiRouter.Get("/resources/cli/:resourceId", models.PermissionPlatformRead, (*Context).GetTapCliResource)
+}
+
+func routeAdmin(router *web.Router, oauthMiddlewareActivated bool) {
+	subrouter := router.Subrouter(Context{}, "")
 	if oauthMiddlewareActivated {
-		adminRouter.Middleware(context.Oauth2AuthorizeAdminMiddleware)
+		subrouter.Middleware((*Context).Oauth2AuthorizeMiddleware)
 	}
+	subrouter.Middleware((*Context).OrganizationMiddleware)
+	subrouter.Middleware((*Context).OwnershipMiddleware)
+	adminRouter := permissionRouter{subrouter}
+
+	adminRouter.Post("/offerings/binary", models.PermissionOfferingsWrite, (*Context).CreateOfferingFromBinary)
+	adminRouter.Post("/offerings", models.PermissionOfferingsWrite, (*Context).CreateOffering)
+	adminRouter.Delete("/offerings/:offeringId", models.PermissionOfferingsWrite, (*Context).DeleteOffering)
+
+	adminRouter.Post("/organizations", models.PermissionOrganizationsWrite, (*Context).CreateOrganization)
+	adminRouter.Post("/organizations/:orgId/users", models.PermissionOrganizationsWrite, (*Context).AddOrganizationUser)
+	adminRouter.Delete("/organizations/:orgId/users", models.PermissionOrganizationsWrite, (*Context).RemoveOrganizationUser)
+
+	adminRouter.Post("/users/invitations", models.PermissionUsersInvite, (*Context).InviteUser)
 
-	adminRouter.Post("/offerings/binary", context.CreateOfferingFromBinary)
-	adminRouter.Post("/offerings", context.CreateOffering)
-	adminRouter.Delete("/offerings/:offeringId", context.DeleteOffering)
+	adminRouter.Get("/audit", models.PermissionAuditRead, (*Context).GetAuditLog)
+	adminRouter.Get("/orphans", models.PermissionOrphansRead, (*Context).GetOrphans)
+	adminRouter.Delete("/orphans", models.PermissionOrphansDelete, (*Context).DeleteOrphans)
 
-	adminRouter.Post("/users/invitations", context.InviteUser)
+	adminRouter.Post("/service_accounts", models.PermissionServiceAccountsManage, (*Context).CreateServiceAccount)
+	adminRouter.Get("/service_accounts", models.PermissionServiceAccountsManage, (*Context).ListServiceAccounts)
+	adminRouter.Get("/service_accounts/:accountId", models.PermissionServiceAccountsManage, (*Context).GetServiceAccount)
+	adminRouter.Delete("/service_accounts/:accountId", models.PermissionServiceAccountsManage, (*Context).DeleteServiceAccount)
+	adminRouter.Post("/service_accounts/:accountId/keys", models.PermissionServiceAccountsManage, (*Context).CreateApiKey)
+	adminRouter.Get("/service_accounts/:accountId/keys", models.PermissionServiceAccountsManage, (*Context).ListApiKeys)
+	adminRouter.Delete("/service_accounts/:accountId/keys/:keyId", models.PermissionServiceAccountsManage, (*Context).RevokeApiKey)
 }
 
 func (c *Context) Introduce(rw web.ResponseWriter, req *web.Request) {
@@ -196,17 +259,22 @@ func (c *Context) CreateOffering(rw web.ResponseWriter, req *web.Request) {
 		}
 	}
 
+	tx := newSaga("create offering")
+	defer tx.rollbackUnlessCommitted()
+
 	responseTemplate, status, err := c.AddTemplateToCatalog()
 	if err != nil {
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
+	tx.onRollback("mark template "+responseTemplate.Id+" unavailable", markTemplateUnavailable(responseTemplate.Id, c.Username))
 
 	status, err = AddTemplateToTemplateRepository(responseTemplate.Id, serviceWithTemplate.Template)
 	if err != nil {
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
+	tx.onRollback("delete template "+responseTemplate.Id+" from Template Repository", deleteTemplateFromTemplateRepository(responseTemplate.Id))
 
 	_, status, err = UpdateTemplateState(responseTemplate.Id, c.Username, catalogModels.TemplateStateInProgress, catalogModels.TemplateStateReady)
 	if err != nil {
@@ -220,6 +288,7 @@ func (c *Context) CreateOffering(rw web.ResponseWriter, req *web.Request) {
 			commonHttp.GenericRespond(status, rw, err)
 			return
 		}
+		tx.onRollback("delete offering "+responseService.Id, deleteServiceFromCatalog(responseService.Id))
 		logger.Debug("Response body from Catalog.AddService: ", responseService)
 
 		if !isServiceBrokerOffering {
@@ -240,6 +309,7 @@ func (c *Context) CreateOffering(rw web.ResponseWriter, req *web.Request) {
 			return
 		}
 		logger.Debug("Service broker instance created. Response Catalog.AddInstance: ", serviceBrokerInstance)
+		tx.onRollback("delete service broker instance "+serviceBrokerInstance.Id, c.deleteInstanceFromCatalog(serviceBrokerInstance.Id))
 
 		for _, offering := range resultOfferings {
 			for _, metadata := range getServiceBrokeInstanceMetadata(serviceBrokerInstance.Id) {
@@ -250,6 +320,7 @@ func (c *Context) CreateOffering(rw web.ResponseWriter, req *web.Request) {
 			}
 		}
 	}
+	tx.commit()
 	commonHttp.WriteJson(rw, resultOfferings, http.StatusAccepted)
 }
 
@@ -297,13 +368,18 @@ func (c *Context) CreateOfferingFromBinary(rw web.ResponseWriter, req *web.Reque
 		return
 	}
 
+	tx := newSaga("create offering from binary")
+	defer tx.rollbackUnlessCommitted()
+
 	offering.State = "DEPLOYING"
 	offering.AuditTrail = c.getAuditTrail()
+	offering.Metadata = c.withOrganization(offering.Metadata)
 	offeringFromCatalog, status, err := BrokerConfig.CatalogApi.AddService(offering)
 	if err != nil {
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
+	tx.onRollback("delete offering "+offeringFromCatalog.Id, deleteServiceFromCatalog(offeringFromCatalog.Id))
 	logger.Debugf("Response body from Catalog.AddService: %v", offeringFromCatalog)
 
 	imageId := catalogModels.ConstructImageIdForUserOffering(offeringFromCatalog.Id)
@@ -318,11 +394,13 @@ func (c *Context) CreateOfferingFromBinary(rw web.ResponseWriter, req *web.Reque
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
+	tx.onRollback("delete image "+imageId, deleteImageFromCatalog(imageId))
 
 	if err = BrokerConfig.BlobStoreApi.StoreBlob(imageId, blob); err != nil {
 		commonHttp.Respond500(rw, err)
 		return
 	}
+	tx.onRollback("delete blob "+imageId, deleteBlobFromBlobStore(imageId))
 
 	_, err = updateImageState(imageId, catalogModels.ImageStatePending, c.Username)
 	if err != nil {
@@ -331,7 +409,10 @@ func (c *Context) CreateOfferingFromBinary(rw web.ResponseWriter, req *web.Reque
 		return
 	}
 
+	tx.commit()
 	logger.Info("creating offering from binary finished successfully")
+	startOperation(rw, req, c.Username, models.OperationTypeCreateOffering, models.OperationTargetOffering, offeringFromCatalog.Id,
+		offeringCreatedCheck(offeringFromCatalog.Id, imageId))
 	commonHttp.WriteJson(rw, offeringFromCatalog, http.StatusAccepted)
 }
 
@@ -365,10 +446,13 @@ func (c *Context) DeleteOffering(rw web.ResponseWriter, req *web.Request) {
 
 	// delete template if it's possible - ie no other service uses it
 	if status, err = deleteTemplate(service.TemplateId); err != nil && status != http.StatusMethodNotAllowed {
+		recordLeftover(models.OrphanTypeTemplate, service.TemplateId, "template of removed offering could not be removed")
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
 
+	startOperation(rw, req, c.Username, models.OperationTypeDeleteOffering, models.OperationTargetOffering, offeringId,
+		offeringRemovedCheck(offeringId))
 	commonHttp.WriteJson(rw, "", http.StatusAccepted)
 }
 
@@ -550,6 +634,12 @@ func deleteTemplate(templateId string) (int, error) {
 }
 
 func (c *Context) GetCatalog(rw web.ResponseWriter, req *web.Request) {
+	query, err := parseListQuery(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	services, _, err := BrokerConfig.CatalogApi.GetServices()
 	if err != nil {
 		err = errors.New("Cannot fetch services from Catalog: " + err.Error())
@@ -557,6 +647,12 @@ func (c *Context) GetCatalog(rw web.ResponseWriter, req *web.Request) {
 		return
 	}
 
+	services, status, err := c.filterOfferingsByOrganization(req, services)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
 	result := []models.Offering{}
 
 	for _, service := range services {
@@ -568,7 +664,15 @@ func (c *Context) GetCatalog(rw web.ResponseWriter, req *web.Request) {
 		apiService := ParseServiceToOffering(service, brokerInstance)
 		result = append(result, apiService)
 	}
-	commonHttp.WriteJson(rw, result, http.StatusOK)
+
+	indexes, total := query.apply(offeringsToListItems(result))
+	page := []models.Offering{}
+	for _, i := range indexes {
+		page = append(page, result[i])
+	}
+
+	writeTotalCount(rw, total)
+	commonHttp.WriteJson(rw, page, http.StatusOK)
 }
 
 func (c *Context) GetCatalogItem(rw web.ResponseWriter, req *web.Request) {
@@ -592,6 +696,12 @@ func (c *Context) GetCatalogItem(rw web.ResponseWriter, req *web.Request) {
 }
 
 func (c *Context) CreateServiceInstance(rw web.ResponseWriter, req *web.Request) {
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	apiServiceInstance := models.ServiceInstanceRequest{}
 
 	if err := ReadJsonAndValidate(req, &apiServiceInstance); err != nil {
@@ -615,6 +725,20 @@ func (c *Context) CreateServiceInstance(rw web.ResponseWriter, req *web.Request)
 		return
 	}
 
+	defaults, err := validatePlanParameters(service, plan, apiServiceInstance.Metadata)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	apiServiceInstance.Metadata = append(apiServiceInstance.Metadata, defaults...)
+
+	if c.respondIfQuotaExceeded(rw, serviceInstanceQuotaRequest(service, plan)) {
+		return
+	}
+
+	tx := newSaga("create service instance")
+	defer tx.rollbackUnlessCommitted()
+
 	for _, dependency := range plan.Dependencies {
 		depInstance := prepareInstanceFromDependency(apiServiceInstance.Name, dependency)
 
@@ -623,6 +747,7 @@ func (c *Context) CreateServiceInstance(rw web.ResponseWriter, req *web.Request)
 			commonHttp.GenericRespond(status, rw, err)
 			return
 		} else {
+			tx.onRollback("delete dependency instance "+instance.Id, c.deleteInstanceFromCatalog(instance.Id))
 			apiServiceInstance.Bindings = append(apiServiceInstance.Bindings, catalogModels.InstanceBindings{Id: instance.Id})
 		}
 	}
@@ -632,6 +757,14 @@ func (c *Context) CreateServiceInstance(rw web.ResponseWriter, req *web.Request)
 		commonHttp.GenericRespond(status, rw, fmt.Errorf("cannot add service instance %s to Catalog: %v", apiServiceInstance.OfferingId, err))
 		return
 	}
+	tx.commit()
+
+	startOperation(rw, req, c.Username, models.OperationTypeCreateService, models.OperationTargetInstance, instance.Id,
+		instanceStateCheck(instance.Id, catalogModels.InstanceStateRunning))
+	if timeout > 0 {
+		respondWhenConditionMet(rw, timeout, instanceStateCondition(instance.Id, catalogModels.InstanceStateRunning))
+		return
+	}
 
 	response, err := ConvertToApiServiceInstance(service, instance)
 	if err != nil {
@@ -645,6 +778,9 @@ func prepareInstanceFromDependency(parentName string, dependency catalogModels.S
 	metadata := []catalogModels.Metadata{{
 		Id:    catalogModels.OFFERING_PLAN_ID,
 		Value: dependency.PlanId,
+	}, {
+		Id:    dependencyOfMetadataKey,
+		Value: parentName,
 	}}
 
 	return models.ServiceInstanceRequest{
@@ -658,10 +794,23 @@ func prepareInstanceFromDependency(parentName string, dependency catalogModels.S
 func (c *Context) DeleteInstance(rw web.ResponseWriter, req *web.Request) {
 	instanceId := req.PathParams["serviceId"]
 
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	if status, err := c.deleteInstance(instanceId); err != nil {
 		commonHttp.GenericRespond(status, rw, err)
+		return
 	}
 
+	startOperation(rw, req, c.Username, models.OperationTypeDeleteInstance, models.OperationTargetInstance, instanceId,
+		instanceRemovedCheck(instanceId))
+	if timeout > 0 {
+		respondWhenConditionMet(rw, timeout, instanceRemovedCondition(instanceId))
+		return
+	}
 	commonHttp.WriteJson(rw, "", http.StatusAccepted)
 }
 
@@ -730,27 +879,37 @@ func (c *Context) GetApplicationInstanceLogs(rw web.ResponseWriter, req *web.Req
 		return
 	}
 
-	logs, status, err := BrokerConfig.ContainerBrokerApi.GetInstanceLogs(instanceId)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Cannot fetch application instance %s logs from Container Broker: %s", applicationId, err.Error())
-		err = errors.New(errorMessage)
-		commonHttp.GenericRespond(status, rw, err)
+	if commonHttp.GetQueryParameterCaseInsensitive(req, "includeBindings") == "true" {
+		instances, status, err := getInstanceWithBindings(instanceId)
+		if err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		respondWithLogs(rw, req, instanceId, true, mergedLogsFetcher(instances))
 		return
 	}
-	commonHttp.WriteJson(rw, logs, status)
+
+	respondWithLogs(rw, req, instanceId, false, func() (map[string]string, int, error) {
+		logs, status, err := BrokerConfig.ContainerBrokerApi.GetInstanceLogs(instanceId)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Cannot fetch application instance %s logs from Container Broker: %s", applicationId, err.Error())
+			err = errors.New(errorMessage)
+		}
+		return logs, status, err
+	})
 }
 
 func (c *Context) GetServiceInstanceLogs(rw web.ResponseWriter, req *web.Request) {
 	instanceId := req.PathParams["serviceId"]
 
-	logs, status, err := BrokerConfig.ContainerBrokerApi.GetInstanceLogs(instanceId)
-	if err != nil {
-		errorMessage := fmt.Sprintf("Cannot fetch service instance %s logs from Container Broker: %s", instanceId, err.Error())
-		err = errors.New(errorMessage)
-		commonHttp.GenericRespond(status, rw, err)
-		return
-	}
-	commonHttp.WriteJson(rw, logs, status)
+	respondWithLogs(rw, req, instanceId, false, func() (map[string]string, int, error) {
+		logs, status, err := BrokerConfig.ContainerBrokerApi.GetInstanceLogs(instanceId)
+		if err != nil {
+			errorMessage := fmt.Sprintf("Cannot fetch service instance %s logs from Container Broker: %s", instanceId, err.Error())
+			err = errors.New(errorMessage)
+		}
+		return logs, status, err
+	})
 }
 
 func (c *Context) checkServiceInstanceID(serviceInstanceID string) (int, error) {
@@ -798,6 +957,12 @@ func (c *Context) GetServiceInstanceCredentials(rw web.ResponseWriter, req *web.
 }
 
 func (c *Context) GetServicesInstances(rw web.ResponseWriter, req *web.Request) {
+	query, err := parseListQuery(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	instances, status, err := BrokerConfig.CatalogApi.ListServicesInstances()
 	if err != nil {
 		err = errors.New("Cannot fetch service instances from Catalog: " + err.Error())
@@ -812,6 +977,11 @@ func (c *Context) GetServicesInstances(rw web.ResponseWriter, req *web.Request)
 		return
 	}
 
+	instances, status, err = c.filterInstancesByOrganization(req, c.filterAccessibleInstances(instances))
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
 	if id := commonHttp.GetQueryParameterCaseInsensitive(req, "offeringId"); id != "" {
 		instances = utils.FilterInstancesByClassId(instances, id)
 	}
@@ -828,7 +998,14 @@ func (c *Context) GetServicesInstances(rw web.ResponseWriter, req *web.Request)
 		apiServiceInstances = models.FilterServiceInstancesByPlanName(apiServiceInstances, name)
 	}
 
-	commonHttp.WriteJson(rw, apiServiceInstances, http.StatusOK)
+	indexes, total := query.apply(serviceInstancesToListItems(apiServiceInstances, services))
+	result := []models.ServiceInstance{}
+	for _, i := range indexes {
+		result = append(result, apiServiceInstances[i])
+	}
+
+	writeTotalCount(rw, total)
+	commonHttp.WriteJson(rw, result, http.StatusOK)
 }
 
 func (c *Context) GetServiceInstance(rw web.ResponseWriter, req *web.Request) {
@@ -42,20 +42,33 @@ const (
 	defaultMaxMemory = 32 << 20 // 32 MB
 )
 
+// applicationDeployment holds everything which has to be validated before any application of manifest is created
+type applicationDeployment struct {
+	manifest             *models.Manifest
+	instanceDependencies []catalogModels.InstanceDependency
+	blob                 multipart.File
+}
+
 func (c *Context) CreateApplicationInstance(rw web.ResponseWriter, req *web.Request) {
 
 	// PARSE DATA
 	logger.Debug("started")
-	err := req.ParseMultipartForm(defaultMaxMemory)
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	err = req.ParseMultipartForm(defaultMaxMemory)
 	if err != nil {
 		logger.Error("ParseMultipartForm failed!")
 		commonHttp.Respond400(rw, err)
 		return
 	}
 
-	manifest, err := c.getValidatedParsedManifest(req)
+	manifests, isList, err := c.getValidatedParsedManifests(req)
 	if err != nil {
-		logger.Error("getValidatedParsedManifest failed: ", err)
+		logger.Error("getValidatedParsedManifests failed: ", err)
 		commonHttp.Respond400(rw, getValidatedParsedManifestReadableError(err))
 		return
 	}
@@ -70,40 +83,115 @@ func (c *Context) CreateApplicationInstance(rw web.ResponseWriter, req *web.Requ
 		}
 	}
 
-	if isNameUsedInCoreComponents(manifest.Name, coreComponentsContainerVersions) {
-		commonHttp.Respond400(rw, fmt.Errorf("Cannot create application with name: %s, "+
-			"this name is already used by core platform component", manifest.Name))
+	quota := quotaRequest{}
+	for _, manifest := range manifests {
+		if isNameUsedInCoreComponents(manifest.Name, coreComponentsContainerVersions) {
+			commonHttp.Respond400(rw, fmt.Errorf("Cannot create application with name: %s, "+
+				"this name is already used by core platform component", manifest.Name))
+			return
+		}
+
+		applicationQuota, err := applicationQuotaRequest(manifest)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return
+		}
+		quota = quota.add(applicationQuota)
+	}
+	if c.respondIfQuotaExceeded(rw, quota) {
 		return
 	}
 
-	// VALIDATE DEPENDENCY
-	instanceDependencies, err := getInstanceDependencyForBindings(manifest.Bindings)
-	if err != nil {
-		logger.Error("getInstanceDependencyForBindings failed!")
-		commonHttp.Respond400(rw, err)
+	deployments := []applicationDeployment{}
+	for _, manifest := range manifests {
+		// VALIDATE DEPENDENCY
+		instanceDependencies, err := getInstanceDependencyForBindings(manifest.Bindings)
+		if err != nil {
+			logger.Error("getInstanceDependencyForBindings failed!")
+			commonHttp.Respond400(rw, err)
+			return
+		}
+
+		// READ FILE TAR.GZ
+		blob, handler, err := req.FormFile(getManifestBlobField(manifest))
+		if err != nil {
+			errorMessage := fmt.Sprintf("failed to read %s of application %s: %v", getManifestBlobField(manifest), manifest.Name, err)
+			logger.Error(errorMessage)
+			commonHttp.Respond500(rw, errors.New(errorMessage))
+			return
+		}
+		defer blob.Close()
+		logger.Infof("Read %v", handler.Filename)
+
+		deployments = append(deployments, applicationDeployment{manifest: manifest, instanceDependencies: instanceDependencies, blob: blob})
+	}
+
+	// applications of manifest list are created all or none
+	tx := newSaga("create application")
+	defer tx.rollbackUnlessCommitted()
+
+	responseApplications := []catalogModels.Application{}
+	for _, deployment := range deployments {
+		responseApplication, status, err := c.createApplication(deployment, tx)
+		if err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		responseApplications = append(responseApplications, responseApplication)
+	}
+	tx.commit()
+
+	for _, responseApplication := range responseApplications {
+		if hasRuntimeConfig(responseApplication.Metadata) {
+			startRuntimeConfigApplication(responseApplication.Id)
+		}
+	}
+
+	createdApplications := []models.CreatedApplication{}
+	for _, responseApplication := range responseApplications {
+		operationId := startOperation(rw, req, c.Username, models.OperationTypeCreateApplication, models.OperationTargetApplication, responseApplication.Id,
+			applicationStateCheck(responseApplication.Id, catalogModels.InstanceStateRunning))
+		createdApplications = append(createdApplications, models.CreatedApplication{Application: responseApplication, OperationId: operationId})
+	}
+
+	if isList {
+		// operation of each application is returned in response body instead
+		rw.Header().Del("Location")
+
+		applicationIds := []string{}
+		for _, created := range createdApplications {
+			applicationIds = append(applicationIds, created.Application.Id)
+		}
+		if timeout > 0 {
+			respondWhenConditionMet(rw, timeout, applicationsStateCondition(applicationIds, catalogModels.InstanceStateRunning))
+			return
+		}
+		commonHttp.WriteJson(rw, createdApplications, http.StatusAccepted)
 		return
 	}
 
-	// READ FILE TAR.GZ
-	blob, handler, err := req.FormFile("blob")
-	if err != nil {
-		errorMessage := "failed to read blob: " + err.Error()
-		logger.Error(errorMessage)
-		commonHttp.Respond500(rw, errors.New(errorMessage))
+	responseApplication := createdApplications[0].Application
+	if timeout > 0 {
+		respondWhenConditionMet(rw, timeout, applicationStateCondition(responseApplication.Id, catalogModels.InstanceStateRunning))
 		return
 	}
-	defer blob.Close()
-	logger.Infof("Read %v", handler.Filename)
+	commonHttp.WriteJson(rw, responseApplication, http.StatusAccepted)
+}
+
+// createApplication adds application with its image to catalog and stores its blob, so image can be built.
+// Every finished step is registered in tx, so it can be undone when creation fails.
+func (c *Context) createApplication(deployment applicationDeployment, tx *saga) (catalogModels.Application, int, error) {
+	manifest := deployment.manifest
 
 	// ADD APP TO CATALOG
-	application := c.getApplicationEntity(manifest, instanceDependencies)
+	application := c.getApplicationEntity(manifest, deployment.instanceDependencies)
 
 	responseApplication, status, err := BrokerConfig.CatalogApi.AddApplication(application)
 	if err != nil {
 		logger.Error("CatalogApi.AddApplication failed")
-		commonHttp.GenericRespond(status, rw, err)
-		return
+		return responseApplication, status, err
 	}
+	tx.onRollback("delete application "+responseApplication.Id, deleteApplicationFromCatalog(responseApplication.Id))
 
 	// ADD IMAGE TO CATALOG
 	imageId := catalogModels.GenerateImageId(responseApplication.Id)
@@ -117,32 +205,29 @@ func (c *Context) CreateApplicationInstance(rw web.ResponseWriter, req *web.Requ
 
 	if _, status, err = BrokerConfig.CatalogApi.AddImage(image); err != nil {
 		logger.Error("CatalogApi.AddImage failed")
-		commonHttp.GenericRespond(status, rw, err)
-		return
+		return responseApplication, status, err
 	}
+	tx.onRollback("delete image "+imageId, deleteImageFromCatalog(imageId))
 
 	if responseApplication, status, err = UpdateApplicationImageId(responseApplication.Id, imageId, c.Username); err != nil {
 		logger.Errorf("UpdateApplicationImageId failed - Application.Id: %s , Image.Id: %s", responseApplication.Id, imageId)
-		commonHttp.GenericRespond(status, rw, err)
-		return
+		return responseApplication, status, err
 	}
 
 	// SAVE FILE
 
-	if err = BrokerConfig.BlobStoreApi.StoreBlob(imageId, blob); err != nil {
+	if err = BrokerConfig.BlobStoreApi.StoreBlob(imageId, deployment.blob); err != nil {
 		logger.Error("BlobStoreApi.StoreBlob failed")
-		commonHttp.Respond500(rw, err)
-		return
+		return responseApplication, http.StatusInternalServerError, err
 	}
+	tx.onRollback("delete blob "+imageId, deleteBlobFromBlobStore(imageId))
 
 	_, err = updateImageState(imageId, catalogModels.ImageStatePending, c.Username)
 	if err != nil {
 		logger.Errorf("updateImageState failed - Image.Id: %s", imageId)
-		commonHttp.GenericRespond(http.StatusInternalServerError, rw, err)
-		return
+		return responseApplication, http.StatusInternalServerError, err
 	}
-
-	commonHttp.WriteJson(rw, responseApplication, http.StatusAccepted)
+	return responseApplication, http.StatusAccepted, nil
 }
 
 func isNameUsedInCoreComponents(name string, coreComponents []containerBrokerModels.VersionsResponse) bool {
@@ -160,7 +245,7 @@ func (c *Context) getApplicationEntity(manifest *models.Manifest, instanceDepend
 		Replication:          manifest.Instances,
 		TemplateId:           genericApplicationTemplateID,
 		InstanceDependencies: instanceDependencies,
-		Metadata:             manifest.Metadata,
+		Metadata:             c.withOrganization(append(runtimeConfigToMetadata(manifest.ApplicationRuntimeConfig), manifest.Metadata...)),
 		AuditTrail:           c.getAuditTrail(),
 	}
 }
@@ -180,34 +265,26 @@ func (c *Context) parseTemplate(imageId string, req *web.Request) (*templateRepo
 }
 
 func (c *Context) getValidatedParsedManifest(req *web.Request) (*models.Manifest, error) {
-	manifest, err := c.parseManifest(req)
+	manifests, isList, err := c.getValidatedParsedManifests(req)
 	if err != nil {
-		logger.Debug("parseManifest failed!")
+		logger.Debug("getValidatedParsedManifests failed!")
 		return &models.Manifest{}, err
 	}
-
-	err = c.validateManifest(manifest)
-	if err != nil {
-		logger.Debug("validateManifest failed!")
-		return &models.Manifest{}, err
+	if isList {
+		return &models.Manifest{}, errSingleApplicationManifestRequired
 	}
-	return manifest, nil
+	return manifests[0], nil
 }
 
 func (c *Context) parseManifest(req *web.Request) (*models.Manifest, error) {
-	imageContent, err := c.readFormFile(req, "manifest")
+	manifests, isList, err := c.parseManifests(req)
 	if err != nil {
-		logger.Debug("readFormFile failed!")
 		return nil, err
 	}
-	manifest := models.Manifest{}
-	err = json.Unmarshal(imageContent, &manifest)
-	if err != nil {
-		logger.Debug("Unmarshal failed!")
-		return nil, err
+	if isList {
+		return nil, errSingleApplicationManifestRequired
 	}
-	logger.Debugf("read manifest: %+v\n", manifest)
-	return &manifest, nil
+	return manifests[0], nil
 }
 
 func (c *Context) parseOffering(rw web.ResponseWriter, req *web.Request) (catalogModels.Service, error) {
@@ -233,6 +310,9 @@ func (c *Context) validateManifest(manifest *models.Manifest) error {
 	if err := validateInstancesNumber(manifest.Instances); err != nil {
 		return err
 	}
+	if err := validateRuntimeConfig(manifest.ApplicationRuntimeConfig); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -314,14 +394,28 @@ func (c *Context) readFormFile(req *web.Request, name string) ([]byte, error) {
 }
 
 func (c *Context) GetApplicationInstances(rw web.ResponseWriter, req *web.Request) {
-	appFilter := commonHttp.CreateItemFilter(req)
-	apiApplicationInstances, err := getApplicationInstances(appFilter)
+	query, err := parseListQuery(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	// paging is done after filtering and sorting, so only name filter is passed to Catalog
+	appFilter := &commonHttp.ItemFilter{Name: commonHttp.GetQueryParameterCaseInsensitive(req, "name")}
+	apiApplicationInstances, err := c.getApplicationInstances(req, appFilter)
 	if err != nil {
 		commonHttp.Respond500(rw, err)
 		return
 	}
 
-	commonHttp.WriteJson(rw, apiApplicationInstances, http.StatusOK)
+	indexes, total := query.apply(applicationInstancesToListItems(apiApplicationInstances))
+	result := []models.ApplicationInstance{}
+	for _, i := range indexes {
+		result = append(result, apiApplicationInstances[i])
+	}
+
+	writeTotalCount(rw, total)
+	commonHttp.WriteJson(rw, result, http.StatusOK)
 }
 
 func (c *Context) GetApplicationInstance(rw web.ResponseWriter, req *web.Request) {
@@ -336,7 +430,7 @@ func (c *Context) GetApplicationInstance(rw web.ResponseWriter, req *web.Request
 	commonHttp.WriteJson(rw, apiApplicationInstance, http.StatusOK)
 }
 
-func getApplicationInstances(filter *commonHttp.ItemFilter) ([]models.ApplicationInstance, error) {
+func (c *Context) getApplicationInstances(req *web.Request, filter *commonHttp.ItemFilter) ([]models.ApplicationInstance, error) {
 	applicationInstances, _, err := BrokerConfig.CatalogApi.ListApplicationsInstances()
 	if err != nil {
 		err = errors.New("Cannot fetch application instances from Catalog: %s" + err.Error())
@@ -349,6 +443,11 @@ func getApplicationInstances(filter *commonHttp.ItemFilter) ([]models.Applicatio
 		return nil, err
 	}
 
+	applications, _, err = c.filterApplicationsByOrganization(req, c.filterAccessibleApplications(applications))
+	if err != nil {
+		return nil, err
+	}
+
 	apiApplicationInstances, err := ParseToApiApplicationInstances(applications, applicationInstances)
 	if err != nil {
 		err = errors.New("Cannot parse ApiApplicationInstance list: " + err.Error())
@@ -388,6 +487,12 @@ func getApplicationInstance(applicationId string) (apiServiceApp models.Applicat
 func (c *Context) DeleteApplication(rw web.ResponseWriter, req *web.Request) {
 	applicationId := req.PathParams["applicationId"]
 
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
 	if err != nil {
 		commonHttp.WriteJson(rw, "", http.StatusNotFound)
@@ -414,6 +519,12 @@ func (c *Context) DeleteApplication(rw web.ResponseWriter, req *web.Request) {
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
+	deleteApplicationVersionImages(application)
+
+	if timeout > 0 {
+		respondWhenConditionMet(rw, timeout, instanceRemovedCondition(instance.Id))
+		return
+	}
 	commonHttp.WriteJson(rw, "", http.StatusNoContent)
 }
 
@@ -425,6 +536,7 @@ func (c *Context) removeApplicationWithImageFromCatalog(application catalogModel
 	if status, err := BrokerConfig.CatalogApi.DeleteImage(application.ImageId); err != nil {
 		logger.Warningf("Cannot delete image %q from Catalog. Status: %d. Error: %v", application.ImageId, status, err)
 	}
+	deleteApplicationVersionImages(application)
 
 	return http.StatusNoContent, nil
 }
@@ -451,7 +563,7 @@ func updateImageState(imageId string, newState catalogModels.ImageState, usernam
 }
 
 func (c *Context) ScaleApplicationInstance(rw web.ResponseWriter, req *web.Request) {
-	c.makeApplicationOperation(rw, req, ScaleInstance)
+	c.makeApplicationOperation(rw, req, c.ScaleInstance)
 }
 
 func (c *Context) StopApplicationInstance(rw web.ResponseWriter, req *web.Request) {
@@ -0,0 +1,155 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/audit"
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const anonymousUsername = "anonymous"
+
+// auditTargetPathParams are checked in order to find id of resource affected by request
+var auditTargetPathParams = []string{
+	"applicationId", "dstApplicationId", "serviceId", "dstServiceId", "instanceId", "offeringId", "orgId", "operationId",
+}
+
+func isMutatingRequest(req *web.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// AuditMiddleware records every mutating request in BrokerConfig.AuditSink. It runs before authorization,
+// so login and attempts rejected with 401 or 403 are recorded too, as anonymous if caller is not known.
+// Request bodies are not recorded, as they may contain credentials.
+func (c *Context) AuditMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	next(rw, req)
+
+	if BrokerConfig.AuditSink == nil || c.auditRecorded || !isAuditedRequest(req, rw.StatusCode()) {
+		return
+	}
+
+	operationId := ""
+	if location := rw.Header().Get("Location"); location != "" {
+		operationId = path.Base(location)
+	}
+	c.recordAuditEntry(req, rw.StatusCode(), operationId)
+}
+
+func isAuditedRequest(req *web.Request, status int) bool {
+	return isMutatingRequest(req) || isLoginRequest(req) || status == http.StatusUnauthorized || status == http.StatusForbidden
+}
+
+func isLoginRequest(req *web.Request) bool {
+	return path.Base(req.RoutePath()) == "login"
+}
+
+// recordAuditEntry is used directly by handlers of requests which are not mutating but have to be audited
+func (c *Context) recordAuditEntry(req *web.Request, status int, operationId string) {
+	if BrokerConfig.AuditSink == nil {
+		return
+	}
+	c.auditRecorded = true
+
+	entry := models.AuditEntry{
+		Timestamp:   time.Now().Unix(),
+		Username:    c.getAuditUsername(req),
+		Action:      fmt.Sprintf("%s %s", req.Method, req.RoutePath()),
+		TargetId:    getAuditTargetId(req),
+		Summary:     getAuditRequestSummary(req),
+		Status:      status,
+		OperationId: operationId,
+	}
+
+	if err := BrokerConfig.AuditSink.Record(entry); err != nil {
+		logger.Errorf("Cannot record audit entry %+v: %v", entry, err)
+	}
+}
+
+// getAuditUsername falls back to user logging in, as login is not authorized
+func (c *Context) getAuditUsername(req *web.Request) string {
+	if c.Username != "" {
+		return c.Username
+	}
+	if username, _, ok := req.BasicAuth(); ok && username != "" && isLoginRequest(req) {
+		return username
+	}
+	return anonymousUsername
+}
+
+func getAuditTargetId(req *web.Request) string {
+	for _, param := range auditTargetPathParams {
+		if id := req.PathParams[param]; id != "" {
+			return id
+		}
+	}
+	return ""
+}
+
+func getAuditRequestSummary(req *web.Request) string {
+	summary := req.URL.Path
+	if req.URL.RawQuery != "" {
+		summary += "?" + req.URL.RawQuery
+	}
+	if req.ContentLength > 0 {
+		summary += fmt.Sprintf(" (%s body, %d bytes)", req.Header.Get("Content-Type"), req.ContentLength)
+	}
+	return summary
+}
+
+func (c *Context) GetAuditLog(rw web.ResponseWriter, req *web.Request) {
+	if BrokerConfig.AuditSink == nil {
+		commonHttp.GenericRespond(http.StatusServiceUnavailable, rw, errors.New("audit log is not configured"))
+		return
+	}
+
+	from, to, err := parseMetricsTimeRange(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	limit, err := parseNonNegativeQueryParameter(req, "limit")
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	filter := audit.Filter{
+		From:     from,
+		To:       to,
+		Username: commonHttp.GetQueryParameterCaseInsensitive(req, "user"),
+		Limit:    limit,
+	}
+	entries, err := BrokerConfig.AuditSink.Query(filter)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, entries, http.StatusOK)
+}
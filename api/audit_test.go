@@ -0,0 +1,160 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/audit"
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+type memoryAuditSink struct {
+	entries []models.AuditEntry
+}
+
+func (s *memoryAuditSink) Record(entry models.AuditEntry) error {
+	s.entries = append(s.entries, entry)
+	return nil
+}
+
+func (s *memoryAuditSink) Query(filter audit.Filter) ([]models.AuditEntry, error) {
+	result := []models.AuditEntry{}
+	for _, entry := range s.entries {
+		if filter.Matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	return result, nil
+}
+
+func TestAuditMiddleware(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	restartURL := fmt.Sprintf("/api/%s/services/%s/restart", apiPrefix, instanceID1)
+	auditURL := fmt.Sprintf("/api/%s/audit", apiPrefix)
+
+	Convey("Test audit log", t, func() {
+		sink := &memoryAuditSink{}
+		BrokerConfig.AuditSink = sink
+
+		Convey("When mutating request is made", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+			)
+
+			response := SendPut(restartURL, nil, mocksAndRouter.router)
+			So(response.Code, ShouldEqual, http.StatusAccepted)
+
+			Convey("it should be recorded with target and operation id", func() {
+				So(sink.entries, ShouldHaveLength, 1)
+				entry := sink.entries[0]
+				So(entry.Action, ShouldEndWith, "/services/:serviceId/restart")
+				So(entry.TargetId, ShouldEqual, instanceID1)
+				So(entry.OperationId, ShouldNotBeEmpty)
+				So(entry.Status, ShouldEqual, http.StatusAccepted)
+			})
+
+			Convey("it should be returned by audit endpoint", func() {
+				response := SendGet(auditURL, mocksAndRouter.router)
+
+				So(response.Code, ShouldEqual, http.StatusOK)
+				entries := []models.AuditEntry{}
+				readAndAssertJson(response, &entries)
+				So(entries, ShouldResemble, sink.entries)
+			})
+		})
+
+		Convey("When audit log is queried with invalid time range", func() {
+			response := SendGet(auditURL+"?from=20&to=10", mocksAndRouter.router)
+
+			Convey("status code should be 400 and nothing should be recorded", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+				So(sink.entries, ShouldBeEmpty)
+			})
+		})
+
+		Reset(func() {
+			BrokerConfig.AuditSink = nil
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestAuditOfRejectedAttempts(t *testing.T) {
+	restartURL := fmt.Sprintf("/api/%s/services/%s/restart", apiPrefix, instanceID1)
+
+	Convey("Test audit of requests rejected before reaching handler", t, func() {
+		mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		sink := &memoryAuditSink{}
+		BrokerConfig.AuditSink = sink
+		defer func() { BrokerConfig.AuditSink = nil }()
+
+		Convey("When mutating request has no credentials", func() {
+			response := commonHttp.SendRequest("PUT", restartURL, nil, mocksAndRouter.router, t)
+
+			Convey("it should be recorded as anonymous attempt", func() {
+				So(response.Code, ShouldEqual, http.StatusUnauthorized)
+				So(sink.entries, ShouldHaveLength, 1)
+				So(sink.entries[0].Username, ShouldEqual, anonymousUsername)
+				So(sink.entries[0].Status, ShouldEqual, http.StatusUnauthorized)
+				So(sink.entries[0].TargetId, ShouldEqual, instanceID1)
+			})
+		})
+
+		Convey("When caller lacks permission", func() {
+			token := uaa_connector.TapJWTToken{Username: otherUsername, Scope: []string{"unknown.scope"}}
+			response := sendWithToken("GET", fmt.Sprintf("/api/%s/services", apiPrefix), "", token, mocksAndRouter, t)
+
+			Convey("denied read should be recorded with caller username", func() {
+				So(response.Code, ShouldEqual, http.StatusForbidden)
+				So(sink.entries, ShouldHaveLength, 1)
+				So(sink.entries[0].Username, ShouldEqual, otherUsername)
+				So(sink.entries[0].Status, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("When login fails", func() {
+			mocksAndRouter.uaaApiMock.EXPECT().Login(ownerUsername, "wrong").
+				Return(nil, http.StatusUnauthorized, errors.New("bad credentials"))
+
+			header := http.Header{}
+			header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(ownerUsername+":wrong")))
+			response := commonHttp.SendRequestWithHeaders("GET", fmt.Sprintf("/api/%s/login", apiPrefix), nil, mocksAndRouter.router, header, t)
+
+			Convey("attempt should be recorded with username logging in", func() {
+				So(response.Code, ShouldEqual, http.StatusUnauthorized)
+				So(sink.entries, ShouldHaveLength, 1)
+				So(sink.entries[0].Username, ShouldEqual, ownerUsername)
+				So(sink.entries[0].Action, ShouldEqual, fmt.Sprintf("GET /api/%s/login", apiPrefix))
+			})
+		})
+	})
+}
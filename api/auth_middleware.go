@@ -24,6 +24,7 @@ import (
 
 	"github.com/gocraft/web"
 
+	"github.com/trustedanalytics-ng/tap-api-service/models"
 	uaaConnector "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
 	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
 	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
@@ -47,42 +48,56 @@ func (c *Context) BasicAuthorizeMiddleware(rw web.ResponseWriter, req *web.Reque
 	next(rw, req)
 }
 
+// Oauth2AuthorizeMiddleware authenticates caller with bearer token passed in Authorization header.
+// Requests without bearer token may authenticate with API key of service account instead.
 func (c *Context) Oauth2AuthorizeMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-	c.authorizeUser([]string{userGroup, adminGroup}, rw, req, next)
-}
-
-func (c *Context) Oauth2AuthorizeAdminMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
-	c.authorizeUser([]string{adminGroup}, rw, req, next)
-}
+	if !hasBearerToken(req) && req.Header.Get(apiKeyHeader) != "" {
+		c.apiKeyAuthorize(rw, req, next)
+		return
+	}
 
-func (c *Context) authorizeUser(allowedRoles []string, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
 	jwt, err := getJwtToken(req)
 	if err != nil {
 		commonHttp.RespondUnauthorized(rw)
 		return
 	}
+	c.authorizePrincipal(jwt.Username, jwt.Scope, rw, req, next)
+}
+
+// authorizePrincipal checks if user or service account with given scopes is permitted to call matched route
+func (c *Context) authorizePrincipal(username string, scopes []string, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	// username is set before the checks, so audit knows who was denied
+	c.Username = username
 
-	if !hasRole(jwt.Scope, allowedRoles) {
-		logger.Infof("Endpoint only for admins, %v is not admin", jwt.Username)
+	requiredPermission, found := getRoutePermission(req)
+	if !found {
+		logger.Errorf("No permission defined for %s %s, access denied", req.Method, req.RoutePath())
 		commonHttp.Respond403(rw)
 		return
 	}
 
-	c.Username = jwt.Username
+	permissions := getGrantedPermissions(getAccessPolicy(), scopes)
+	if len(permissions) == 0 || (requiredPermission != permissionAuthenticated && !hasPermission(permissions, requiredPermission)) {
+		logger.Infof("User %v with scopes %v lacks permission %q", username, scopes, requiredPermission)
+		commonHttp.Respond403(rw)
+		return
+	}
+
+	c.Scopes = scopes
+	c.Permissions = permissions
+	c.IsAdmin = hasPermission(permissions, models.PermissionAllResourcesManage)
 	next(rw, req)
 }
 
 func getJwtToken(req *web.Request) (*uaaConnector.TapJWTToken, error) {
 	logger.Info("Trying to access url ", req.URL.Path, " by OAuth2Authorize")
 
-	authorization := req.Header.Get("Authorization")
-
-	if !strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+	if !hasBearerToken(req) {
 		err := errors.New("no bearer in Authorization header")
 		return nil, err
 	}
 
-	token := authorization[7:]
+	token := req.Header.Get("Authorization")[7:]
 
 	jwt, err := BrokerConfig.UaaApi.ValidateOauth2Token(token)
 	if err != nil {
@@ -94,6 +109,10 @@ func getJwtToken(req *web.Request) (*uaaConnector.TapJWTToken, error) {
 	return jwt, nil
 }
 
+func hasBearerToken(req *web.Request) bool {
+	return strings.HasPrefix(strings.ToLower(req.Header.Get("Authorization")), "bearer ")
+}
+
 func hasRole(userRoles []string, allowedRoles []string) bool {
 	for _, role := range allowedRoles {
 		if commonHttp.StringInSlice(role, userRoles) {
@@ -120,6 +139,26 @@ func (c *Context) Login(rw web.ResponseWriter, req *web.Request) {
 	commonHttp.WriteJson(rw, loginResp, http.StatusOK)
 }
 
+func (c *Context) RefreshToken(rw web.ResponseWriter, req *web.Request) {
+	refreshReq := models.RefreshTokenRequest{}
+	if err := ReadJsonAndValidate(req, &refreshReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	loginResp, status, err := BrokerConfig.UaaApi.RefreshToken(refreshReq.RefreshToken)
+	if err != nil {
+		if status == http.StatusBadRequest || status == http.StatusUnauthorized {
+			// UAA rejects expired or revoked refresh token with one of these codes
+			status = http.StatusUnauthorized
+		}
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, loginResp, http.StatusOK)
+}
+
 func (c *Context) getAuditTrail() catalogModels.AuditTrail {
 	return catalogModels.AuditTrail{
 		LastUpdateBy: c.Username,
@@ -17,6 +17,8 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"testing"
@@ -132,3 +134,46 @@ func TestOauth2AuthorizeAdminMiddleware(t *testing.T) {
 
 	})
 }
+
+func TestRefreshToken(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	refreshURL := "/api/v3/login/refresh"
+
+	Convey("Test POST /login/refresh", t, func() {
+		Convey("When refresh token is valid", func() {
+			loginResponse := uaa_connector.LoginResponse{AccessToken: "new-token", RefreshToken: "new-refresh-token"}
+			mocksAndRouter.uaaApiMock.EXPECT().RefreshToken("refresh-token").Return(&loginResponse, http.StatusOK, nil)
+
+			response := commonHttp.SendRequest("POST", refreshURL, []byte(`{"refresh_token": "refresh-token"}`), mocksAndRouter.router, t)
+
+			Convey("new tokens should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := uaa_connector.LoginResponse{}
+				So(json.Unmarshal(response.Body.Bytes(), &result), ShouldBeNil)
+				So(result, ShouldResemble, loginResponse)
+			})
+		})
+
+		Convey("When refresh token is rejected by UAA", func() {
+			mocksAndRouter.uaaApiMock.EXPECT().RefreshToken("expired").Return(nil, http.StatusBadRequest, errors.New("invalid_grant"))
+
+			response := commonHttp.SendRequest("POST", refreshURL, []byte(`{"refresh_token": "expired"}`), mocksAndRouter.router, t)
+
+			Convey("status code should be 401", func() {
+				So(response.Code, ShouldEqual, http.StatusUnauthorized)
+			})
+		})
+
+		Convey("When refresh token is missing", func() {
+			response := commonHttp.SendRequest("POST", refreshURL, []byte(`{}`), mocksAndRouter.router, t)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -19,4 +19,10 @@ package api
 const (
 	WaitingForInstanceStateRetries        = "WAITING_FOR_INSTANCE_STATE_CHANGE_RETRIES"
 	WaitingForInstanceStateRetriesDefault = 10 * 60 // 10min
+	MaxWaitTimeout                        = "MAX_WAIT_TIMEOUT"
+	MaxWaitTimeoutDefault                 = 10 * 60 // 10min
+	LogsFollowTimeout                     = "LOGS_FOLLOW_TIMEOUT"
+	LogsFollowTimeoutDefault              = 30 * 60 // 30min
+	OrphansGracePeriod                    = "ORPHANS_GRACE_PERIOD"
+	OrphansGracePeriodDefault             = 60 * 60 // 1h
 )
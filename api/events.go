@@ -0,0 +1,280 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const lastEventIdHeader = "Last-Event-ID"
+
+var (
+	eventsWatchRetryInterval = time.Second
+	eventsKeepAliveInterval  = 15 * time.Second
+)
+
+type catalogWatchFunc func(afterIndex uint64) (catalogModels.StateChange, int, error)
+
+type eventsFilter struct {
+	ids   []string
+	types []string
+}
+
+func (f eventsFilter) watchInstances() bool {
+	if len(f.types) == 0 {
+		return true
+	}
+	for _, eventType := range f.types {
+		if eventType != models.EventTypeImage {
+			return true
+		}
+	}
+	return false
+}
+
+func (f eventsFilter) watchImages() bool {
+	return len(f.types) == 0 || commonHttp.StringInSlice(models.EventTypeImage, f.types)
+}
+
+func (f eventsFilter) matches(event models.StateChangeEvent) bool {
+	if len(f.ids) > 0 && !commonHttp.StringInSlice(event.Id, f.ids) {
+		return false
+	}
+	if len(f.types) > 0 && !commonHttp.StringInSlice(event.Type, f.types) {
+		return false
+	}
+	return true
+}
+
+func parseEventsFilter(req *web.Request) eventsFilter {
+	return eventsFilter{
+		ids:   splitQueryParameterList(commonHttp.GetQueryParameterCaseInsensitive(req, "id")),
+		types: splitQueryParameterList(strings.ToUpper(commonHttp.GetQueryParameterCaseInsensitive(req, "type"))),
+	}
+}
+
+func splitQueryParameterList(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func getEventsStartIndex(req *web.Request) (uint64, int, error) {
+	lastEventId := req.Header.Get(lastEventIdHeader)
+	if lastEventId == "" {
+		lastEventId = commonHttp.GetQueryParameterCaseInsensitive(req, "lastEventId")
+	}
+
+	if lastEventId != "" {
+		index, err := strconv.ParseUint(lastEventId, 10, 64)
+		if err != nil {
+			return 0, http.StatusBadRequest, fmt.Errorf("invalid %s %q: %v", lastEventIdHeader, lastEventId, err)
+		}
+		return index, http.StatusOK, nil
+	}
+
+	latestIndex, status, err := BrokerConfig.CatalogApi.GetLatestIndex()
+	if err != nil {
+		return 0, status, fmt.Errorf("cannot fetch latest index from Catalog: %v", err)
+	}
+	return latestIndex.Latest, http.StatusOK, nil
+}
+
+// StreamEvents streams state changes of instances and images as Server-Sent Events.
+// Every event id is a catalog index, so clients can resume with Last-Event-ID header.
+func (c *Context) StreamEvents(rw web.ResponseWriter, req *web.Request) {
+	filter := parseEventsFilter(req)
+
+	afterIndex, status, err := getEventsStartIndex(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	done := req.Request.Context().Done()
+	changes := make(chan models.StateChangeEvent)
+	if filter.watchInstances() {
+		go watchCatalogChanges(models.EventKindInstance, BrokerConfig.CatalogApi.WatchInstances, afterIndex, changes, done)
+	}
+	if filter.watchImages() {
+		go watchCatalogChanges(models.EventKindImage, BrokerConfig.CatalogApi.WatchImages, afterIndex, changes, done)
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.Header().Set("X-Accel-Buffering", "no")
+	rw.WriteHeader(http.StatusOK)
+	rw.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	targets := make(map[string]eventTarget)
+	for {
+		select {
+		case <-done:
+			logger.Debug("Events stream closed by client")
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(rw, ": keep-alive\n\n")
+			rw.Flush()
+		case event := <-changes:
+			target := c.getEventTarget(req, event, targets)
+			event.Type = target.eventType
+			if !target.accessible || !filter.matches(event) {
+				continue
+			}
+			if err := writeServerSentEvent(rw, event); err != nil {
+				logger.Error("Cannot write event to stream: ", err)
+				return
+			}
+		}
+	}
+}
+
+func watchCatalogChanges(kind models.EventKind, watch catalogWatchFunc, afterIndex uint64,
+	changes chan<- models.StateChangeEvent, done <-chan struct{}) {
+
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		change, _, err := watch(afterIndex)
+		if err != nil {
+			logger.Warningf("Watching %s changes after index %d failed: %v", kind, afterIndex, err)
+			time.Sleep(eventsWatchRetryInterval)
+			continue
+		}
+		afterIndex = change.Index
+
+		event := models.StateChangeEvent{Index: change.Index, Kind: kind, Id: change.Id, State: change.State}
+		select {
+		case <-done:
+			return
+		case changes <- event:
+		}
+	}
+}
+
+// eventTarget describes entity whose state changed
+type eventTarget struct {
+	eventType  string
+	accessible bool
+}
+
+// neither type nor owner of entity changes, so they are fetched from Catalog only once per stream
+func (c *Context) getEventTarget(req *web.Request, event models.StateChangeEvent, cache map[string]eventTarget) eventTarget {
+	key := string(event.Kind) + "/" + event.Id
+	if target, found := cache[key]; found {
+		return target
+	}
+
+	var target eventTarget
+	var err error
+	if event.Kind == models.EventKindInstance {
+		target, err = c.getInstanceEventTarget(req, event.Id)
+	} else {
+		target, err = c.getImageEventTarget(req, event.Id)
+	}
+	if err != nil {
+		logger.Debugf("Cannot resolve %s %q of event: %v", event.Kind, event.Id, err)
+		return target
+	}
+	cache[key] = target
+	return target
+}
+
+// events are filtered with the same checks as instances reached by REST endpoints
+func (c *Context) getInstanceEventTarget(req *web.Request, instanceId string) (eventTarget, error) {
+	target := eventTarget{accessible: !c.isResourceAccessRestricted()}
+
+	instance, _, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		return target, err
+	}
+	target.eventType = string(instance.Type)
+	if !c.isResourceAccessRestricted() {
+		return target, nil
+	}
+
+	o := c.getOwnership(instance.AuditTrail, instance.Metadata)
+	if instance.Type == catalogModels.InstanceTypeApplication {
+		if o, _, err = getApplicationOwnership(c, instance.ClassId); err != nil {
+			return target, err
+		}
+	}
+	target.accessible, _, err = c.canAccessResource(req, o)
+	return target, err
+}
+
+// images of applications and user offerings are filtered like their application or offering
+func (c *Context) getImageEventTarget(req *web.Request, imageId string) (eventTarget, error) {
+	target := eventTarget{eventType: models.EventTypeImage, accessible: true}
+	if !c.isResourceAccessRestricted() {
+		return target, nil
+	}
+
+	var check ownershipCheck
+	var id string
+	switch {
+	case catalogModels.IsApplicationInstance(imageId):
+		check, id = getApplicationOwnership, catalogModels.GetApplicationId(imageId)
+	case catalogModels.IsUserDefinedOffering(imageId):
+		check, id = getOfferingOwnership, catalogModels.GetOfferingId(imageId)
+	default:
+		return target, nil
+	}
+
+	target.accessible = false
+	o, _, err := check(c, id)
+	if err != nil {
+		return target, err
+	}
+	target.accessible, _, err = c.canAccessResource(req, o)
+	return target, err
+}
+
+func writeServerSentEvent(rw web.ResponseWriter, event models.StateChangeEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(rw, "id: %d\nevent: %s\ndata: %s\n\n", event.Index, event.Kind, data); err != nil {
+		return err
+	}
+	rw.Flush()
+	return nil
+}
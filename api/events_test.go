@@ -0,0 +1,147 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func TestStreamEvents(t *testing.T) {
+	eventsURL := fmt.Sprintf("/api/%s/events", apiPrefix)
+	eventsWatchRetryInterval = time.Millisecond
+
+	// streams state change of given instance and waits until stream is closed after the next watch
+	streamInstanceEvent := func(mocksAndRouter mocksAndRouter, url string, instance catalogModels.Instance, header http.Header) *httptest.ResponseRecorder {
+		ctx, cancel := context.WithCancel(context.Background())
+		change := catalogModels.StateChange{Id: instance.Id, State: string(catalogModels.InstanceStateRunning), Index: 6}
+
+		gomock.InOrder(
+			mocksAndRouter.catalogApiMock.EXPECT().WatchInstances(uint64(5)).Return(change, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().WatchInstances(uint64(6)).
+				Do(func(afterIndex uint64) { cancel() }).
+				Return(catalogModels.StateChange{}, http.StatusInternalServerError, errors.New("canceled")),
+		)
+		mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil)
+
+		req, _ := http.NewRequest("GET", url, nil)
+		req = req.WithContext(ctx)
+		for key := range header {
+			req.Header.Set(key, header.Get(key))
+		}
+		req.Header.Set(lastEventIdHeader, "5")
+		response := httptest.NewRecorder()
+		mocksAndRouter.router.ServeHTTP(response, req)
+		return response
+	}
+
+	Convey(fmt.Sprintf("Test %s", eventsURL), t, func() {
+		Convey("When Last-Event-ID is invalid", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			req, _ := http.NewRequest("GET", eventsURL, nil)
+			req.Header.Set(lastEventIdHeader, "abc")
+			response := httptest.NewRecorder()
+			mocksAndRouter.router.ServeHTTP(response, req)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When Catalog returns error on latest index", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			mocksAndRouter.catalogApiMock.EXPECT().GetLatestIndex().
+				Return(catalogModels.Index{}, http.StatusInternalServerError, errors.New("error"))
+
+			response := SendGet(eventsURL, mocksAndRouter.router)
+
+			Convey("status code should be 500", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+
+		Convey("When application instance state changes and its event type is requested", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			instance := catalogModels.Instance{Id: instanceID1, Type: catalogModels.InstanceTypeApplication}
+			response := streamInstanceEvent(mocksAndRouter, eventsURL+"?type=application", instance, nil)
+
+			Convey("event should be streamed", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Header().Get("Content-Type"), ShouldEqual, "text/event-stream")
+				So(response.Body.String(), ShouldContainSubstring, "id: 6\nevent: instance\n")
+				So(response.Body.String(), ShouldContainSubstring, `"id":"`+instanceID1+`"`)
+				So(response.Body.String(), ShouldContainSubstring, `"type":"APPLICATION"`)
+			})
+		})
+
+		Convey("When application instance state changes and other event type is requested", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			instance := catalogModels.Instance{Id: instanceID1, Type: catalogModels.InstanceTypeApplication}
+			response := streamInstanceEvent(mocksAndRouter, eventsURL+"?type=SERVICE", instance, nil)
+
+			Convey("event should be filtered out", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Body.String(), ShouldNotContainSubstring, "event: instance")
+			})
+		})
+
+		Convey("When regular user streams events", func() {
+			mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			userToken := uaa_connector.TapJWTToken{Username: ownerUsername, Scope: []string{userGroup}}
+			mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&userToken, nil)
+			header := http.Header{}
+			header.Set("Authorization", fmt.Sprintf("bearer %s", testToken))
+
+			Convey("state change of instance owned by the user should be streamed", func() {
+				instance := getTestOwnedInstances()[0]
+				response := streamInstanceEvent(mocksAndRouter, eventsURL+"?type=SERVICE", instance, header)
+
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Body.String(), ShouldContainSubstring, `"id":"`+instance.Id+`"`)
+			})
+
+			Convey("state change of instance of other user should be filtered out", func() {
+				instance := getTestOwnedInstances()[2]
+				response := streamInstanceEvent(mocksAndRouter, eventsURL+"?type=SERVICE", instance, header)
+
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Body.String(), ShouldNotContainSubstring, "event: instance")
+			})
+		})
+	})
+}
@@ -0,0 +1,151 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gocraft/web"
+	"github.com/gorilla/websocket"
+
+	containerStreamApi "github.com/trustedanalytics-ng/tap-api-service/container-stream-connector"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+var defaultExecCommand = []string{"/bin/sh"}
+
+var websocketUpgrader = websocket.Upgrader{
+	// requests are authorized with bearer token, not cookies, so cross-origin requests are safe
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+func (c *Context) ExecInApplicationInstance(rw web.ResponseWriter, req *web.Request) {
+	instanceId, status, err := c.getApplicationInstanceID(req.PathParams["applicationId"])
+	if err != nil {
+		c.recordAuditEntry(req, status, "")
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	c.execInInstance(rw, req, instanceId)
+}
+
+func (c *Context) ExecInServiceInstance(rw web.ResponseWriter, req *web.Request) {
+	instanceId := req.PathParams["serviceId"]
+
+	status, err := c.checkServiceInstanceID(instanceId)
+	if err != nil {
+		c.recordAuditEntry(req, status, "")
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	c.execInInstance(rw, req, instanceId)
+}
+
+func parseExecOptions(req *web.Request) (containerStreamApi.ExecOptions, error) {
+	options := containerStreamApi.ExecOptions{
+		Container: commonHttp.GetQueryParameterCaseInsensitive(req, "container"),
+		Command:   req.URL.Query()["command"],
+	}
+	if len(options.Command) == 0 {
+		options.Command = defaultExecCommand
+	}
+
+	if tty := commonHttp.GetQueryParameterCaseInsensitive(req, "tty"); tty != "" {
+		var err error
+		if options.Tty, err = strconv.ParseBool(tty); err != nil {
+			return options, fmt.Errorf("tty has to be boolean, got %q", tty)
+		}
+	}
+	return options, nil
+}
+
+// execInInstance starts command in container of instance and relays WebSocket messages between client and Kubernetes API.
+// Every attempt is recorded in audit log, as exec gives full access to the container.
+func (c *Context) execInInstance(rw web.ResponseWriter, req *web.Request, instanceId string) {
+	if !websocket.IsWebSocketUpgrade(req.Request) {
+		c.recordAuditEntry(req, http.StatusBadRequest, "")
+		commonHttp.Respond400(rw, errors.New("exec requires WebSocket connection"))
+		return
+	}
+
+	options, err := parseExecOptions(req)
+	if err != nil {
+		c.recordAuditEntry(req, http.StatusBadRequest, "")
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	backend, status, err := BrokerConfig.ContainerStreamApi.Exec(instanceId, options, websocket.Subprotocols(req.Request))
+	if err != nil {
+		c.recordAuditEntry(req, status, "")
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	defer backend.Close()
+
+	conn, err := upgradeToWebSocket(rw, req, backend.Subprotocol())
+	if err != nil {
+		// upgrader has already responded with error
+		logger.Errorf("Cannot upgrade exec connection to instance %s: %v", instanceId, err)
+		c.recordAuditEntry(req, http.StatusBadRequest, "")
+		return
+	}
+	defer conn.Close()
+
+	c.recordAuditEntry(req, http.StatusSwitchingProtocols, "")
+	logger.Infof("User %s started %v in instance %s", c.Username, options.Command, instanceId)
+	relayWebSocketMessages(conn, backend)
+	logger.Infof("User %s finished %v in instance %s", c.Username, options.Command, instanceId)
+}
+
+func upgradeToWebSocket(rw web.ResponseWriter, req *web.Request, subprotocol string) (*websocket.Conn, error) {
+	header := http.Header{}
+	if subprotocol != "" {
+		header.Set("Sec-Websocket-Protocol", subprotocol)
+	}
+	return websocketUpgrader.Upgrade(rw, req.Request, header)
+}
+
+// relayWebSocketMessages copies messages in both directions until one of connections is closed
+func relayWebSocketMessages(client, backend *websocket.Conn) {
+	done := make(chan struct{}, 2)
+	go copyWebSocketMessages(backend, client, done)
+	go copyWebSocketMessages(client, backend, done)
+	<-done
+}
+
+func copyWebSocketMessages(dst, src *websocket.Conn, done chan<- struct{}) {
+	defer func() { done <- struct{}{} }()
+	for {
+		messageType, message, err := src.ReadMessage()
+		if err != nil {
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+			if closeErr, ok := err.(*websocket.CloseError); ok && closeErr.Code != websocket.CloseNoStatusReceived {
+				closeMessage = websocket.FormatCloseMessage(closeErr.Code, closeErr.Text)
+			}
+			dst.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+			return
+		}
+		if err := dst.WriteMessage(messageType, message); err != nil {
+			return
+		}
+	}
+}
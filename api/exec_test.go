@@ -0,0 +1,109 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+
+	containerStreamApi "github.com/trustedanalytics-ng/tap-api-service/container-stream-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+// newEchoWebSocketServer imitates Container Broker session which sends back every received message
+func newEchoWebSocketServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		conn, err := websocketUpgrader.Upgrade(rw, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, message)
+		}
+	}))
+}
+
+func toWebSocketURL(url string) string {
+	return "ws" + strings.TrimPrefix(url, "http")
+}
+
+func TestExecInApplicationInstance(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	testServer := httptest.NewServer(mocksAndRouter.router)
+	backendServer := newEchoWebSocketServer()
+	execURL := fmt.Sprintf("/api/%s/applications/%s/exec", apiPrefix, applicationID1)
+
+	Convey("Test /applications/:applicationId/exec", t, func() {
+		sink := &memoryAuditSink{}
+		BrokerConfig.AuditSink = sink
+		mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+			Return([]catalogModels.Instance{{Id: instanceID1}}, http.StatusOK, nil)
+
+		Convey("When WebSocket session is opened", func() {
+			expectedOptions := containerStreamApi.ExecOptions{Container: "app", Command: []string{"ls", "-l"}, Tty: true}
+			backend, _, err := websocket.DefaultDialer.Dial(toWebSocketURL(backendServer.URL), nil)
+			So(err, ShouldBeNil)
+			mocksAndRouter.containerStreamApiMock.EXPECT().Exec(instanceID1, expectedOptions, []string(nil)).
+				Return(backend, http.StatusSwitchingProtocols, nil)
+
+			conn, response, err := websocket.DefaultDialer.Dial(toWebSocketURL(testServer.URL)+execURL+"?container=app&command=ls&command=-l&tty=true", nil)
+			So(err, ShouldBeNil)
+			So(response.StatusCode, ShouldEqual, http.StatusSwitchingProtocols)
+
+			Convey("messages should be relayed to container and back and session should be recorded in audit log", func() {
+				So(conn.WriteMessage(websocket.BinaryMessage, []byte("input")), ShouldBeNil)
+				messageType, message, err := conn.ReadMessage()
+				So(err, ShouldBeNil)
+				So(messageType, ShouldEqual, websocket.BinaryMessage)
+				So(string(message), ShouldEqual, "input")
+
+				So(sink.entries, ShouldHaveLength, 1)
+				So(sink.entries[0].Action, ShouldEndWith, "/applications/:applicationId/exec")
+				So(sink.entries[0].Status, ShouldEqual, http.StatusSwitchingProtocols)
+				So(sink.entries[0].Summary, ShouldContainSubstring, "command=ls")
+			})
+
+			Reset(func() {
+				conn.Close()
+			})
+		})
+
+		Convey("When request is not WebSocket upgrade", func() {
+			response := SendGet(execURL, mocksAndRouter.router)
+
+			Convey("status code should be 400 and attempt should be recorded", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+				So(sink.entries, ShouldHaveLength, 1)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
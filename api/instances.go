@@ -39,7 +39,7 @@ func (c *Context) AddCatalogInstanceFromApiServiceInstance(apiServiceInstance mo
 	catalogInstance := catalogModels.Instance{}
 	catalogInstance.Name = apiServiceInstance.Name
 	catalogInstance.Bindings = apiServiceInstance.Bindings
-	catalogInstance.Metadata = apiServiceInstance.Metadata
+	catalogInstance.Metadata = c.withOrganization(apiServiceInstance.Metadata)
 	catalogInstance.Type = apiServiceInstance.Type
 	catalogInstance.ClassId = apiServiceInstance.OfferingId
 	catalogInstance.State = catalogModels.InstanceStateRequested
@@ -161,8 +161,8 @@ func ConvertToApiServiceAppInstance(application catalogModels.Application, appli
 	apiServiceAppInstance.AuditTrail = applicationInstance.AuditTrail
 	apiServiceAppInstance.State = getAppInstanceState(applicationInstance.State, image.State)
 
-	apiServiceAppInstance.Memory = apiApplicationInstanceMemoryDefault
-	apiServiceAppInstance.DiskQuota = apiApplicationInstanceDiskQuotaDefault
+	apiServiceAppInstance.Memory = getApplicationMemory(application.Metadata)
+	apiServiceAppInstance.DiskQuota = getApplicationDiskQuota(application.Metadata)
 	apiServiceAppInstance.RunningInstances = application.Replication
 
 	hosts := catalogModels.GetValueFromMetadata(applicationInstance.Metadata, "urls")
@@ -231,13 +231,3 @@ func getInstanceConnectedWithApplication(application catalogModels.Application,
 	}
 	return catalogModels.Instance{}
 }
-
-func limitInstanceNumber(instances int) error {
-	if instances > 5 {
-		return errors.New("Maximum allowed replication is 5")
-	}
-	if instances < 0 {
-		return errors.New("Minimum allowed replication is 0")
-	}
-	return nil
-}
@@ -0,0 +1,267 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const totalCountHeader = "X-Total-Count"
+
+// listItem holds fields of list endpoint element which can be used for filtering and sorting
+type listItem struct {
+	name      string
+	state     string
+	itemType  string
+	createdBy string
+	createdOn int64
+	updatedOn int64
+	tags      []string
+	metadata  []catalogModels.Metadata
+}
+
+type listSortKey struct {
+	field      string
+	descending bool
+}
+
+type listQuery struct {
+	limit     int
+	offset    int
+	sortKeys  []listSortKey
+	states    []string
+	types     []string
+	createdBy string
+	tag       string
+	metadata  []catalogModels.Metadata
+}
+
+var listSortFields = map[string]func(a, b listItem) bool{
+	"name":      func(a, b listItem) bool { return strings.ToLower(a.name) < strings.ToLower(b.name) },
+	"state":     func(a, b listItem) bool { return a.state < b.state },
+	"type":      func(a, b listItem) bool { return a.itemType < b.itemType },
+	"createdby": func(a, b listItem) bool { return a.createdBy < b.createdBy },
+	"createdon": func(a, b listItem) bool { return a.createdOn < b.createdOn },
+	"updatedon": func(a, b listItem) bool { return a.updatedOn < b.updatedOn },
+}
+
+// parseListQuery reads: limit, offset (or skip), sort=name,-createdOn, state, type, createdBy, tag and metadata=key:value
+func parseListQuery(req *web.Request) (listQuery, error) {
+	query := listQuery{
+		states:    splitQueryParameterList(strings.ToUpper(commonHttp.GetQueryParameterCaseInsensitive(req, "state"))),
+		types:     splitQueryParameterList(strings.ToUpper(commonHttp.GetQueryParameterCaseInsensitive(req, "type"))),
+		createdBy: commonHttp.GetQueryParameterCaseInsensitive(req, "createdBy"),
+		tag:       commonHttp.GetQueryParameterCaseInsensitive(req, "tag"),
+	}
+
+	var err error
+	if query.limit, err = parseNonNegativeQueryParameter(req, "limit"); err != nil {
+		return query, err
+	}
+	offsetParameter := "offset"
+	if commonHttp.GetQueryParameterCaseInsensitive(req, offsetParameter) == "" {
+		offsetParameter = "skip"
+	}
+	if query.offset, err = parseNonNegativeQueryParameter(req, offsetParameter); err != nil {
+		return query, err
+	}
+
+	for _, field := range splitQueryParameterList(commonHttp.GetQueryParameterCaseInsensitive(req, "sort")) {
+		key := listSortKey{field: strings.ToLower(strings.TrimPrefix(field, "-")), descending: strings.HasPrefix(field, "-")}
+		if _, found := listSortFields[key.field]; !found {
+			return query, fmt.Errorf("cannot sort by unknown field %q", field)
+		}
+		query.sortKeys = append(query.sortKeys, key)
+	}
+
+	for key, values := range req.URL.Query() {
+		if strings.ToLower(key) != "metadata" {
+			continue
+		}
+		for _, value := range values {
+			keyAndValue := strings.SplitN(value, ":", 2)
+			if len(keyAndValue) != 2 || keyAndValue[0] == "" {
+				return query, fmt.Errorf("metadata filter has to be in key:value format, got %q", value)
+			}
+			query.metadata = append(query.metadata, catalogModels.Metadata{Id: keyAndValue[0], Value: keyAndValue[1]})
+		}
+	}
+	return query, nil
+}
+
+func parseNonNegativeQueryParameter(req *web.Request, name string) (int, error) {
+	value := commonHttp.GetQueryParameterCaseInsensitive(req, name)
+	if value == "" {
+		return 0, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil || result < 0 {
+		return 0, fmt.Errorf("%s has to be non-negative integer, got %q", name, value)
+	}
+	return result, nil
+}
+
+// apply returns indexes of items which should be returned, in proper order, and number of all matching items
+func (q listQuery) apply(items []listItem) ([]int, int) {
+	selected := []int{}
+	for i, item := range items {
+		if q.matches(item) {
+			selected = append(selected, i)
+		}
+	}
+
+	if len(q.sortKeys) > 0 {
+		sort.Stable(listItemsSorter{items: items, indexes: selected, keys: q.sortKeys})
+	}
+
+	total := len(selected)
+	if q.offset >= len(selected) {
+		return []int{}, total
+	}
+	selected = selected[q.offset:]
+	if q.limit > 0 && q.limit < len(selected) {
+		selected = selected[:q.limit]
+	}
+	return selected, total
+}
+
+func (q listQuery) matches(item listItem) bool {
+	if len(q.states) > 0 && !commonHttp.StringInSlice(strings.ToUpper(item.state), q.states) {
+		return false
+	}
+	if len(q.types) > 0 && !commonHttp.StringInSlice(strings.ToUpper(item.itemType), q.types) {
+		return false
+	}
+	if q.createdBy != "" && q.createdBy != item.createdBy {
+		return false
+	}
+	if q.tag != "" && !containsTag(item.tags, q.tag) {
+		return false
+	}
+	for _, expected := range q.metadata {
+		if catalogModels.GetValueFromMetadata(item.metadata, expected.Id) != expected.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+type listItemsSorter struct {
+	items   []listItem
+	indexes []int
+	keys    []listSortKey
+}
+
+func (s listItemsSorter) Len() int {
+	return len(s.indexes)
+}
+
+func (s listItemsSorter) Swap(i, j int) {
+	s.indexes[i], s.indexes[j] = s.indexes[j], s.indexes[i]
+}
+
+func (s listItemsSorter) Less(i, j int) bool {
+	a, b := s.items[s.indexes[i]], s.items[s.indexes[j]]
+	for _, key := range s.keys {
+		less := listSortFields[key.field]
+		x, y := a, b
+		if key.descending {
+			x, y = b, a
+		}
+		if less(x, y) {
+			return true
+		}
+		if less(y, x) {
+			return false
+		}
+	}
+	return false
+}
+
+func writeTotalCount(rw web.ResponseWriter, total int) {
+	rw.Header().Set(totalCountHeader, strconv.Itoa(total))
+}
+
+func getListItemFromAuditTrail(auditTrail catalogModels.AuditTrail) listItem {
+	return listItem{
+		createdBy: auditTrail.CreatedBy,
+		createdOn: auditTrail.CreatedOn,
+		updatedOn: auditTrail.LastUpdatedOn,
+	}
+}
+
+func applicationInstancesToListItems(applications []models.ApplicationInstance) []listItem {
+	items := make([]listItem, len(applications))
+	for i, application := range applications {
+		items[i] = getListItemFromAuditTrail(application.AuditTrail)
+		items[i].name = application.Name
+		items[i].state = string(application.State)
+		items[i].itemType = string(application.Type)
+		items[i].metadata = application.Metadata
+	}
+	return items
+}
+
+// service instance has no tags on its own, so tags of its offering are used
+func serviceInstancesToListItems(instances []models.ServiceInstance, services []catalogModels.Service) []listItem {
+	offeringTags := make(map[string][]string)
+	for _, service := range services {
+		offeringTags[service.Id] = service.Tags
+	}
+
+	items := make([]listItem, len(instances))
+	for i, instance := range instances {
+		items[i] = getListItemFromAuditTrail(instance.AuditTrail)
+		items[i].name = instance.Name
+		items[i].state = string(instance.State)
+		items[i].itemType = string(instance.Type)
+		items[i].tags = offeringTags[instance.OfferingId]
+		items[i].metadata = instance.Metadata
+	}
+	return items
+}
+
+func offeringsToListItems(offerings []models.Offering) []listItem {
+	items := make([]listItem, len(offerings))
+	for i, offering := range offerings {
+		items[i] = listItem{
+			name:     offering.Name,
+			state:    offering.State,
+			tags:     offering.Tags,
+			metadata: offering.Metadata,
+		}
+	}
+	return items
+}
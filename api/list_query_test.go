@@ -0,0 +1,122 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gocraft/web"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func getTestListItems() []listItem {
+	return []listItem{
+		{name: "b", state: "RUNNING", itemType: "SERVICE", createdBy: "admin", createdOn: 3, tags: []string{"db"}},
+		{name: "a", state: "FAILURE", itemType: "SERVICE", createdBy: "user", createdOn: 1},
+		{name: "c", state: "RUNNING", itemType: "APPLICATION", createdBy: "admin", createdOn: 2,
+			metadata: []catalogModels.Metadata{{Id: metadataID1, Value: metadataValue1}}},
+	}
+}
+
+func TestListQueryApply(t *testing.T) {
+	testCases := []struct {
+		query           string
+		expectedIndexes []int
+		expectedTotal   int
+	}{
+		{"", []int{0, 1, 2}, 3},
+		{"sort=name", []int{1, 0, 2}, 3},
+		{"sort=-createdOn", []int{0, 2, 1}, 3},
+		{"sort=state,-name", []int{1, 2, 0}, 3},
+		{"state=running", []int{0, 2}, 2},
+		{"type=SERVICE&createdBy=admin", []int{0}, 1},
+		{"tag=DB", []int{0}, 1},
+		{"metadata=" + metadataID1 + ":" + metadataValue1, []int{2}, 1},
+		{"sort=name&limit=1&offset=1", []int{0}, 3},
+		{"skip=2", []int{2}, 3},
+		{"offset=5", []int{}, 3},
+	}
+
+	Convey("For set of test cases listQuery should return proper items", t, func() {
+		for _, tc := range testCases {
+			Convey(fmt.Sprintf("For query %q", tc.query), func() {
+				req, _ := http.NewRequest("GET", "/?"+tc.query, nil)
+				query, err := parseListQuery(&web.Request{Request: req})
+				So(err, ShouldBeNil)
+
+				indexes, total := query.apply(getTestListItems())
+				So(indexes, ShouldResemble, tc.expectedIndexes)
+				So(total, ShouldEqual, tc.expectedTotal)
+			})
+		}
+	})
+}
+
+func TestParseListQueryErrors(t *testing.T) {
+	queries := []string{"limit=-1", "offset=abc", "sort=unknown", "metadata=novalue"}
+
+	Convey("For set of invalid queries parseListQuery should return error", t, func() {
+		for _, query := range queries {
+			Convey(fmt.Sprintf("For query %q", query), func() {
+				req, _ := http.NewRequest("GET", "/?"+query, nil)
+				_, err := parseListQuery(&web.Request{Request: req})
+				So(err, ShouldNotBeNil)
+			})
+		}
+	})
+}
+
+func TestGetServiceInstancesPagination(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	url := fmt.Sprintf("/api/%s/services", apiPrefix)
+
+	Convey(fmt.Sprintf("Test %s with pagination", url), t, func() {
+		Convey("When page of sorted instances is requested", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestCatalogInstances(), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(getTestCatalogServices(), http.StatusOK, nil)
+
+			response := SendGet(url+"?sort=-name&limit=2", mocksAndRouter.router)
+
+			Convey("page and total count should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Header().Get(totalCountHeader), ShouldEqual, "5")
+				result := []models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 2)
+				So(result[0].Id, ShouldEqual, instanceID5)
+				So(result[1].Id, ShouldEqual, instanceID4)
+			})
+		})
+
+		Convey("When sort field is unknown", func() {
+			response := SendGet(url+"?sort=unknown", mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,505 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+const (
+	logsFormatJson = "json"
+	logsFormatText = "text"
+	logsFormatSSE  = "sse"
+
+	contentTypeTextPlain   = "text/plain; charset=utf-8"
+	contentTypeEventStream = "text/event-stream"
+
+	// joins instance name and container name in sources of merged logs
+	mergedLogsSeparator = "/"
+)
+
+// container broker does not support streaming, so followed logs are polled
+var logsFollowPollInterval = 2 * time.Second
+
+type logsFetcher func() (map[string]string, int, error)
+
+type logsQuery struct {
+	tail      int
+	tailSet   bool
+	since     time.Time
+	container string
+	grep      *regexp.Regexp
+	follow    bool
+	format    string
+	merge     bool
+}
+
+func (q logsQuery) hasFilters() bool {
+	return q.tailSet || !q.since.IsZero() || q.container != "" || q.grep != nil
+}
+
+func parseLogsQuery(req *web.Request) (logsQuery, error) {
+	query := logsQuery{
+		container: commonHttp.GetQueryParameterCaseInsensitive(req, "container"),
+		follow:    commonHttp.GetQueryParameterCaseInsensitive(req, "follow") == "true",
+	}
+
+	var err error
+	if query.tail, err = parseNonNegativeQueryParameter(req, "tail"); err != nil {
+		return query, err
+	}
+	query.tailSet = commonHttp.GetQueryParameterCaseInsensitive(req, "tail") != ""
+
+	if query.since, err = parseLogsSince(commonHttp.GetQueryParameterCaseInsensitive(req, "since"), time.Now()); err != nil {
+		return query, err
+	}
+
+	if grep := commonHttp.GetQueryParameterCaseInsensitive(req, "grep"); grep != "" {
+		if query.grep, err = regexp.Compile(grep); err != nil {
+			return query, fmt.Errorf("invalid grep expression %q: %v", grep, err)
+		}
+	}
+
+	if query.format, err = getLogsFormat(req, query.follow); err != nil {
+		return query, err
+	}
+	return query, nil
+}
+
+// parseLogsSince accepts RFC3339 time or duration (e.g. 10m) counted back from now
+func parseLogsSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if since, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return since, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil && duration > 0 {
+		return now.Add(-duration), nil
+	}
+	return time.Time{}, fmt.Errorf("since has to be RFC3339 time or positive duration, got %q", value)
+}
+
+// getLogsFormat uses format query parameter and falls back to Accept header
+func getLogsFormat(req *web.Request, follow bool) (string, error) {
+	format := commonHttp.GetQueryParameterCaseInsensitive(req, "format")
+	if format == "" {
+		accept := req.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, contentTypeEventStream):
+			format = logsFormatSSE
+		case strings.Contains(accept, "text/plain"):
+			format = logsFormatText
+		case follow:
+			format = logsFormatText
+		default:
+			format = logsFormatJson
+		}
+	}
+
+	switch format {
+	case logsFormatJson:
+		if follow {
+			return "", fmt.Errorf("followed logs can be sent as %s or %s only", logsFormatText, logsFormatSSE)
+		}
+	case logsFormatText, logsFormatSSE:
+	default:
+		return "", fmt.Errorf("unsupported format %q, allowed formats: %s, %s, %s", format, logsFormatJson, logsFormatText, logsFormatSSE)
+	}
+	return format, nil
+}
+
+// splitLogLines returns complete lines and not yet finished last line
+func splitLogLines(logs string) ([]string, string) {
+	lines := strings.Split(logs, "\n")
+	return lines[:len(lines)-1], lines[len(lines)-1]
+}
+
+func getLogLineTime(line string) (time.Time, bool) {
+	field := strings.SplitN(line, " ", 2)[0]
+	timestamp, err := time.Parse(time.RFC3339Nano, field)
+	return timestamp, err == nil
+}
+
+func hasLogLineTime(logs string) bool {
+	for _, line := range strings.Split(logs, "\n") {
+		if _, ok := getLogLineTime(line); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// checkLogTimestamps rejects since and ordering of merged logs when selected containers log lines without
+// leading RFC3339 timestamp, as lines could be neither filtered nor ordered by time then
+func (q logsQuery) checkLogTimestamps(logs map[string]string) error {
+	if q.since.IsZero() && !q.merge {
+		return nil
+	}
+	containers, err := q.selectContainers(logs)
+	if err != nil {
+		// missing container is reported by filtering
+		return nil
+	}
+	if q.since.IsZero() && len(containers) < 2 {
+		return nil
+	}
+
+	for _, container := range containers {
+		if strings.TrimSpace(logs[container]) != "" && !hasLogLineTime(logs[container]) {
+			if !q.since.IsZero() {
+				return fmt.Errorf("since cannot be applied, lines of container %s do not start with RFC3339 timestamp", container)
+			}
+			return fmt.Errorf("logs cannot be merged by time, lines of container %s do not start with RFC3339 timestamp", container)
+		}
+	}
+	return nil
+}
+
+// filterLogLines applies since, grep and tail. Lines without leading timestamp belong to previous line,
+// so multi-line messages are not split by since.
+func (q logsQuery) filterLogLines(lines []string) []string {
+	result := []string{}
+	afterSince := true
+	for _, line := range lines {
+		if !q.since.IsZero() {
+			if timestamp, ok := getLogLineTime(line); ok {
+				afterSince = !timestamp.Before(q.since)
+			}
+			if !afterSince {
+				continue
+			}
+		}
+		if q.grep != nil && !q.grep.MatchString(line) {
+			continue
+		}
+		result = append(result, line)
+	}
+
+	if q.tailSet && len(result) > q.tail {
+		result = result[len(result)-q.tail:]
+	}
+	return result
+}
+
+func (q logsQuery) selectContainers(logs map[string]string) ([]string, error) {
+	if q.container != "" {
+		if _, found := logs[q.container]; !found {
+			return nil, fmt.Errorf("container %q not found, available containers: %s", q.container, strings.Join(getSortedContainers(logs), ", "))
+		}
+		return []string{q.container}, nil
+	}
+	return getSortedContainers(logs), nil
+}
+
+func getSortedContainers(logs map[string]string) []string {
+	containers := []string{}
+	for container := range logs {
+		containers = append(containers, container)
+	}
+	sort.Strings(containers)
+	return containers
+}
+
+func (q logsQuery) filterLogs(logs map[string]string) (map[string][]string, []string, error) {
+	containers, err := q.selectContainers(logs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := map[string][]string{}
+	for _, container := range containers {
+		lines, lastLine := splitLogLines(logs[container])
+		if lastLine != "" {
+			lines = append(lines, lastLine)
+		}
+		result[container] = q.filterLogLines(lines)
+	}
+	return result, containers, nil
+}
+
+// toLogLines returns lines of sources in order of sources, or ordered by time when logs are merged.
+// Line without timestamp gets time of previous line of the same source.
+func (q logsQuery) toLogLines(filtered map[string][]string, sources []string) []models.LogLine {
+	type timedLogLine struct {
+		time time.Time
+		line models.LogLine
+	}
+
+	timedLines := []timedLogLine{}
+	for _, source := range sources {
+		var lineTime time.Time
+		for _, line := range filtered[source] {
+			if timestamp, ok := getLogLineTime(line); ok {
+				lineTime = timestamp
+			}
+			logLine := models.LogLine{Container: source, Line: line}
+			if q.merge {
+				logLine.Instance, logLine.Container = splitMergedLogsSource(source)
+			}
+			timedLines = append(timedLines, timedLogLine{time: lineTime, line: logLine})
+		}
+	}
+
+	if q.merge {
+		sort.SliceStable(timedLines, func(i, j int) bool {
+			return timedLines[i].time.Before(timedLines[j].time)
+		})
+	}
+
+	result := []models.LogLine{}
+	for _, timedLine := range timedLines {
+		result = append(result, timedLine.line)
+	}
+	return result
+}
+
+// getLogLines returns filtered lines, for merged logs tail is applied to whole stream
+func (q logsQuery) getLogLines(logs map[string]string) ([]models.LogLine, []string, error) {
+	sourcesQuery := q
+	if q.merge {
+		sourcesQuery.tailSet = false
+	}
+
+	filtered, sources, err := sourcesQuery.filterLogs(logs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	lines := q.toLogLines(filtered, sources)
+	if q.merge && q.tailSet && len(lines) > q.tail {
+		lines = lines[len(lines)-q.tail:]
+	}
+	return lines, sources, nil
+}
+
+func splitMergedLogsSource(source string) (string, string) {
+	parts := strings.SplitN(source, mergedLogsSeparator, 2)
+	if len(parts) < 2 {
+		return "", source
+	}
+	return parts[0], parts[1]
+}
+
+// getInstanceWithBindings returns instance and all instances it is bound to, directly or through other instances
+func getInstanceWithBindings(instanceId string) ([]catalogModels.Instance, int, error) {
+	instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		return nil, status, fmt.Errorf("cannot fetch instance %s from Catalog: %v", instanceId, err)
+	}
+
+	result := []catalogModels.Instance{instance}
+	visited := map[string]bool{instance.Id: true}
+	for i := 0; i < len(result); i++ {
+		boundInstances, status, err := BrokerConfig.CatalogApi.GetInstanceBindings(result[i].Id)
+		if err != nil {
+			return nil, status, fmt.Errorf("cannot fetch instance %s bindings from Catalog: %v", result[i].Id, err)
+		}
+		for _, boundInstance := range boundInstances {
+			if !visited[boundInstance.Id] {
+				visited[boundInstance.Id] = true
+				result = append(result, boundInstance)
+			}
+		}
+	}
+	return result, http.StatusOK, nil
+}
+
+// mergedLogsFetcher returns logs of all instances with containers prefixed by instance name.
+// Logs of first instance are required, bound instances without logs are skipped.
+func mergedLogsFetcher(instances []catalogModels.Instance) logsFetcher {
+	return func() (map[string]string, int, error) {
+		result := map[string]string{}
+		for i, instance := range instances {
+			logs, status, err := BrokerConfig.ContainerBrokerApi.GetInstanceLogs(instance.Id)
+			if err != nil {
+				if i == 0 {
+					return nil, status, fmt.Errorf("cannot fetch instance %s logs from Container Broker: %v", instance.Id, err)
+				}
+				logger.Warningf("Cannot fetch logs of bound instance %s: %v", instance.Id, err)
+				continue
+			}
+			for container, containerLogs := range logs {
+				result[instance.Name+mergedLogsSeparator+container] = containerLogs
+			}
+		}
+		return result, http.StatusOK, nil
+	}
+}
+
+// respondWithLogs writes logs of instance in format requested by query parameters
+func respondWithLogs(rw web.ResponseWriter, req *web.Request, instanceId string, merge bool, fetch logsFetcher) {
+	query, err := parseLogsQuery(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	query.merge = merge
+
+	logs, status, err := fetch()
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	if err = query.checkLogTimestamps(logs); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	if query.follow {
+		followLogs(rw, req, query, logs, fetch)
+		return
+	}
+
+	if !query.hasFilters() && !query.merge && query.format == logsFormatJson {
+		commonHttp.WriteJson(rw, logs, status)
+		return
+	}
+
+	if query.format == logsFormatJson && !query.merge {
+		filtered, _, err := query.filterLogs(logs)
+		if err != nil {
+			commonHttp.Respond404(rw, err)
+			return
+		}
+		result := map[string]string{}
+		for container, lines := range filtered {
+			result[container] = strings.Join(lines, "\n")
+		}
+		commonHttp.WriteJson(rw, result, http.StatusOK)
+		return
+	}
+
+	lines, sources, err := query.getLogLines(logs)
+	if err != nil {
+		commonHttp.Respond404(rw, err)
+		return
+	}
+
+	switch query.format {
+	case logsFormatJson:
+		commonHttp.WriteJson(rw, lines, http.StatusOK)
+	case logsFormatText:
+		rw.Header().Set("Content-Type", contentTypeTextPlain)
+		rw.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", instanceId+"-logs.txt"))
+		rw.WriteHeader(http.StatusOK)
+		writeLogLines(rw, query.format, lines, query.merge || len(sources) > 1)
+	case logsFormatSSE:
+		rw.Header().Set("Content-Type", contentTypeEventStream)
+		rw.WriteHeader(http.StatusOK)
+		writeLogLines(rw, query.format, lines, true)
+	}
+}
+
+// writeLogLines writes lines as plain text, prefixed with their source if needed, or as server-sent events
+func writeLogLines(rw web.ResponseWriter, format string, lines []models.LogLine, withSource bool) {
+	for _, line := range lines {
+		switch format {
+		case logsFormatSSE:
+			data, err := json.Marshal(line)
+			if err != nil {
+				logger.Error("Cannot marshal log line: ", err)
+				continue
+			}
+			fmt.Fprintf(rw, "data: %s\n\n", data)
+		default:
+			if !withSource {
+				fmt.Fprintln(rw, line.Line)
+			} else if line.Instance != "" {
+				fmt.Fprintf(rw, "[%s%s%s] %s\n", line.Instance, mergedLogsSeparator, line.Container, line.Line)
+			} else {
+				fmt.Fprintf(rw, "[%s] %s\n", line.Container, line.Line)
+			}
+		}
+	}
+}
+
+// followLogs sends filtered logs and then new lines until client disconnects or timeout is reached.
+// Tail and since are applied to logs present when request was made only.
+func followLogs(rw web.ResponseWriter, req *web.Request, query logsQuery, logs map[string]string, fetch logsFetcher) {
+	lines, sources, err := query.getLogLines(logs)
+	if err != nil {
+		commonHttp.Respond404(rw, err)
+		return
+	}
+
+	if query.format == logsFormatSSE {
+		rw.Header().Set("Content-Type", contentTypeEventStream)
+	} else {
+		rw.Header().Set("Content-Type", contentTypeTextPlain)
+	}
+	rw.WriteHeader(http.StatusOK)
+
+	withSource := query.format == logsFormatSSE || query.merge || len(sources) > 1
+	writeLogLines(rw, query.format, lines, withSource)
+	rw.Flush()
+
+	seenLines := map[string]int{}
+	for _, source := range sources {
+		sourceLines, _ := splitLogLines(logs[source])
+		seenLines[source] = len(sourceLines)
+	}
+
+	newLinesQuery := logsQuery{container: query.container, grep: query.grep, merge: query.merge}
+	timeout, _ := util.GetUint32EnvValueOrDefault(LogsFollowTimeout, LogsFollowTimeoutDefault)
+	deadline := time.After(time.Duration(timeout) * time.Second)
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-deadline:
+			return
+		case <-time.After(logsFollowPollInterval):
+		}
+
+		logs, _, err := fetch()
+		if err != nil {
+			logger.Warning("Cannot fetch followed logs: ", err)
+			continue
+		}
+		sources, err := newLinesQuery.selectContainers(logs)
+		if err != nil {
+			continue
+		}
+
+		newLines := map[string][]string{}
+		for _, source := range sources {
+			sourceLines, _ := splitLogLines(logs[source])
+			// container was restarted, so its logs start from the beginning
+			if len(sourceLines) < seenLines[source] {
+				seenLines[source] = 0
+			}
+			newLines[source] = newLinesQuery.filterLogLines(sourceLines[seenLines[source]:])
+			seenLines[source] = len(sourceLines)
+		}
+		writeLogLines(rw, query.format, newLinesQuery.toLogLines(newLines, sources), withSource)
+		rw.Flush()
+	}
+}
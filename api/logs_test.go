@@ -0,0 +1,257 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+const testLogs = "2017-05-10T10:00:00Z starting\n" +
+	"2017-05-10T10:01:00Z ERROR cannot connect\n" +
+	"  at connect()\n" +
+	"2017-05-10T10:02:00Z connected\n"
+
+func TestFilterLogLines(t *testing.T) {
+	lines, _ := splitLogLines(testLogs)
+	since, _ := time.Parse(time.RFC3339, "2017-05-10T10:01:00Z")
+
+	testCases := []struct {
+		query    logsQuery
+		expected []string
+	}{
+		{logsQuery{}, lines},
+		{logsQuery{tail: 2, tailSet: true}, lines[2:]},
+		{logsQuery{tail: 0, tailSet: true}, []string{}},
+		{logsQuery{since: since}, lines[1:]},
+		{logsQuery{grep: regexp.MustCompile("ERROR|connected")}, []string{lines[1], lines[3]}},
+		{logsQuery{since: since, grep: regexp.MustCompile("connect"), tail: 1, tailSet: true}, lines[3:]},
+	}
+
+	Convey("For set of test cases filterLogLines should return proper lines", t, func() {
+		for i, tc := range testCases {
+			Convey(fmt.Sprintf("For test case %d", i), func() {
+				So(tc.query.filterLogLines(lines), ShouldResemble, tc.expected)
+			})
+		}
+	})
+}
+
+func TestCheckLogTimestamps(t *testing.T) {
+	since, _ := time.Parse(time.RFC3339, "2017-05-10T10:01:00Z")
+	logs := map[string]string{"app": testLogs, "sidecar": "sidecar started\n", "idle": ""}
+
+	Convey("Test checking timestamps of logs", t, func() {
+		Convey("since should be accepted for timestamped container only", func() {
+			So(logsQuery{since: since, container: "app"}.checkLogTimestamps(logs), ShouldBeNil)
+			So(logsQuery{since: since, container: "idle"}.checkLogTimestamps(logs), ShouldBeNil)
+			So(logsQuery{since: since}.checkLogTimestamps(logs), ShouldNotBeNil)
+		})
+
+		Convey("merged logs should require timestamps only if there is more than one container to order", func() {
+			So(logsQuery{merge: true, container: "sidecar"}.checkLogTimestamps(logs), ShouldBeNil)
+			So(logsQuery{merge: true}.checkLogTimestamps(logs), ShouldNotBeNil)
+		})
+
+		Convey("logs without since and merge should not be checked", func() {
+			So(logsQuery{}.checkLogTimestamps(logs), ShouldBeNil)
+		})
+	})
+}
+
+func TestParseLogsSince(t *testing.T) {
+	now := time.Now()
+
+	Convey("Test parsing since parameter", t, func() {
+		Convey("duration should be counted back from now", func() {
+			since, err := parseLogsSince("10m", now)
+			So(err, ShouldBeNil)
+			So(since, ShouldResemble, now.Add(-10*time.Minute))
+		})
+
+		Convey("RFC3339 time should be accepted", func() {
+			since, err := parseLogsSince("2017-05-10T10:00:00Z", now)
+			So(err, ShouldBeNil)
+			So(since.Hour(), ShouldEqual, 10)
+		})
+
+		Convey("invalid value should be rejected", func() {
+			_, err := parseLogsSince("yesterday", now)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestGetServiceInstanceLogs(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	logsURL := fmt.Sprintf("/api/%s/services/%s/logs", apiPrefix, serviceID1)
+	logs := map[string]string{"app": testLogs, "sidecar": "sidecar started\n"}
+
+	Convey("Test /services/:serviceId/logs", t, func() {
+		Convey("When no query parameters are sent", func() {
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+
+			response := SendGet(logsURL, mocksAndRouter.router)
+
+			Convey("logs should be returned unchanged", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := map[string]string{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldResemble, logs)
+			})
+		})
+
+		Convey("When container and tail are sent", func() {
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+
+			response := SendGet(logsURL+"?container=app&tail=1", mocksAndRouter.router)
+
+			Convey("last line of container should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := map[string]string{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldResemble, map[string]string{"app": "2017-05-10T10:02:00Z connected"})
+			})
+		})
+
+		Convey("When text format is requested", func() {
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+
+			response := SendGet(logsURL+"?format=text&grep=started", mocksAndRouter.router)
+
+			Convey("matching lines prefixed with container should be sent as attachment", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Header().Get("Content-Disposition"), ShouldContainSubstring, "attachment")
+				So(response.Body.String(), ShouldEqual, "[sidecar] sidecar started\n")
+			})
+		})
+
+		Convey("When unknown container is requested", func() {
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+
+			response := SendGet(logsURL+"?container=db", mocksAndRouter.router)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When since is sent for container logging without timestamps", func() {
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+
+			response := SendGet(logsURL+"?since=10m", mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+				So(response.Body.String(), ShouldContainSubstring, "sidecar")
+			})
+		})
+
+		Convey("When grep expression is invalid", func() {
+			response := SendGet(logsURL+"?grep=(", mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When logs are followed", func() {
+			os.Setenv(LogsFollowTimeout, "1")
+			logsFollowPollInterval = 300 * time.Millisecond
+
+			newLogs := map[string]string{"app": testLogs + "2017-05-10T10:03:00Z new line\n", "sidecar": logs["sidecar"]}
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(logs, http.StatusOK, nil)
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(serviceID1).Return(newLogs, http.StatusOK, nil).AnyTimes()
+
+			response := SendGet(logsURL+"?container=app&tail=0&follow=true&format=sse", mocksAndRouter.router)
+
+			Convey("only new lines should be sent as events", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Body.String(), ShouldEqual, `data: {"container":"app","line":"2017-05-10T10:03:00Z new line"}`+"\n\n")
+			})
+
+			Reset(func() {
+				os.Unsetenv(LogsFollowTimeout)
+				logsFollowPollInterval = 2 * time.Second
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestGetApplicationInstanceLogsWithBindings(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	logsURL := fmt.Sprintf("/api/%s/applications/%s/logs?includeBindings=true", apiPrefix, applicationID1)
+
+	Convey("Test /applications/:applicationId/logs with bindings included", t, func() {
+		applicationInstance := catalogModels.Instance{Id: instanceID1, Name: instanceName1}
+		boundInstance := catalogModels.Instance{Id: instanceID2, Name: instanceName2}
+		gomock.InOrder(
+			mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+				Return([]catalogModels.Instance{applicationInstance}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(applicationInstance, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstanceBindings(instanceID1).
+				Return([]catalogModels.Instance{boundInstance}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstanceBindings(instanceID2).
+				Return([]catalogModels.Instance{applicationInstance}, http.StatusOK, nil),
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(instanceID1).
+				Return(map[string]string{"app": testLogs}, http.StatusOK, nil),
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceLogs(instanceID2).
+				Return(map[string]string{"db": "2017-05-10T10:01:30Z db ready\n"}, http.StatusOK, nil),
+		)
+
+		Convey("When logs are requested", func() {
+			response := SendGet(logsURL, mocksAndRouter.router)
+
+			Convey("lines of all instances should be merged in time order", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.LogLine{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 5)
+				So(result[2].Line, ShouldEqual, "  at connect()")
+				So(result[3], ShouldResemble, models.LogLine{Instance: instanceName2, Container: "db", Line: "2017-05-10T10:01:30Z db ready"})
+			})
+		})
+
+		Convey("When logs are requested as text with tail", func() {
+			response := SendGet(logsURL+"&format=text&tail=2", mocksAndRouter.router)
+
+			Convey("last lines of merged stream should be tagged with instance and container", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(response.Body.String(), ShouldEqual, fmt.Sprintf("[%s/db] 2017-05-10T10:01:30Z db ready\n[%s/app] 2017-05-10T10:02:00Z connected\n",
+					instanceName2, instanceName1))
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,202 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+
+	"github.com/gocraft/web"
+	"gopkg.in/yaml.v2"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+const (
+	manifestFormField    = "manifest"
+	defaultBlobFormField = "blob"
+	manifestEnvField     = "env"
+)
+
+var errSingleApplicationManifestRequired = errors.New("manifest has to describe single application")
+
+// decodeManifestDocument accepts JSON and YAML manifests. YAML is converted to JSON first,
+// so both formats share field names and unknown fields are rejected in both of them.
+func decodeManifestDocument(content []byte) (models.ManifestDocument, error) {
+	document := models.ManifestDocument{}
+
+	trimmed := bytes.TrimSpace(content)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		var parsed interface{}
+		if err := yaml.UnmarshalStrict(content, &parsed); err != nil {
+			return document, fmt.Errorf("invalid YAML: %v", err)
+		}
+		converted, err := convertYamlToJsonValue(parsed, false)
+		if err != nil {
+			return document, err
+		}
+		if trimmed, err = json.Marshal(converted); err != nil {
+			return document, err
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&document); err != nil {
+		return document, err
+	}
+	return document, nil
+}
+
+// convertYamlToJsonValue replaces YAML maps with JSON objects. Scalars of env are turned into strings,
+// as in Cloud Foundry manifests values like PORT: 8080 are allowed.
+func convertYamlToJsonValue(value interface{}, stringify bool) (interface{}, error) {
+	switch typed := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, item := range typed {
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid YAML: key %v is not a string", key)
+			}
+			converted, err := convertYamlToJsonValue(item, stringify || name == manifestEnvField)
+			if err != nil {
+				return nil, err
+			}
+			result[name] = converted
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(typed))
+		for i, item := range typed {
+			converted, err := convertYamlToJsonValue(item, false)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = converted
+		}
+		return result, nil
+	case nil:
+		return nil, nil
+	default:
+		if stringify {
+			return fmt.Sprint(typed), nil
+		}
+		return typed, nil
+	}
+}
+
+// getManifestsFromDocument returns single manifest or manifests listed under "applications" key
+func getManifestsFromDocument(document models.ManifestDocument) ([]*models.Manifest, error) {
+	if document.Applications == nil {
+		return []*models.Manifest{&document.Manifest}, nil
+	}
+	if !reflect.DeepEqual(document.Manifest, models.Manifest{}) {
+		return nil, errors.New("applications list cannot be combined with top level application fields")
+	}
+	if len(document.Applications) == 0 {
+		return nil, errors.New("applications list cannot be empty")
+	}
+
+	manifests := []*models.Manifest{}
+	for i := range document.Applications {
+		manifests = append(manifests, &document.Applications[i])
+	}
+	return manifests, nil
+}
+
+func getManifestBlobField(manifest *models.Manifest) string {
+	if manifest.Blob != "" {
+		return manifest.Blob
+	}
+	return defaultBlobFormField
+}
+
+// parseManifests returns applications described by manifest form file and reports if it was a list
+func (c *Context) parseManifests(req *web.Request) ([]*models.Manifest, bool, error) {
+	content, err := c.readFormFile(req, manifestFormField)
+	if err != nil {
+		logger.Debug("readFormFile failed!")
+		return nil, false, err
+	}
+
+	document, err := decodeManifestDocument(content)
+	if err != nil {
+		logger.Debug("decodeManifestDocument failed!")
+		return nil, false, err
+	}
+
+	manifests, err := getManifestsFromDocument(document)
+	if err != nil {
+		return nil, false, err
+	}
+	logger.Debugf("read manifests: %+v\n", manifests)
+	return manifests, document.Applications != nil, nil
+}
+
+func (c *Context) getValidatedParsedManifests(req *web.Request) ([]*models.Manifest, bool, error) {
+	manifests, isList, err := c.parseManifests(req)
+	if err != nil {
+		logger.Debug("parseManifests failed!")
+		return nil, false, err
+	}
+
+	names := map[string]bool{}
+	blobFields := map[string]bool{}
+	for _, manifest := range manifests {
+		if err = c.validateManifest(manifest); err != nil {
+			if isList {
+				return nil, false, fmt.Errorf("application %q: %v", manifest.Name, err)
+			}
+			return nil, false, err
+		}
+		if names[manifest.Name] {
+			return nil, false, fmt.Errorf("application name %q is used more than once", manifest.Name)
+		}
+		names[manifest.Name] = true
+
+		blobField := getManifestBlobField(manifest)
+		if blobField == manifestFormField {
+			return nil, false, fmt.Errorf("%q cannot be used as blob form field", manifestFormField)
+		}
+		if blobFields[blobField] {
+			return nil, false, fmt.Errorf("blob form field %q is used by more than one application", blobField)
+		}
+		blobFields[blobField] = true
+	}
+	return manifests, isList, nil
+}
+
+// applicationsStateCondition is met when all applications reach one of target states
+func applicationsStateCondition(applicationIds []string, targetStates ...catalogModels.InstanceState) waitCondition {
+	return func() (interface{}, bool, int, error) {
+		applications := []interface{}{}
+		for _, applicationId := range applicationIds {
+			application, done, status, err := applicationStateCondition(applicationId, targetStates...)()
+			if err != nil || !done {
+				return nil, false, status, err
+			}
+			applications = append(applications, application)
+		}
+		return applications, true, http.StatusOK, nil
+	}
+}
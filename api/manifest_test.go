@@ -0,0 +1,195 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	containerBrokerModels "github.com/trustedanalytics-ng/tap-container-broker/models"
+)
+
+const multiApplicationYamlManifest = `
+applications:
+- name: frontend
+  type: PYTHON2.7
+  instances: 2
+  blob: frontendBlob
+  env:
+    PORT: 8080
+    DEBUG: true
+- name: backend
+  type: PYTHON2.7
+  instances: 1
+  blob: backendBlob
+  memory: 512MB
+`
+
+func TestDecodeManifestDocument(t *testing.T) {
+	Convey("Test decoding manifests", t, func() {
+		Convey("JSON manifest should be decoded as single application", func() {
+			document, err := decodeManifestDocument([]byte(`{"name": "app", "type": "GO", "instances": 1, "env": {"KEY": "value"}}`))
+			So(err, ShouldBeNil)
+
+			manifests, err := getManifestsFromDocument(document)
+			So(err, ShouldBeNil)
+			So(manifests, ShouldHaveLength, 1)
+			So(manifests[0].Name, ShouldEqual, "app")
+			So(manifests[0].Env, ShouldResemble, map[string]string{"KEY": "value"})
+		})
+
+		Convey("YAML manifest with applications list should be decoded", func() {
+			document, err := decodeManifestDocument([]byte(multiApplicationYamlManifest))
+			So(err, ShouldBeNil)
+
+			manifests, err := getManifestsFromDocument(document)
+			So(err, ShouldBeNil)
+			So(manifests, ShouldHaveLength, 2)
+			So(manifests[0].Name, ShouldEqual, "frontend")
+			So(manifests[0].ImageType, ShouldEqual, catalogModels.ImageType("PYTHON2.7"))
+			So(manifests[0].Instances, ShouldEqual, 2)
+			So(manifests[0].Env, ShouldResemble, map[string]string{"PORT": "8080", "DEBUG": "true"})
+			So(getManifestBlobField(manifests[0]), ShouldEqual, "frontendBlob")
+			So(manifests[1].Memory, ShouldEqual, "512MB")
+		})
+
+		Convey("Unknown field should be rejected in JSON", func() {
+			_, err := decodeManifestDocument([]byte(`{"name": "app", "type": "GO", "instnaces": 1}`))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Unknown field should be rejected in YAML", func() {
+			_, err := decodeManifestDocument([]byte("name: app\ntype: GO\nservices: [db]\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Duplicated key should be rejected in YAML", func() {
+			_, err := decodeManifestDocument([]byte("name: app\nname: other\n"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Applications list combined with top level fields should be rejected", func() {
+			document, err := decodeManifestDocument([]byte("name: app\napplications:\n- name: other\n"))
+			So(err, ShouldBeNil)
+
+			_, err = getManifestsFromDocument(document)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func prepareMultiApplicationForm(manifest string, blobFields ...string) (*bytes.Buffer, string) {
+	bodyBuf := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(bodyBuf)
+
+	for _, field := range blobFields {
+		fileWriter, err := bodyWriter.CreateFormFile(field, field+".tar.gz")
+		checkTestingError(err)
+		fh, err := os.Open(fmt.Sprintf("%s/%s/%s", testDataDirPath, testApplicationsDir, blobFilename))
+		checkTestingError(err)
+		io.Copy(fileWriter, fh)
+		fh.Close()
+	}
+
+	fileWriter, err := bodyWriter.CreateFormFile(manifestFormField, "manifest.yml")
+	checkTestingError(err)
+	fileWriter.Write([]byte(manifest))
+
+	contentType := bodyWriter.FormDataContentType()
+	bodyWriter.Close()
+	return bodyBuf, contentType
+}
+
+func TestCreateApplicationsFromManifestList(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	applicationsURL := fmt.Sprintf("/api/%s/applications", apiPrefix)
+
+	Convey("Test creating applications from YAML manifest with applications list", t, func() {
+		mocksAndRouter.containerBrokerApiMock.EXPECT().GetVersions().
+			Return([]containerBrokerModels.VersionsResponse{}, http.StatusOK, nil).AnyTimes()
+
+		Convey("When blobs of all applications are sent", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return([]catalogModels.Instance{}, http.StatusOK, nil).Times(2)
+			for _, name := range []string{"frontend", "backend"} {
+				application := catalogModels.Application{Id: name + "-id", Name: name}
+				imageId := catalogModels.GenerateImageId(application.Id)
+				gomock.InOrder(
+					mocksAndRouter.catalogApiMock.EXPECT().AddApplication(applicationWithName(name)).Return(application, http.StatusCreated, nil),
+					mocksAndRouter.catalogApiMock.EXPECT().AddImage(gomock.Any()).Return(catalogModels.Image{}, http.StatusCreated, nil),
+					mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(application.Id, gomock.Any()).Return(application, http.StatusOK, nil),
+					mocksAndRouter.blobStoreApiMock.EXPECT().StoreBlob(imageId, gomock.Any()).Return(nil),
+					mocksAndRouter.catalogApiMock.EXPECT().UpdateImage(imageId, gomock.Any()).Return(catalogModels.Image{}, http.StatusOK, nil),
+				)
+			}
+
+			bodyBuf, contentType := prepareMultiApplicationForm(multiApplicationYamlManifest, "frontendBlob", "backendBlob")
+			response := SendForm(applicationsURL, bodyBuf, contentType, mocksAndRouter.router)
+
+			Convey("both applications should be created, each with its own operation", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				result := []models.CreatedApplication{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 2)
+				So(result[0].Application.Name, ShouldEqual, "frontend")
+				So(result[0].OperationId, ShouldNotBeEmpty)
+				So(result[1].Application.Name, ShouldEqual, "backend")
+				So(result[1].OperationId, ShouldNotEqual, result[0].OperationId)
+			})
+		})
+
+		Convey("When two applications use the same blob field", func() {
+			manifest := "applications:\n- name: a\n  type: GO\n  instances: 1\n- name: b\n  type: GO\n  instances: 1\n"
+			bodyBuf, contentType := prepareMultiApplicationForm(manifest, defaultBlobFormField)
+			response := SendForm(applicationsURL, bodyBuf, contentType, mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+type applicationNameMatcher struct {
+	name string
+}
+
+func applicationWithName(name string) gomock.Matcher {
+	return applicationNameMatcher{name: name}
+}
+
+func (m applicationNameMatcher) Matches(x interface{}) bool {
+	application, ok := x.(catalogModels.Application)
+	return ok && application.Name == m.name
+}
+
+func (m applicationNameMatcher) String() string {
+	return fmt.Sprintf("is application named %q", m.name)
+}
@@ -0,0 +1,424 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	userManagement "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+const (
+	MetricsCollectionInterval        = "METRICS_COLLECTION_INTERVAL"
+	MetricsCollectionIntervalDefault = 60 // 1min
+	MetricsHistorySize               = "METRICS_HISTORY_SIZE"
+	MetricsHistorySizeDefault        = 24 * 60
+
+	organizationStatusActive = "ACTIVE"
+)
+
+var errMetricNameMissing = errors.New("metric query parameter is required")
+
+type metricsHistory struct {
+	mutex   sync.RWMutex
+	samples []models.PlatformMetrics
+}
+
+var platformMetricsHistory = &metricsHistory{}
+
+func (h *metricsHistory) add(sample models.PlatformMetrics) {
+	historySize, _ := util.GetUint32EnvValueOrDefault(MetricsHistorySize, MetricsHistorySizeDefault)
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.samples = append(h.samples, sample)
+	if overflow := len(h.samples) - int(historySize); overflow > 0 {
+		h.samples = h.samples[overflow:]
+	}
+}
+
+func (h *metricsHistory) between(from, to int64) []models.PlatformMetrics {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	result := []models.PlatformMetrics{}
+	for _, sample := range h.samples {
+		if sample.Timestamp >= from && sample.Timestamp <= to {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+func (h *metricsHistory) latest() (models.PlatformMetrics, bool) {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	if len(h.samples) == 0 {
+		return models.PlatformMetrics{}, false
+	}
+	return h.samples[len(h.samples)-1], true
+}
+
+// CollectMetricsPeriodically gathers platform metrics every METRICS_COLLECTION_INTERVAL seconds
+// and keeps the last METRICS_HISTORY_SIZE samples in memory. It never returns.
+func CollectMetricsPeriodically() {
+	interval, _ := util.GetUint32EnvValueOrDefault(MetricsCollectionInterval, MetricsCollectionIntervalDefault)
+	for {
+		if _, err := collectPlatformMetrics(); err != nil {
+			logger.Warning("Cannot collect platform metrics: ", err)
+		}
+		time.Sleep(time.Duration(interval) * time.Second)
+	}
+}
+
+func collectPlatformMetrics() (models.PlatformMetrics, error) {
+	metrics, err := gatherPlatformMetrics()
+	if err != nil {
+		return metrics, err
+	}
+	platformMetricsHistory.add(metrics)
+	return metrics, nil
+}
+
+func gatherPlatformMetrics() (models.PlatformMetrics, error) {
+	metrics := models.PlatformMetrics{
+		Timestamp:                   time.Now().Unix(),
+		ServiceInstancesPerOffering: make(map[string]int),
+		InstanceStates:              make(map[string]int),
+		ApplicationStates:           make(map[string]int),
+		ImageStates:                 make(map[string]int),
+		Organizations:               make(map[string]*models.OrganizationUsage),
+	}
+
+	instances, _, err := BrokerConfig.CatalogApi.ListInstances()
+	if err != nil {
+		return metrics, fmt.Errorf("cannot fetch instances from Catalog: %v", err)
+	}
+
+	applications, _, err := BrokerConfig.CatalogApi.ListApplications(&commonHttp.ItemFilter{})
+	if err != nil {
+		return metrics, fmt.Errorf("cannot fetch applications from Catalog: %v", err)
+	}
+
+	images, _, err := BrokerConfig.CatalogApi.ListImages()
+	if err != nil {
+		return metrics, fmt.Errorf("cannot fetch images from Catalog: %v", err)
+	}
+
+	services, _, err := BrokerConfig.CatalogApi.GetServices()
+	if err != nil {
+		return metrics, fmt.Errorf("cannot fetch services from Catalog: %v", err)
+	}
+
+	offeringNames := make(map[string]string)
+	for _, service := range services {
+		offeringNames[service.Id] = service.Name
+	}
+
+	metrics.ApplicationsCount = len(applications)
+	applicationOrganizations := make(map[string]string)
+	for _, application := range applications {
+		memoryPerReplica, err := getApplicationMemoryPerReplicaInMB(application.Metadata)
+		if err != nil {
+			return metrics, err
+		}
+		metrics.Replicas += application.Replication
+		metrics.MemoryUsage += application.Replication * memoryPerReplica
+
+		orgId := catalogModels.GetValueFromMetadata(application.Metadata, organizationMetadataKey)
+		applicationOrganizations[application.Id] = orgId
+		getOrganizationUsage(&metrics, orgId).MemoryUsage += application.Replication * memoryPerReplica
+	}
+
+	for _, instance := range instances {
+		metrics.InstanceStates[instance.State.String()]++
+		if instance.Type == catalogModels.InstanceTypeApplication {
+			metrics.ApplicationStates[instance.State.String()]++
+			getOrganizationUsage(&metrics, applicationOrganizations[instance.ClassId]).ApplicationStates[instance.State.String()]++
+		}
+		if instance.Type == catalogModels.InstanceTypeService {
+			metrics.ServiceInstancesCount++
+			offeringName, found := offeringNames[instance.ClassId]
+			if !found {
+				offeringName = instance.ClassId
+			}
+			metrics.ServiceInstancesPerOffering[offeringName]++
+			getOrganizationUsage(&metrics, catalogModels.GetValueFromMetadata(instance.Metadata, organizationMetadataKey)).ServiceInstancesCount++
+		}
+	}
+
+	for _, image := range images {
+		metrics.ImageStates[string(image.State)]++
+	}
+	metrics.OrganizationsCount = countOrganizations(metrics.Organizations, os.Getenv("CORE_ORGANIZATION"))
+
+	if index, _, err := BrokerConfig.CatalogApi.GetLatestIndex(); err != nil {
+		logger.Warning("Cannot fetch latest index from Catalog: ", err)
+	} else {
+		metrics.LatestEvents = int(index.Latest)
+	}
+
+	if versions, _, err := BrokerConfig.ContainerBrokerApi.GetVersions(); err != nil {
+		logger.Warning("Cannot fetch platform versions from Container Broker: ", err)
+	} else {
+		metrics.Components = len(versions)
+	}
+
+	return metrics, nil
+}
+
+// countOrganizations counts core organization, which always exists and owns entities without organization,
+// and every other organization owning any application or service instance
+func countOrganizations(usage map[string]*models.OrganizationUsage, coreOrganization string) int {
+	count := 1
+	for orgId := range usage {
+		if orgId != "" && orgId != coreOrganization {
+			count++
+		}
+	}
+	return count
+}
+
+func getOrganizationUsage(metrics *models.PlatformMetrics, orgId string) *models.OrganizationUsage {
+	usage, found := metrics.Organizations[orgId]
+	if !found {
+		usage = &models.OrganizationUsage{ApplicationStates: make(map[string]int)}
+		metrics.Organizations[orgId] = usage
+	}
+	return usage
+}
+
+func getPlatformMetricsInRange(req *web.Request) ([]models.PlatformMetrics, int, error) {
+	from, to, err := parseMetricsTimeRange(req)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	interval, _ := util.GetUint32EnvValueOrDefault(MetricsCollectionInterval, MetricsCollectionIntervalDefault)
+	if latest, found := platformMetricsHistory.latest(); !found || latest.Timestamp < to-int64(interval) {
+		if _, err := collectPlatformMetrics(); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+	return platformMetricsHistory.between(from, to), http.StatusOK, nil
+}
+
+func parseMetricsTimeRange(req *web.Request) (int64, int64, error) {
+	now := time.Now().Unix()
+	from, err := parseMetricsTime(commonHttp.GetQueryParameterCaseInsensitive(req, "from"), now, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	to, err := parseMetricsTime(commonHttp.GetQueryParameterCaseInsensitive(req, "to"), now, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if from > to {
+		return 0, 0, fmt.Errorf("from (%d) cannot be later than to (%d)", from, to)
+	}
+	return from, to, nil
+}
+
+// negative value is added to current timestamp, as described in swagger
+func parseMetricsTime(value string, now, defaultValue int64) (int64, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp %q: %v", value, err)
+	}
+	if timestamp < 0 {
+		return now + timestamp, nil
+	}
+	return timestamp, nil
+}
+
+func parseMemoryInMB(memory string) (int, error) {
+	value := strings.ToUpper(strings.TrimSpace(memory))
+	multiplier := 1
+	switch {
+	case strings.HasSuffix(value, "GB"), strings.HasSuffix(value, "G"):
+		multiplier = 1024
+	case strings.HasSuffix(value, "MB"), strings.HasSuffix(value, "M"):
+	default:
+		return 0, fmt.Errorf("unsupported memory format: %q", memory)
+	}
+	number, err := strconv.Atoi(strings.TrimRight(value, "GMB"))
+	if err != nil {
+		return 0, fmt.Errorf("unsupported memory format: %q", memory)
+	}
+	return number * multiplier, nil
+}
+
+func (c *Context) GetPlatformMetrics(rw web.ResponseWriter, req *web.Request) {
+	metrics, status, err := getPlatformMetricsInRange(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, metrics, http.StatusOK)
+}
+
+func (c *Context) GetSingleMetric(rw web.ResponseWriter, req *web.Request) {
+	name := commonHttp.GetQueryParameterCaseInsensitive(req, "metric")
+	if name == "" {
+		commonHttp.Respond400(rw, errMetricNameMissing)
+		return
+	}
+
+	samples, status, err := getPlatformMetricsInRange(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	metric := models.Metric{Name: name, Values: []models.RawMetricValue{}}
+	for _, sample := range samples {
+		value, found, err := getMetricValue(sample, name)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return
+		}
+		if !found {
+			commonHttp.Respond404(rw, fmt.Errorf("unknown metric: %q", name))
+			return
+		}
+		metric.Values = append(metric.Values, models.RawMetricValue{
+			Timestamp: strconv.FormatInt(sample.Timestamp, 10),
+			Value:     value,
+		})
+	}
+	commonHttp.WriteJson(rw, []models.Metric{metric}, http.StatusOK)
+}
+
+func getMetricValue(sample models.PlatformMetrics, name string) (interface{}, bool, error) {
+	content, err := json.Marshal(sample)
+	if err != nil {
+		return nil, false, err
+	}
+	values := make(map[string]interface{})
+	if err = json.Unmarshal(content, &values); err != nil {
+		return nil, false, err
+	}
+	value, found := values[name]
+	return value, found, nil
+}
+
+func (c *Context) GetOrganizationMetrics(rw web.ResponseWriter, req *web.Request) {
+	orgId := req.PathParams["orgId"]
+	if status, err := c.checkOrganizationMembership(req, orgId); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	name, status, err := c.getOrganizationName(req, orgId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	samples, status, err := getPlatformMetricsInRange(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	usersCount := ""
+	if users, _, err := c.getOrganizationUsers(req, orgId); err != nil {
+		logger.Warning("Cannot fetch organization users from user-management: ", err)
+	} else {
+		usersCount = strconv.Itoa(len(users))
+	}
+
+	result := []models.OrganizationMetrics{}
+	for _, sample := range samples {
+		usage := c.getSampleOrganizationUsage(sample, orgId)
+		result = append(result, models.OrganizationMetrics{
+			Timestamp:                sample.Timestamp,
+			OrganizationId:           orgId,
+			Name:                     name,
+			Status:                   organizationStatusActive,
+			ApplicationsRunningCount: usage.ApplicationStates[catalogModels.InstanceStateRunning.String()],
+			ApplicationsFailedCount:  usage.ApplicationStates[catalogModels.InstanceStateFailure.String()],
+			ServicesCount:            usage.ServiceInstancesCount,
+			UsersCount:               usersCount,
+			MemoryUsage:              fmt.Sprintf("%dMB", usage.MemoryUsage),
+		})
+	}
+	commonHttp.WriteJson(rw, result, http.StatusOK)
+}
+
+// core organization is known by its name only, other organizations are looked up in user-management
+func (c *Context) getOrganizationName(req *web.Request, orgId string) (string, int, error) {
+	if orgId == c.CoreOrganization {
+		return c.CoreOrganization, http.StatusOK, nil
+	}
+
+	organizations, status, err := c.getCallerOrganizations(req)
+	if err != nil {
+		return "", status, err
+	}
+	for _, organization := range organizations {
+		if organization.Guid == orgId {
+			return organization.Name, http.StatusOK, nil
+		}
+	}
+	return "", http.StatusNotFound, fmt.Errorf("organization %q not found", orgId)
+}
+
+// users of core organization are served by user-management under its default organization
+func (c *Context) getOrganizationUsers(req *web.Request, orgId string) ([]userManagement.UaaUser, int, error) {
+	if orgId == c.CoreOrganization {
+		return getUserManagementApi(req).GetUsers()
+	}
+	return getUserManagementApi(req).GetOrganizationUsers(orgId)
+}
+
+// entities without organization belong to core organization
+func (c *Context) getSampleOrganizationUsage(sample models.PlatformMetrics, orgId string) models.OrganizationUsage {
+	result := models.OrganizationUsage{ApplicationStates: make(map[string]int)}
+	orgIds := []string{orgId}
+	if orgId == c.CoreOrganization {
+		orgIds = append(orgIds, "")
+	}
+	for _, id := range orgIds {
+		usage, found := sample.Organizations[id]
+		if !found {
+			continue
+		}
+		result.ServiceInstancesCount += usage.ServiceInstancesCount
+		result.MemoryUsage += usage.MemoryUsage
+		for state, count := range usage.ApplicationStates {
+			result.ApplicationStates[state] += count
+		}
+	}
+	return result
+}
@@ -0,0 +1,253 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	userManagement "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	containerBrokerModels "github.com/trustedanalytics-ng/tap-container-broker/models"
+)
+
+func TestGetPlatformMetrics(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	platformMetricsURL := fmt.Sprintf("/api/%s/metrics/platform", apiPrefix)
+
+	Convey(fmt.Sprintf("Test %s", platformMetricsURL), t, func() {
+		platformMetricsHistory = &metricsHistory{}
+
+		Convey("When Catalog returns instances, applications and images", func() {
+			instances := []catalogModels.Instance{
+				{Id: instanceID1, Type: catalogModels.InstanceTypeService, ClassId: serviceID1, State: catalogModels.InstanceStateRunning},
+				{Id: instanceID2, Type: catalogModels.InstanceTypeService, ClassId: serviceID1, State: catalogModels.InstanceStateFailure},
+				{Id: instanceID3, Type: catalogModels.InstanceTypeApplication, ClassId: applicationID1, State: catalogModels.InstanceStateRunning},
+			}
+			applications := []catalogModels.Application{{Id: applicationID1, Replication: 2}}
+			images := []catalogModels.Image{{State: catalogModels.ImageStateReady}}
+			services := []catalogModels.Service{{Id: serviceID1, Name: serviceName1}}
+
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return(instances, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplications(gomock.Any()).Return(applications, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListImages().Return(images, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(services, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetLatestIndex().Return(catalogModels.Index{Latest: 7}, http.StatusOK, nil),
+				mocksAndRouter.containerBrokerApiMock.EXPECT().GetVersions().Return([]containerBrokerModels.VersionsResponse{{}}, http.StatusOK, nil),
+			)
+
+			response := SendGet(platformMetricsURL, mocksAndRouter.router)
+
+			Convey("status code should be proper", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+			})
+
+			Convey("response should contain gathered counts", func() {
+				result := []models.PlatformMetrics{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 1)
+				So(result[0].OrganizationsCount, ShouldEqual, 1)
+				So(result[0].ApplicationsCount, ShouldEqual, 1)
+				So(result[0].ServiceInstancesCount, ShouldEqual, 2)
+				So(result[0].ServiceInstancesPerOffering[serviceName1], ShouldEqual, 2)
+				So(result[0].InstanceStates[catalogModels.InstanceStateRunning.String()], ShouldEqual, 2)
+				So(result[0].ApplicationStates[catalogModels.InstanceStateRunning.String()], ShouldEqual, 1)
+				So(result[0].ImageStates[string(catalogModels.ImageStateReady)], ShouldEqual, 1)
+				So(result[0].Replicas, ShouldEqual, 2)
+				So(result[0].MemoryUsage, ShouldEqual, 512)
+				So(result[0].LatestEvents, ShouldEqual, 7)
+				So(result[0].Components, ShouldEqual, 1)
+			})
+
+			Convey("usage of entities without organization should be gathered under empty organization id", func() {
+				latest, _ := platformMetricsHistory.latest()
+				So(latest.Organizations[""].ServiceInstancesCount, ShouldEqual, 2)
+				So(latest.Organizations[""].MemoryUsage, ShouldEqual, 512)
+				So(latest.Organizations[""].ApplicationStates[catalogModels.InstanceStateRunning.String()], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When Catalog returns error", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return(nil, http.StatusInternalServerError, errors.New("error"))
+
+			response := SendGet(platformMetricsURL, mocksAndRouter.router)
+
+			Convey("status code should be 500", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+
+		Convey("When from is later than to", func() {
+			response := SendGet(platformMetricsURL+"?from=200&to=100", mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestCountOrganizations(t *testing.T) {
+	Convey("Given usage of core organization, entities without organization and other organization", t, func() {
+		usage := map[string]*models.OrganizationUsage{"": {}, "coreOrgID": {}, "orgID2": {}}
+
+		Convey("core organization should be counted once with entities without organization", func() {
+			So(countOrganizations(usage, "coreOrgID"), ShouldEqual, 2)
+		})
+
+		Convey("core organization should be counted even without entities", func() {
+			So(countOrganizations(map[string]*models.OrganizationUsage{}, "coreOrgID"), ShouldEqual, 1)
+		})
+	})
+}
+
+func TestGetSingleMetric(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	singleMetricURL := fmt.Sprintf("/api/%s/metrics/single", apiPrefix)
+
+	Convey(fmt.Sprintf("Test %s", singleMetricURL), t, func() {
+		platformMetricsHistory = &metricsHistory{}
+		platformMetricsHistory.add(models.PlatformMetrics{Timestamp: 100, ApplicationsCount: 3})
+		platformMetricsHistory.add(models.PlatformMetrics{Timestamp: 200, ApplicationsCount: 4})
+
+		Convey("When metric name is not provided", func() {
+			response := SendGet(singleMetricURL, mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When existing metric is requested for a time range", func() {
+			response := SendGet(singleMetricURL+"?metric=applications_count&from=150&to=250", mocksAndRouter.router)
+
+			Convey("only values from the range should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.Metric{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 1)
+				So(result[0].Values, ShouldHaveLength, 1)
+				So(result[0].Values[0].Timestamp, ShouldEqual, "200")
+				So(result[0].Values[0].Value, ShouldEqual, float64(4))
+			})
+		})
+
+		Convey("When unknown metric is requested", func() {
+			response := SendGet(singleMetricURL+"?metric=unknown&from=50&to=250", mocksAndRouter.router)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestGetOrganizationMetrics(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	organizationMetricsURL := fmt.Sprintf("/api/%s/metrics/organizations", apiPrefix)
+
+	Convey(fmt.Sprintf("Test %s", organizationMetricsURL), t, func() {
+		platformMetricsHistory = &metricsHistory{}
+		platformMetricsHistory.add(models.PlatformMetrics{
+			Timestamp: 100,
+			Organizations: map[string]*models.OrganizationUsage{
+				"": {ServiceInstancesCount: 1},
+				organizationID1: {
+					ServiceInstancesCount: 3,
+					MemoryUsage:           512,
+					ApplicationStates:     map[string]int{catalogModels.InstanceStateRunning.String(): 2},
+				},
+			},
+		})
+		mocksAndRouter.userManagementApiFactoryMock.EXPECT().GetConfiguredUserManagementConnector(gomock.Any()).
+			Return(mocksAndRouter.userManagementApiMock).AnyTimes()
+		organizations := []userManagement.Organization{{Guid: organizationID1, Name: "first"}}
+
+		Convey("When metrics of organization other than core one are requested", func() {
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return(organizations, http.StatusOK, nil)
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizationUsers(organizationID1).
+				Return([]userManagement.UaaUser{{}, {}}, http.StatusOK, nil)
+
+			response := SendGet(fmt.Sprintf("%s/%s?from=50&to=150", organizationMetricsURL, organizationID1), mocksAndRouter.router)
+
+			Convey("usage of this organization should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.OrganizationMetrics{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 1)
+				So(result[0].OrganizationId, ShouldEqual, organizationID1)
+				So(result[0].Name, ShouldEqual, "first")
+				So(result[0].ApplicationsRunningCount, ShouldEqual, 2)
+				So(result[0].ServicesCount, ShouldEqual, 3)
+				So(result[0].MemoryUsage, ShouldEqual, "512MB")
+				So(result[0].UsersCount, ShouldEqual, "2")
+			})
+		})
+
+		Convey("When metrics of unknown organization are requested", func() {
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return(organizations, http.StatusOK, nil)
+
+			response := SendGet(fmt.Sprintf("%s/%s?from=50&to=150", organizationMetricsURL, organizationID2), mocksAndRouter.router)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestParseMemoryInMB(t *testing.T) {
+	testCases := []struct {
+		memory      string
+		expected    int
+		shouldError bool
+	}{
+		{"256MB", 256, false},
+		{"1G", 1024, false},
+		{"2gb", 2048, false},
+		{"abc", 0, true},
+		{"12KB", 0, true},
+	}
+
+	Convey("For set of test cases parseMemoryInMB should return proper responses", t, func() {
+		for _, tc := range testCases {
+			Convey(fmt.Sprintf("For memory %q", tc.memory), func() {
+				result, err := parseMemoryInMB(tc.memory)
+				So(err != nil, ShouldEqual, tc.shouldError)
+				So(result, ShouldEqual, tc.expected)
+			})
+		}
+	})
+}
@@ -0,0 +1,240 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gocraft/web"
+	"github.com/twinj/uuid"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+const (
+	OperationsHistorySize        = "OPERATIONS_HISTORY_SIZE"
+	OperationsHistorySizeDefault = 1000
+
+	operationLocationFormat   = "%s/operations/%s"
+	reasonTargetNotFound      = "target of the operation does not exist anymore"
+	reasonImageBuildFailed    = "image build failed"
+	reasonVersionSwitchFailed = "switch failed, application stays at its previous version"
+)
+
+// operationCheck inspects target of the operation and tells in which state the operation is
+type operationCheck func() (state models.OperationState, reason string, err error)
+
+type trackedOperation struct {
+	operation models.Operation
+	check     operationCheck
+}
+
+// operationsRegistry keeps operations in memory of the replica which accepted them.
+// Operations are not persisted: they are lost on restart and unknown to other replicas.
+type operationsRegistry struct {
+	mutex      sync.RWMutex
+	operations map[string]*trackedOperation
+	order      []string
+}
+
+var platformOperations = newOperationsRegistry()
+
+func newOperationsRegistry() *operationsRegistry {
+	return &operationsRegistry{operations: make(map[string]*trackedOperation)}
+}
+
+func (r *operationsRegistry) add(operation models.Operation, check operationCheck) {
+	historySize, _ := util.GetUint32EnvValueOrDefault(OperationsHistorySize, OperationsHistorySizeDefault)
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.operations[operation.Id] = &trackedOperation{operation: operation, check: check}
+	r.order = append(r.order, operation.Id)
+	for len(r.order) > int(historySize) {
+		delete(r.operations, r.order[0])
+		r.order = r.order[1:]
+	}
+}
+
+// get returns operation with state refreshed from its target, finished operations are not checked again
+func (r *operationsRegistry) get(operationId string) (models.Operation, bool, error) {
+	r.mutex.RLock()
+	tracked, found := r.operations[operationId]
+	var operation models.Operation
+	if found {
+		operation = tracked.operation
+	}
+	r.mutex.RUnlock()
+	if !found {
+		return operation, false, nil
+	}
+
+	if operation.State != models.OperationStatePending {
+		return operation, true, nil
+	}
+
+	state, reason, err := tracked.check()
+	if err != nil {
+		return operation, true, err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	now := time.Now().Unix()
+	tracked.operation.UpdatedOn = now
+	if state != models.OperationStatePending && tracked.operation.State == models.OperationStatePending {
+		tracked.operation.State = state
+		tracked.operation.Reason = reason
+		tracked.operation.FinishedOn = now
+	}
+	return tracked.operation, true, nil
+}
+
+// startOperation registers accepted operation and points the client to its status with Location header.
+// Location uses the same /api/<version> alias as the request.
+func startOperation(rw web.ResponseWriter, req *web.Request, username string, operationType models.OperationType,
+	targetType models.OperationTargetType, targetId string, check operationCheck) string {
+
+	now := time.Now().Unix()
+	operation := models.Operation{
+		Id:         uuid.NewV4().String(),
+		Type:       operationType,
+		State:      models.OperationStatePending,
+		TargetType: targetType,
+		TargetId:   targetId,
+		CreatedBy:  username,
+		CreatedOn:  now,
+		UpdatedOn:  now,
+	}
+	platformOperations.add(operation, check)
+
+	apiAlias, _ := splitApiAlias(req.RoutePath())
+	rw.Header().Set("Location", fmt.Sprintf(operationLocationFormat, apiAlias, operation.Id))
+	return operation.Id
+}
+
+func (c *Context) GetOperation(rw web.ResponseWriter, req *web.Request) {
+	operationId := req.PathParams["operationId"]
+
+	operation, found, err := platformOperations.get(operationId)
+	if !found {
+		commonHttp.Respond404(rw, fmt.Errorf("operation %q not found", operationId))
+		return
+	}
+	if err != nil {
+		commonHttp.Respond500(rw, fmt.Errorf("cannot check state of operation %q: %v", operationId, err))
+		return
+	}
+	commonHttp.WriteJson(rw, operation, http.StatusOK)
+}
+
+func instanceStateCheck(instanceId string, targetStates ...catalogModels.InstanceState) operationCheck {
+	return func() (models.OperationState, string, error) {
+		instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+		if status == http.StatusNotFound {
+			return models.OperationStateFailed, reasonTargetNotFound, nil
+		}
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch instance %q from Catalog: %v", instanceId, err)
+		}
+		return getOperationStateFromInstance(instance.State, instance.Metadata, targetStates)
+	}
+}
+
+func instanceRemovedCheck(instanceId string) operationCheck {
+	return func() (models.OperationState, string, error) {
+		instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+		if status == http.StatusNotFound {
+			return models.OperationStateSucceeded, "", nil
+		}
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch instance %q from Catalog: %v", instanceId, err)
+		}
+		return getOperationStateFromInstance(instance.State, instance.Metadata, nil)
+	}
+}
+
+func applicationStateCheck(applicationId string, targetStates ...catalogModels.InstanceState) operationCheck {
+	return func() (models.OperationState, string, error) {
+		application, err := getApplicationInstance(applicationId)
+		if err != nil {
+			if getStatusError(err) == http.StatusNotFound {
+				return models.OperationStateFailed, reasonTargetNotFound, nil
+			}
+			return models.OperationStatePending, "", err
+		}
+		if application.State == catalogModels.InstanceStateFailure && application.ImageState == catalogModels.ImageStateError {
+			return models.OperationStateFailed, reasonImageBuildFailed, nil
+		}
+		return getOperationStateFromInstance(application.State, application.Metadata, targetStates)
+	}
+}
+
+func offeringCreatedCheck(offeringId, imageId string) operationCheck {
+	return func() (models.OperationState, string, error) {
+		offering, status, err := BrokerConfig.CatalogApi.GetService(offeringId)
+		if status == http.StatusNotFound {
+			return models.OperationStateFailed, reasonTargetNotFound, nil
+		}
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch offering %q from Catalog: %v", offeringId, err)
+		}
+		if offering.State == catalogModels.ServiceStateReady {
+			return models.OperationStateSucceeded, "", nil
+		}
+
+		image, _, err := BrokerConfig.CatalogApi.GetImage(imageId)
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch image %q from Catalog: %v", imageId, err)
+		}
+		if image.State == catalogModels.ImageStateError {
+			return models.OperationStateFailed, reasonImageBuildFailed, nil
+		}
+		return models.OperationStatePending, "", nil
+	}
+}
+
+func offeringRemovedCheck(offeringId string) operationCheck {
+	return func() (models.OperationState, string, error) {
+		_, status, err := BrokerConfig.CatalogApi.GetService(offeringId)
+		if status == http.StatusNotFound {
+			return models.OperationStateSucceeded, "", nil
+		}
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch offering %q from Catalog: %v", offeringId, err)
+		}
+		return models.OperationStatePending, "", nil
+	}
+}
+
+func getOperationStateFromInstance(state catalogModels.InstanceState, metadata []catalogModels.Metadata,
+	targetStates []catalogModels.InstanceState) (models.OperationState, string, error) {
+
+	if state == catalogModels.InstanceStateFailure {
+		return models.OperationStateFailed, catalogModels.GetValueFromMetadata(metadata, catalogModels.LAST_STATE_CHANGE_REASON), nil
+	}
+	if isInstanceInOneOfStates(state, targetStates) {
+		return models.OperationStateSucceeded, "", nil
+	}
+	return models.OperationStatePending, "", nil
+}
@@ -0,0 +1,117 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+const failureReason = "container crashed"
+
+func TestGetOperation(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	restartURL := fmt.Sprintf("/api/%s/services/%s/restart", apiPrefix, instanceID1)
+
+	Convey("Test operations", t, func() {
+		platformOperations = newOperationsRegistry()
+
+		Convey("When operation does not exist", func() {
+			response := SendGet(fmt.Sprintf("/api/%s/operations/%s", apiPrefix, "unknown"), mocksAndRouter.router)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When restart request is accepted", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+			)
+
+			response := SendPut(restartURL, nil, mocksAndRouter.router)
+
+			result := models.OperationAcceptedResponse{}
+			readAndAssertJson(response, &result)
+
+			Convey("operation id and Location header should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(result.OperationId, ShouldNotBeEmpty)
+				So(response.Header().Get("Location"), ShouldEqual, fmt.Sprintf("/api/%s/operations/%s", apiPrefix, result.OperationId))
+			})
+
+			Convey("and instance fails", func() {
+				failedInstance := catalogModels.Instance{
+					Id:       instanceID1,
+					State:    catalogModels.InstanceStateFailure,
+					Metadata: []catalogModels.Metadata{{Id: catalogModels.LAST_STATE_CHANGE_REASON, Value: failureReason}},
+				}
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(failedInstance, http.StatusOK, nil)
+
+				operationURL := fmt.Sprintf("/api/%s/operations/%s", apiPrefix, result.OperationId)
+				response := SendGet(operationURL, mocksAndRouter.router)
+
+				Convey("operation should be failed with reason from instance metadata", func() {
+					So(response.Code, ShouldEqual, http.StatusOK)
+					operation := models.Operation{}
+					readAndAssertJson(response, &operation)
+					So(operation.Type, ShouldEqual, models.OperationTypeRestart)
+					So(operation.TargetId, ShouldEqual, instanceID1)
+					So(operation.State, ShouldEqual, models.OperationStateFailed)
+					So(operation.Reason, ShouldEqual, failureReason)
+					So(operation.FinishedOn, ShouldBeGreaterThan, 0)
+				})
+
+				Convey("finished operation should not be checked again", func() {
+					response := SendGet(operationURL, mocksAndRouter.router)
+					So(response.Code, ShouldEqual, http.StatusOK)
+				})
+			})
+		})
+
+		Convey("When restart request is sent to other API version", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+			)
+
+			response := SendPut(fmt.Sprintf("/api/v1.0/services/%s/restart", instanceID1), nil, mocksAndRouter.router)
+
+			result := models.OperationAcceptedResponse{}
+			readAndAssertJson(response, &result)
+
+			Convey("Location header should point to operation under the same API version", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(response.Header().Get("Location"), ShouldEqual, "/api/v1.0/operations/"+result.OperationId)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
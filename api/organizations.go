@@ -0,0 +1,268 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gocraft/web"
+
+	userManagement "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	organizationMetadataKey    = "ORGANIZATION_ID"
+	organizationHeader         = "X-TAP-Organization"
+	organizationQueryParameter = "org"
+)
+
+// getRequestedOrganization returns organization passed in org query parameter or X-TAP-Organization header
+func getRequestedOrganization(req *web.Request) string {
+	if orgId := commonHttp.GetQueryParameterCaseInsensitive(req, organizationQueryParameter); orgId != "" {
+		return orgId
+	}
+	return req.Header.Get(organizationHeader)
+}
+
+// OrganizationMiddleware sets organization in which request is executed.
+// Core organization is used when none is requested; regular users have to be members of requested one.
+func (c *Context) OrganizationMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	c.Organization = c.CoreOrganization
+	c.OrganizationRequested = false
+
+	if orgId := getRequestedOrganization(req); orgId != "" {
+		if status, err := c.checkOrganizationMembership(req, orgId); err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		c.Organization = orgId
+		c.OrganizationRequested = true
+	}
+	next(rw, req)
+}
+
+func (c *Context) checkOrganizationMembership(req *web.Request, orgId string) (int, error) {
+	if c.hasUnrestrictedAccess() {
+		return http.StatusOK, nil
+	}
+
+	isMember, status, err := c.isOrganizationMember(req, orgId)
+	if err != nil {
+		return status, err
+	}
+	if !isMember {
+		return http.StatusForbidden, fmt.Errorf("user %q is not a member of organization %q", c.Username, orgId)
+	}
+	return http.StatusOK, nil
+}
+
+// getCallerOrganizations fetches organizations of the caller from user-management once per request
+func (c *Context) getCallerOrganizations(req *web.Request) ([]userManagement.Organization, int, error) {
+	if c.callerOrganizations == nil {
+		organizations, status, err := getUserManagementApi(req).GetOrganizations()
+		if err != nil {
+			return nil, status, fmt.Errorf("cannot fetch organizations of user %q: %v", c.Username, err)
+		}
+		c.callerOrganizations = append([]userManagement.Organization{}, organizations...)
+	}
+	return c.callerOrganizations, http.StatusOK, nil
+}
+
+func (c *Context) isOrganizationMember(req *web.Request, orgId string) (bool, int, error) {
+	organizations, status, err := c.getCallerOrganizations(req)
+	if err != nil {
+		return false, status, err
+	}
+	for _, organization := range organizations {
+		if organization.Guid == orgId {
+			return true, http.StatusOK, nil
+		}
+	}
+	return false, http.StatusOK, nil
+}
+
+// canAccessOrganization reports whether resources of given organization are visible in the request.
+// Requested organization narrows visibility to itself. Otherwise admins see every organization,
+// while regular users see core organization and organizations they are members of.
+func (c *Context) canAccessOrganization(req *web.Request, orgId string) (bool, int, error) {
+	if c.OrganizationRequested {
+		return orgId == c.Organization, http.StatusOK, nil
+	}
+	if c.hasUnrestrictedAccess() || orgId == c.CoreOrganization {
+		return true, http.StatusOK, nil
+	}
+	return c.isOrganizationMember(req, orgId)
+}
+
+func getUserManagementApi(req *web.Request) userManagement.UserManagementApi {
+	return BrokerConfig.UserManagementApiFactory.GetConfiguredUserManagementConnector(req.Header.Get("Authorization"))
+}
+
+// withOrganization scopes metadata of newly created entity to organization of the request
+func (c *Context) withOrganization(metadata []catalogModels.Metadata) []catalogModels.Metadata {
+	if c.Organization == "" {
+		return metadata
+	}
+	result := []catalogModels.Metadata{}
+	for _, m := range metadata {
+		if m.Id != organizationMetadataKey {
+			result = append(result, m)
+		}
+	}
+	return append(result, catalogModels.Metadata{Id: organizationMetadataKey, Value: c.Organization})
+}
+
+// entities created before organizations were introduced belong to core organization
+func (c *Context) getOrganization(metadata []catalogModels.Metadata) string {
+	if orgId := catalogModels.GetValueFromMetadata(metadata, organizationMetadataKey); orgId != "" {
+		return orgId
+	}
+	return c.CoreOrganization
+}
+
+func (c *Context) filterInstancesByOrganization(req *web.Request, instances []catalogModels.Instance) ([]catalogModels.Instance, int, error) {
+	result := []catalogModels.Instance{}
+	for _, instance := range instances {
+		accessible, status, err := c.canAccessOrganization(req, c.getOrganization(instance.Metadata))
+		if err != nil {
+			return nil, status, err
+		}
+		if accessible {
+			result = append(result, instance)
+		}
+	}
+	return result, http.StatusOK, nil
+}
+
+func (c *Context) filterApplicationsByOrganization(req *web.Request, applications []catalogModels.Application) ([]catalogModels.Application, int, error) {
+	result := []catalogModels.Application{}
+	for _, application := range applications {
+		accessible, status, err := c.canAccessOrganization(req, c.getOrganization(application.Metadata))
+		if err != nil {
+			return nil, status, err
+		}
+		if accessible {
+			result = append(result, application)
+		}
+	}
+	return result, http.StatusOK, nil
+}
+
+// offerings without organization are platform offerings, available in every organization
+func (c *Context) canAccessOffering(req *web.Request, service catalogModels.Service) (bool, int, error) {
+	orgId := catalogModels.GetValueFromMetadata(service.Metadata, organizationMetadataKey)
+	if orgId == "" {
+		return true, http.StatusOK, nil
+	}
+	return c.canAccessOrganization(req, orgId)
+}
+
+func (c *Context) filterOfferingsByOrganization(req *web.Request, services []catalogModels.Service) ([]catalogModels.Service, int, error) {
+	result := []catalogModels.Service{}
+	for _, service := range services {
+		accessible, status, err := c.canAccessOffering(req, service)
+		if err != nil {
+			return nil, status, err
+		}
+		if accessible {
+			result = append(result, service)
+		}
+	}
+	return result, http.StatusOK, nil
+}
+
+func (c *Context) ListOrganizations(rw web.ResponseWriter, req *web.Request) {
+	organizations, status, err := c.getCallerOrganizations(req)
+	if err != nil {
+		commonHttp.RespondErrorByStatus(rw, status, "Get Organizations")
+		return
+	}
+
+	commonHttp.WriteJson(rw, organizations, http.StatusOK)
+}
+
+func (c *Context) CreateOrganization(rw web.ResponseWriter, req *web.Request) {
+	orgReq := userManagement.OrganizationRequest{}
+	if err := ReadJsonAndValidate(req, &orgReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	organization, status, err := getUserManagementApi(req).CreateOrganization(orgReq.Name)
+	if err != nil {
+		commonHttp.RespondErrorByStatus(rw, status, "Create Organization")
+		return
+	}
+
+	commonHttp.WriteJson(rw, organization, http.StatusCreated)
+}
+
+func (c *Context) ListOrganizationUsers(rw web.ResponseWriter, req *web.Request) {
+	orgId := req.PathParams["orgId"]
+
+	if status, err := c.checkOrganizationMembership(req, orgId); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	users, status, err := getUserManagementApi(req).GetOrganizationUsers(orgId)
+	if err != nil {
+		commonHttp.RespondErrorByStatus(rw, status, "Get Organization Users")
+		return
+	}
+
+	commonHttp.WriteJson(rw, users, http.StatusOK)
+}
+
+func (c *Context) AddOrganizationUser(rw web.ResponseWriter, req *web.Request) {
+	orgId := req.PathParams["orgId"]
+
+	userReq := userManagement.InvitationRequest{}
+	if err := ReadJsonAndValidate(req, &userReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	status, err := getUserManagementApi(req).AddOrganizationUser(orgId, userReq.Email)
+	if err != nil {
+		commonHttp.RespondErrorByStatus(rw, status, "Add Organization User")
+		return
+	}
+
+	commonHttp.WriteJson(rw, "", http.StatusCreated)
+}
+
+func (c *Context) RemoveOrganizationUser(rw web.ResponseWriter, req *web.Request) {
+	orgId := req.PathParams["orgId"]
+
+	userReq := userManagement.InvitationRequest{}
+	if err := ReadJsonAndValidate(req, &userReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	status, err := getUserManagementApi(req).RemoveOrganizationUser(orgId, userReq.Email)
+	if err != nil {
+		commonHttp.RespondErrorByStatus(rw, status, "Remove Organization User")
+		return
+	}
+
+	commonHttp.WriteJson(rw, "", status)
+}
@@ -0,0 +1,159 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	userManagement "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+const (
+	organizationID1 = "org-1"
+	organizationID2 = "org-2"
+)
+
+func getTestOrganizationInstances() []catalogModels.Instance {
+	instances := getTestCatalogInstances()
+	for i := range instances {
+		instances[i].AuditTrail.CreatedBy = ownerUsername
+	}
+	instances[0].Metadata = append(instances[0].Metadata, catalogModels.Metadata{Id: organizationMetadataKey, Value: organizationID1})
+	instances[1].Metadata = append(instances[1].Metadata, catalogModels.Metadata{Id: organizationMetadataKey, Value: organizationID2})
+	return instances
+}
+
+func TestOrganizationScoping(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	userToken := uaa_connector.TapJWTToken{Username: ownerUsername, Scope: []string{userGroup}}
+	servicesURL := fmt.Sprintf("/api/%s/services", apiPrefix)
+
+	Convey("Test organization scoping", t, func() {
+		mocksAndRouter.userManagementApiFactoryMock.EXPECT().GetConfiguredUserManagementConnector(gomock.Any()).Return(mocksAndRouter.userManagementApiMock).AnyTimes()
+
+		Convey("When user lists service instances of organization the user is a member of", func() {
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return([]userManagement.Organization{{Guid: organizationID1}}, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestOrganizationInstances(), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(getTestCatalogServices(), http.StatusOK, nil)
+
+			response := sendWithToken("GET", servicesURL+"?org="+organizationID1, "", userToken, mocksAndRouter, t)
+
+			Convey("only instances of this organization should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 1)
+				So(result[0].Id, ShouldEqual, instanceID1)
+			})
+		})
+
+		Convey("When user lists service instances without requesting organization", func() {
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return([]userManagement.Organization{{Guid: organizationID1}}, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestOrganizationInstances(), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(getTestCatalogServices(), http.StatusOK, nil)
+
+			response := sendWithToken("GET", servicesURL, "", userToken, mocksAndRouter, t)
+
+			Convey("instances of core organization and organizations of the user should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 4)
+				for _, instance := range result {
+					So(instance.Id, ShouldNotEqual, instanceID2)
+				}
+			})
+		})
+
+		Convey("When user gets service instance of organization the user is not a member of", func() {
+			instance := getTestOrganizationInstances()[1]
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(instance, http.StatusOK, nil)
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return([]userManagement.Organization{{Guid: organizationID1}}, http.StatusOK, nil)
+
+			response := sendWithToken("GET", servicesURL+"/"+instanceID2, "", userToken, mocksAndRouter, t)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When user gets offering of organization the user is not a member of", func() {
+			service := catalogModels.Service{Id: serviceID1, Metadata: []catalogModels.Metadata{{Id: organizationMetadataKey, Value: organizationID2}}}
+			mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(service, http.StatusOK, nil)
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return([]userManagement.Organization{{Guid: organizationID1}}, http.StatusOK, nil)
+
+			response := sendWithToken("GET", fmt.Sprintf("/api/%s/offerings/%s", apiPrefix, serviceID1), "", userToken, mocksAndRouter, t)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When user requests organization the user is not a member of", func() {
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return([]userManagement.Organization{{Guid: organizationID1}}, http.StatusOK, nil)
+
+			response := sendWithToken("GET", servicesURL+"?org="+organizationID2, "", userToken, mocksAndRouter, t)
+
+			Convey("status code should be 403", func() {
+				So(response.Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Convey("When user lists organizations", func() {
+			organizations := []userManagement.Organization{{Guid: organizationID1, Name: "first"}}
+			mocksAndRouter.userManagementApiMock.EXPECT().GetOrganizations().Return(organizations, http.StatusOK, nil)
+
+			response := sendWithToken("GET", fmt.Sprintf("/api/%s/organizations", apiPrefix), "", userToken, mocksAndRouter, t)
+
+			Convey("organizations from user-management should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []userManagement.Organization{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldResemble, organizations)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestWithOrganization(t *testing.T) {
+	Convey("Test withOrganization", t, func() {
+		c := Context{Organization: organizationID2}
+		metadata := []catalogModels.Metadata{
+			{Id: metadataID1, Value: metadataValue1},
+			{Id: organizationMetadataKey, Value: organizationID1},
+		}
+
+		Convey("organization of request should replace organization passed by user", func() {
+			So(c.withOrganization(metadata), ShouldResemble, []catalogModels.Metadata{
+				{Id: metadataID1, Value: metadataValue1},
+				{Id: organizationMetadataKey, Value: organizationID2},
+			})
+		})
+	})
+}
@@ -0,0 +1,352 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+// instances created for plan dependencies hold name of the instance they were created for
+const dependencyOfMetadataKey = "DEPENDENCY_OF"
+
+// orphansSource holds Catalog state in which orphans are looked for
+type orphansSource struct {
+	images       []catalogModels.Image
+	applications []catalogModels.Application
+	services     []catalogModels.Service
+	instances    []catalogModels.Instance
+	// leftovers are templates and blobs which could not be removed, as neither of their stores can be listed
+	leftovers []models.Orphan
+}
+
+// GetOrphans lists entities left behind by failed creation flows
+func (c *Context) GetOrphans(rw web.ResponseWriter, req *web.Request) {
+	orphans, status, err := findOrphansOfRequest(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, orphans, http.StatusOK)
+}
+
+// DeleteOrphans removes entities left behind by failed creation flows
+func (c *Context) DeleteOrphans(rw web.ResponseWriter, req *web.Request) {
+	orphans, status, err := findOrphansOfRequest(req)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	response := models.OrphansCleanupResponse{Removed: []models.Orphan{}, Failed: []models.Orphan{}}
+	for _, orphan := range orphans {
+		if err := c.removeOrphan(orphan); err != nil {
+			logger.Errorf("Cannot remove orphan %s %s: %v", orphan.Type, orphan.Id, err)
+			orphan.Error = err.Error()
+			response.Failed = append(response.Failed, orphan)
+			continue
+		}
+		logger.Infof("Orphan %s %s removed by %s", orphan.Type, orphan.Id, c.Username)
+		response.Removed = append(response.Removed, orphan)
+	}
+	commonHttp.WriteJson(rw, response, http.StatusOK)
+}
+
+// findOrphansOfRequest skips entities younger than grace period, as their creation may be still in progress
+func findOrphansOfRequest(req *web.Request) ([]models.Orphan, int, error) {
+	gracePeriodSeconds, _ := util.GetUint32EnvValueOrDefault(OrphansGracePeriod, OrphansGracePeriodDefault)
+	gracePeriod := time.Duration(gracePeriodSeconds) * time.Second
+	if olderThan := commonHttp.GetQueryParameterCaseInsensitive(req, "olderThan"); olderThan != "" {
+		var err error
+		if gracePeriod, err = time.ParseDuration(olderThan); err != nil || gracePeriod < 0 {
+			return nil, http.StatusBadRequest, fmt.Errorf("olderThan has to be non-negative duration, e.g. 30m, got %q", olderThan)
+		}
+	}
+
+	source, status, err := fetchOrphansSource()
+	if err != nil {
+		return nil, status, err
+	}
+	return findOrphans(source, time.Now().Add(-gracePeriod).Unix()), http.StatusOK, nil
+}
+
+func fetchOrphansSource() (orphansSource, int, error) {
+	source := orphansSource{}
+	var status int
+	var err error
+
+	if source.images, status, err = BrokerConfig.CatalogApi.ListImages(); err != nil {
+		return source, status, fmt.Errorf("cannot fetch images from Catalog: %v", err)
+	}
+	if source.applications, status, err = BrokerConfig.CatalogApi.ListApplications(nil); err != nil {
+		return source, status, fmt.Errorf("cannot fetch applications from Catalog: %v", err)
+	}
+	if source.services, status, err = BrokerConfig.CatalogApi.GetServices(); err != nil {
+		return source, status, fmt.Errorf("cannot fetch offerings from Catalog: %v", err)
+	}
+	if source.instances, status, err = BrokerConfig.CatalogApi.ListInstances(); err != nil {
+		return source, status, fmt.Errorf("cannot fetch instances from Catalog: %v", err)
+	}
+	if BrokerConfig.LeftoversStore != nil {
+		if source.leftovers, err = BrokerConfig.LeftoversStore.List(); err != nil {
+			return source, http.StatusInternalServerError, fmt.Errorf("cannot read leftovers of failed removals: %v", err)
+		}
+	}
+	return source, http.StatusOK, nil
+}
+
+// findOrphans returns entities created before createdBefore (unix time), which are not referenced by anything:
+// images of removed applications and offerings, unused images stuck in PENDING state, applications which never got
+// an image built, dependency instances not bound to any instance, and templates and blobs left by failed removals
+// which are no longer used by any offering, application or image
+func findOrphans(source orphansSource, createdBefore int64) []models.Orphan {
+	orphans := []models.Orphan{}
+	isOldEnough := func(auditTrail catalogModels.AuditTrail) bool {
+		return auditTrail.CreatedOn < createdBefore
+	}
+
+	for _, image := range source.images {
+		reason := ""
+		if isOldEnough(image.AuditTrail) {
+			reason = getImageOrphanReason(image, source)
+		}
+		if reason == "" && isImageStuckInPending(image, createdBefore) && !isImageInUse(image, source) {
+			reason = "image is stuck in PENDING state and no instance uses it"
+		}
+		if reason != "" {
+			orphans = append(orphans, models.Orphan{Type: models.OrphanTypeImage, Id: image.Id, Reason: reason,
+				CreatedOn: image.AuditTrail.CreatedOn})
+		}
+	}
+
+	for _, application := range source.applications {
+		if !isOldEnough(application.AuditTrail) || hasInstanceOfClass(source.instances, application.Id) {
+			continue
+		}
+		reason := "application has neither image nor instance"
+		if application.ImageId != "" {
+			image, found := findImage(source.images, application.ImageId)
+			if !found || !isImageStuckInPending(image, createdBefore) {
+				continue
+			}
+			reason = "application has no instance and its image is stuck in PENDING state"
+		}
+		orphans = append(orphans, models.Orphan{Type: models.OrphanTypeApplication, Id: application.Id, Name: application.Name,
+			Reason: reason, CreatedOn: application.AuditTrail.CreatedOn})
+	}
+
+	for _, instance := range source.instances {
+		parentName := catalogModels.GetValueFromMetadata(instance.Metadata, dependencyOfMetadataKey)
+		if parentName == "" || !isOldEnough(instance.AuditTrail) || isInstanceBeingRemoved(instance) || isInstanceBound(source.instances, instance.Id) {
+			continue
+		}
+		orphans = append(orphans, models.Orphan{Type: models.OrphanTypeInstance, Id: instance.Id, Name: instance.Name,
+			Reason: fmt.Sprintf("dependency instance created for %q is not bound to any instance", parentName), CreatedOn: instance.AuditTrail.CreatedOn})
+	}
+
+	for _, leftover := range source.leftovers {
+		switch leftover.Type {
+		case models.OrphanTypeTemplate:
+			if isGenericTemplate(leftover.Id) || isTemplateReferenced(leftover.Id, source) {
+				continue
+			}
+		case models.OrphanTypeBlob:
+			if isBlobOfAnyImage(leftover.Id, source) {
+				continue
+			}
+		}
+		orphans = append(orphans, leftover)
+	}
+	return orphans
+}
+
+func getImageOrphanReason(image catalogModels.Image, source orphansSource) string {
+	switch {
+	case catalogModels.IsApplicationInstance(image.Id):
+		if _, found := findApplicationOfImage(image.Id, source); found {
+			return ""
+		}
+		return "application of image does not exist"
+	case catalogModels.IsUserDefinedOffering(image.Id):
+		offeringId := catalogModels.GetOfferingId(image.Id)
+		for _, service := range source.services {
+			if service.Id == offeringId {
+				return ""
+			}
+		}
+		return "offering of image does not exist"
+	}
+	return ""
+}
+
+// isImageStuckInPending uses last update, as rebuild of application image keeps its creation time
+func isImageStuckInPending(image catalogModels.Image, updatedBefore int64) bool {
+	lastUpdatedOn := image.AuditTrail.LastUpdatedOn
+	if lastUpdatedOn == 0 {
+		lastUpdatedOn = image.AuditTrail.CreatedOn
+	}
+	return image.State == catalogModels.ImageStatePending && lastUpdatedOn < updatedBefore
+}
+
+func isImageInUse(image catalogModels.Image, source orphansSource) bool {
+	switch {
+	case catalogModels.IsApplicationInstance(image.Id):
+		applicationId := catalogModels.GetApplicationId(image.Id)
+		if application, found := findApplicationOfImage(image.Id, source); found {
+			applicationId = application.Id
+		}
+		return hasInstanceOfClass(source.instances, applicationId)
+	case catalogModels.IsUserDefinedOffering(image.Id):
+		return hasInstanceOfClass(source.instances, catalogModels.GetOfferingId(image.Id))
+	}
+	return true
+}
+
+func findImage(images []catalogModels.Image, imageId string) (catalogModels.Image, bool) {
+	for _, image := range images {
+		if image.Id == imageId {
+			return image, true
+		}
+	}
+	return catalogModels.Image{}, false
+}
+
+func isTemplateReferenced(templateId string, source orphansSource) bool {
+	for _, service := range source.services {
+		if service.TemplateId == templateId {
+			return true
+		}
+	}
+	for _, application := range source.applications {
+		if application.TemplateId == templateId {
+			return true
+		}
+	}
+	return false
+}
+
+// findApplicationOfImage finds application running the image or retaining it as one of its versions
+func findApplicationOfImage(imageId string, source orphansSource) (catalogModels.Application, bool) {
+	for _, application := range source.applications {
+		if application.ImageId == imageId {
+			return application, true
+		}
+		versions, err := getApplicationVersions(application)
+		if err != nil {
+			logger.Warningf("Cannot read versions of application %q, its images are not treated as orphans: %v", application.Id, err)
+			return application, true
+		}
+		for _, record := range versions.withPending() {
+			if record.ImageId == imageId {
+				return application, true
+			}
+		}
+	}
+	return catalogModels.Application{}, false
+}
+
+// isBlobOfAnyImage treats blobs of versions retained for rollback as blobs of their images
+func isBlobOfAnyImage(blobId string, source orphansSource) bool {
+	if _, found := findImage(source.images, blobId); found {
+		return true
+	}
+	_, found := findApplicationOfImage(blobId, source)
+	return found
+}
+
+func hasInstanceOfClass(instances []catalogModels.Instance, classId string) bool {
+	for _, instance := range instances {
+		if instance.ClassId == classId {
+			return true
+		}
+	}
+	return false
+}
+
+func isInstanceBound(instances []catalogModels.Instance, instanceId string) bool {
+	for _, instance := range instances {
+		for _, binding := range instance.Bindings {
+			if binding.Id == instanceId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isInstanceBeingRemoved(instance catalogModels.Instance) bool {
+	return instance.State == catalogModels.InstanceStateDestroyReq || instance.State == catalogModels.InstanceStateDestroying
+}
+
+func (c *Context) removeOrphan(orphan models.Orphan) error {
+	switch orphan.Type {
+	case models.OrphanTypeImage:
+		if err := deleteImageFromCatalog(orphan.Id)(); err != nil {
+			return err
+		}
+		return deleteBlobFromBlobStore(orphan.Id)()
+	case models.OrphanTypeApplication:
+		return deleteApplicationFromCatalog(orphan.Id)()
+	case models.OrphanTypeInstance:
+		return c.deleteInstanceFromCatalog(orphan.Id)()
+	case models.OrphanTypeTemplate:
+		if isUsed, err := isTemplateUsed(orphan.Id); err != nil {
+			return fmt.Errorf("cannot determine if template is used by any offering: %v", err)
+		} else if isUsed {
+			return fmt.Errorf("template is used by an offering")
+		}
+		if err := markTemplateUnavailable(orphan.Id, c.Username)(); err != nil {
+			return err
+		}
+		if err := deleteTemplateFromTemplateRepository(orphan.Id)(); err != nil {
+			return err
+		}
+		return forgetLeftover(orphan)
+	case models.OrphanTypeBlob:
+		if err := deleteBlobFromBlobStore(orphan.Id)(); err != nil {
+			return err
+		}
+		return forgetLeftover(orphan)
+	}
+	return fmt.Errorf("unknown orphan type %q", orphan.Type)
+}
+
+// recordLeftover remembers entity which could not be removed from store that cannot be listed, so that orphans cleanup finds it
+func recordLeftover(orphanType models.OrphanType, id, reason string) {
+	if BrokerConfig.LeftoversStore == nil {
+		return
+	}
+	leftover := models.Orphan{Type: orphanType, Id: id, Reason: reason, CreatedOn: time.Now().Unix()}
+	if err := BrokerConfig.LeftoversStore.Add(leftover); err != nil {
+		logger.Errorf("Cannot record %s %s for orphans cleanup: %v", orphanType, id, err)
+	}
+}
+
+func forgetLeftover(orphan models.Orphan) error {
+	if BrokerConfig.LeftoversStore == nil {
+		return nil
+	}
+	return BrokerConfig.LeftoversStore.Remove(orphan.Type, orphan.Id)
+}
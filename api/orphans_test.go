@@ -0,0 +1,243 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/leftovers"
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	orphansTestApplicationID2 = "appID2"
+	orphansTestApplicationID3 = "appID3"
+	orphansTestApplicationID4 = "appID4"
+	orphansTestApplicationID5 = "appID5"
+	orphansTestTemplateID     = "orphanTemplateID"
+	orphansTestBlobID         = "orphanBlobID"
+)
+
+func getOrphansTestSource() orphansSource {
+	old := catalogModels.AuditTrail{CreatedOn: 100}
+	recent := catalogModels.AuditTrail{CreatedOn: 1000}
+	rebuiltRecently := catalogModels.AuditTrail{CreatedOn: 100, LastUpdatedOn: 1000}
+	versions, _ := json.Marshal(applicationVersions{
+		Current: initialApplicationVersion,
+		Versions: []applicationVersionRecord{
+			{Version: initialApplicationVersion, ImageId: catalogModels.GenerateImageId(applicationID1)},
+			{Version: "v1", ImageId: getApplicationVersionImageId(applicationID1, "v1")},
+		},
+	})
+
+	return orphansSource{
+		images: []catalogModels.Image{
+			{Id: catalogModels.GenerateImageId(applicationID1), AuditTrail: rebuiltRecently, State: catalogModels.ImageStatePending},
+			{Id: getApplicationVersionImageId(applicationID1, "v1"), AuditTrail: old, State: catalogModels.ImageStatePending},
+			{Id: catalogModels.GenerateImageId(orphansTestApplicationID2), AuditTrail: old},
+			{Id: catalogModels.GenerateImageId(orphansTestApplicationID3), AuditTrail: recent},
+			{Id: catalogModels.GenerateImageId(orphansTestApplicationID5), AuditTrail: old, State: catalogModels.ImageStatePending},
+			{Id: catalogModels.ConstructImageIdForUserOffering(serviceID1), AuditTrail: old, State: catalogModels.ImageStatePending},
+			{Id: catalogModels.ConstructImageIdForUserOffering(serviceID2), AuditTrail: old},
+		},
+		applications: []catalogModels.Application{
+			{Id: applicationID1, ImageId: catalogModels.GenerateImageId(applicationID1), AuditTrail: old,
+				Metadata: []catalogModels.Metadata{{Id: applicationVersionsMetadataKey, Value: string(versions)}}},
+			{Id: orphansTestApplicationID4, AuditTrail: old},
+			{Id: orphansTestApplicationID5, ImageId: catalogModels.GenerateImageId(orphansTestApplicationID5), AuditTrail: old},
+		},
+		services: []catalogModels.Service{{Id: serviceID1, TemplateId: serviceTemplateID1}},
+		instances: []catalogModels.Instance{
+			{Id: instanceID5, ClassId: applicationID1, AuditTrail: old},
+			{Id: instanceID1, ClassId: serviceID1, Bindings: []catalogModels.InstanceBindings{{Id: instanceID2}}, AuditTrail: old},
+			{Id: instanceID2, Metadata: []catalogModels.Metadata{{Id: dependencyOfMetadataKey, Value: instanceName1}}, AuditTrail: old},
+			{Id: instanceID3, Metadata: []catalogModels.Metadata{{Id: dependencyOfMetadataKey, Value: instanceName1}}, AuditTrail: old},
+			{Id: instanceID4, Metadata: []catalogModels.Metadata{{Id: dependencyOfMetadataKey, Value: instanceName1}}, AuditTrail: old,
+				State: catalogModels.InstanceStateDestroyReq},
+		},
+		leftovers: []models.Orphan{
+			{Type: models.OrphanTypeTemplate, Id: orphansTestTemplateID},
+			{Type: models.OrphanTypeTemplate, Id: serviceTemplateID1},
+			{Type: models.OrphanTypeBlob, Id: orphansTestBlobID},
+			{Type: models.OrphanTypeBlob, Id: catalogModels.GenerateImageId(applicationID1)},
+			{Type: models.OrphanTypeBlob, Id: getApplicationVersionImageId(applicationID1, "v2")},
+		},
+	}
+}
+
+func TestFindOrphans(t *testing.T) {
+	Convey("Test findOrphans", t, func() {
+		orphans := findOrphans(getOrphansTestSource(), 500)
+
+		ids := []string{}
+		for _, orphan := range orphans {
+			ids = append(ids, fmt.Sprintf("%s %s", orphan.Type, orphan.Id))
+		}
+
+		Convey("only unreferenced entities older than grace period should be returned", func() {
+			So(ids, ShouldResemble, []string{
+				fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.GenerateImageId(orphansTestApplicationID2)),
+				fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.GenerateImageId(orphansTestApplicationID5)),
+				fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.ConstructImageIdForUserOffering(serviceID2)),
+				fmt.Sprintf("%s %s", models.OrphanTypeApplication, orphansTestApplicationID4),
+				fmt.Sprintf("%s %s", models.OrphanTypeApplication, orphansTestApplicationID5),
+				fmt.Sprintf("%s %s", models.OrphanTypeInstance, instanceID3),
+				fmt.Sprintf("%s %s", models.OrphanTypeTemplate, orphansTestTemplateID),
+				fmt.Sprintf("%s %s", models.OrphanTypeBlob, orphansTestBlobID),
+				fmt.Sprintf("%s %s", models.OrphanTypeBlob, getApplicationVersionImageId(applicationID1, "v2")),
+			})
+		})
+
+		Convey("image of version retained for rollback should not be returned", func() {
+			So(ids, ShouldNotContain, fmt.Sprintf("%s %s", models.OrphanTypeImage, getApplicationVersionImageId(applicationID1, "v1")))
+		})
+
+		Convey("unused image stuck in PENDING state should be returned with its application", func() {
+			So(ids, ShouldContain, fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.GenerateImageId(orphansTestApplicationID5)))
+			So(ids, ShouldContain, fmt.Sprintf("%s %s", models.OrphanTypeApplication, orphansTestApplicationID5))
+		})
+
+		Convey("image in PENDING state which is used or was rebuilt recently should not be returned", func() {
+			So(ids, ShouldNotContain, fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.ConstructImageIdForUserOffering(serviceID1)))
+			So(ids, ShouldNotContain, fmt.Sprintf("%s %s", models.OrphanTypeImage, catalogModels.GenerateImageId(applicationID1)))
+		})
+
+		Convey("template left by failed removal should be returned only if no offering uses it", func() {
+			So(ids, ShouldContain, fmt.Sprintf("%s %s", models.OrphanTypeTemplate, orphansTestTemplateID))
+			So(ids, ShouldNotContain, fmt.Sprintf("%s %s", models.OrphanTypeTemplate, serviceTemplateID1))
+		})
+
+		Convey("blob left by failed removal should be returned only if it has no image", func() {
+			So(ids, ShouldContain, fmt.Sprintf("%s %s", models.OrphanTypeBlob, orphansTestBlobID))
+			So(ids, ShouldNotContain, fmt.Sprintf("%s %s", models.OrphanTypeBlob, catalogModels.GenerateImageId(applicationID1)))
+		})
+	})
+}
+
+func TestDeleteOrphans(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	orphansURL := fmt.Sprintf("/api/%s/orphans?olderThan=0s", apiPrefix)
+
+	Convey("Test DELETE /orphans", t, func() {
+		orphanImageId := catalogModels.GenerateImageId(orphansTestApplicationID2)
+		gomock.InOrder(
+			mocksAndRouter.catalogApiMock.EXPECT().ListImages().Return([]catalogModels.Image{{Id: orphanImageId}}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().ListApplications(gomock.Any()).
+				Return([]catalogModels.Application{{Id: applicationID1, ImageId: "image"}}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(orphanImageId).Return(http.StatusNoContent, nil),
+			mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(orphanImageId).Return(http.StatusNotFound, fmt.Errorf("not found")),
+		)
+
+		response := commonHttp.SendRequest("DELETE", orphansURL, nil, mocksAndRouter.router, t)
+
+		Convey("orphan image should be removed together with its blob", func() {
+			So(response.Code, ShouldEqual, http.StatusOK)
+			result := models.OrphansCleanupResponse{}
+			readAndAssertJson(response, &result)
+			So(result.Removed, ShouldHaveLength, 1)
+			So(result.Removed[0].Id, ShouldEqual, orphanImageId)
+			So(result.Failed, ShouldBeEmpty)
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestDeleteOrphansLeftByFailedRemovals(t *testing.T) {
+	orphansURL := fmt.Sprintf("/api/%s/orphans?olderThan=0s", apiPrefix)
+
+	Convey("Given leftovers store", t, func() {
+		dir, err := ioutil.TempDir("", "leftovers")
+		So(err, ShouldBeNil)
+		store := leftovers.NewJsonFileStore(filepath.Join(dir, "leftovers.json"))
+
+		Convey("When blob of orphan image cannot be removed", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+			BrokerConfig.LeftoversStore = store
+
+			orphanImageId := catalogModels.GenerateImageId(orphansTestApplicationID2)
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().ListImages().Return([]catalogModels.Image{{Id: orphanImageId}}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplications(gomock.Any()).Return([]catalogModels.Application{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(orphanImageId).Return(http.StatusNoContent, nil),
+				mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(orphanImageId).Return(http.StatusInternalServerError, fmt.Errorf("unavailable")),
+			)
+
+			response := commonHttp.SendRequest("DELETE", orphansURL, nil, mocksAndRouter.router, t)
+
+			Convey("blob should be recorded, so that next cleanup finds it", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				recorded, err := store.List()
+				So(err, ShouldBeNil)
+				So(recorded, ShouldHaveLength, 1)
+				So(recorded[0].Type, ShouldEqual, models.OrphanTypeBlob)
+				So(recorded[0].Id, ShouldEqual, orphanImageId)
+			})
+		})
+
+		Convey("When template and blob were left by failed removals", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+			BrokerConfig.LeftoversStore = store
+
+			So(store.Add(models.Orphan{Type: models.OrphanTypeTemplate, Id: orphansTestTemplateID}), ShouldBeNil)
+			So(store.Add(models.Orphan{Type: models.OrphanTypeBlob, Id: orphansTestBlobID}), ShouldBeNil)
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().ListImages().Return([]catalogModels.Image{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplications(gomock.Any()).Return([]catalogModels.Application{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateTemplate(orphansTestTemplateID, gomock.Any()).
+					Return(catalogModels.Template{}, http.StatusOK, nil),
+				mocksAndRouter.templateRepositoryApiMock.EXPECT().DeleteTemplate(orphansTestTemplateID).Return(http.StatusNoContent, nil),
+				mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(orphansTestBlobID).Return(http.StatusNoContent, nil),
+			)
+
+			response := commonHttp.SendRequest("DELETE", orphansURL, nil, mocksAndRouter.router, t)
+
+			Convey("both should be removed and forgotten", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := models.OrphansCleanupResponse{}
+				readAndAssertJson(response, &result)
+				So(result.Removed, ShouldHaveLength, 2)
+				So(result.Failed, ShouldBeEmpty)
+
+				recorded, err := store.List()
+				So(err, ShouldBeNil)
+				So(recorded, ShouldBeEmpty)
+			})
+		})
+	})
+}
@@ -0,0 +1,322 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const sharedWithMetadataKey = "SHARED_WITH"
+
+type ownership struct {
+	owner      string
+	sharedWith []string
+	// public resources, like offerings, are accessible by every user who sees their organization
+	public bool
+	// empty organization means resource is not scoped to any organization
+	organization string
+}
+
+func (c *Context) getOwnership(auditTrail catalogModels.AuditTrail, metadata []catalogModels.Metadata) ownership {
+	return ownership{
+		owner:        auditTrail.CreatedBy,
+		sharedWith:   splitQueryParameterList(catalogModels.GetValueFromMetadata(metadata, sharedWithMetadataKey)),
+		organization: c.getOrganization(metadata),
+	}
+}
+
+// hasUnrestrictedAccess is true for admins and when OAuth2 middleware is not activated
+func (c *Context) hasUnrestrictedAccess() bool {
+	return c.IsAdmin || c.Username == ""
+}
+
+// isResourceAccessRestricted is true when ownership or organization of accessed resources has to be checked
+func (c *Context) isResourceAccessRestricted() bool {
+	return !c.hasUnrestrictedAccess() || c.OrganizationRequested
+}
+
+func (c *Context) isOwner(o ownership) bool {
+	return c.hasUnrestrictedAccess() || o.owner == c.Username
+}
+
+func (c *Context) canAccess(o ownership) bool {
+	return o.public || c.isOwner(o) || commonHttp.StringInSlice(c.Username, o.sharedWith)
+}
+
+func (c *Context) canAccessInstance(instance catalogModels.Instance) bool {
+	return c.canAccess(c.getOwnership(instance.AuditTrail, instance.Metadata))
+}
+
+func (c *Context) canAccessApplication(application catalogModels.Application) bool {
+	return c.canAccess(c.getOwnership(application.AuditTrail, application.Metadata))
+}
+
+func (c *Context) filterAccessibleInstances(instances []catalogModels.Instance) []catalogModels.Instance {
+	if c.hasUnrestrictedAccess() {
+		return instances
+	}
+	result := []catalogModels.Instance{}
+	for _, instance := range instances {
+		if c.canAccessInstance(instance) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+func (c *Context) filterAccessibleApplications(applications []catalogModels.Application) []catalogModels.Application {
+	if c.hasUnrestrictedAccess() {
+		return applications
+	}
+	result := []catalogModels.Application{}
+	for _, application := range applications {
+		if c.canAccessApplication(application) {
+			result = append(result, application)
+		}
+	}
+	return result
+}
+
+type ownershipCheck func(c *Context, id string) (ownership, int, error)
+
+// ownedPathParams maps path params of user routes to the way their owner is resolved
+var ownedPathParams = map[string]ownershipCheck{
+	"applicationId":    getApplicationOwnership,
+	"srcApplicationId": getApplicationOwnership,
+	"dstApplicationId": getApplicationOwnership,
+	"serviceId":        getInstanceOwnership,
+	"srcServiceId":     getInstanceOwnership,
+	"dstServiceId":     getInstanceOwnership,
+	"instanceId":       getInstanceOwnership,
+	"operationId":      getOperationOwnership,
+	"offeringId":       getOfferingOwnership,
+}
+
+func getApplicationOwnership(c *Context, applicationId string) (ownership, int, error) {
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		return ownership{}, status, err
+	}
+	return c.getOwnership(application.AuditTrail, application.Metadata), http.StatusOK, nil
+}
+
+// application instance is owned by the owner of its application
+func getInstanceOwnership(c *Context, instanceId string) (ownership, int, error) {
+	instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		return ownership{}, status, err
+	}
+	if instance.Type == catalogModels.InstanceTypeApplication {
+		return getApplicationOwnership(c, instance.ClassId)
+	}
+	return c.getOwnership(instance.AuditTrail, instance.Metadata), http.StatusOK, nil
+}
+
+func getOperationOwnership(c *Context, operationId string) (ownership, int, error) {
+	operation, found, _ := platformOperations.get(operationId)
+	if !found {
+		return ownership{}, http.StatusNotFound, fmt.Errorf("operation %q not found", operationId)
+	}
+	return ownership{owner: operation.CreatedBy}, http.StatusOK, nil
+}
+
+// offerings without organization are platform offerings, available in every organization
+func getOfferingOwnership(c *Context, offeringId string) (ownership, int, error) {
+	service, status, err := BrokerConfig.CatalogApi.GetService(offeringId)
+	if err != nil {
+		return ownership{}, status, err
+	}
+	return ownership{
+		public:       true,
+		organization: catalogModels.GetValueFromMetadata(service.Metadata, organizationMetadataKey),
+	}, http.StatusOK, nil
+}
+
+// OwnershipMiddleware lets regular users reach only resources they own or which are shared with them,
+// and every caller only resources of organizations visible in the request (see canAccessOrganization).
+// Not accessible resources are reported as not found, so their existence is not revealed.
+// Handlers of list endpoints and events stream apply the same checks to their results.
+func (c *Context) OwnershipMiddleware(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	if !c.isResourceAccessRestricted() {
+		next(rw, req)
+		return
+	}
+
+	for param, id := range req.PathParams {
+		check, found := ownedPathParams[param]
+		if !found || id == "" {
+			continue
+		}
+		if !c.checkOwnership(rw, req, check, id) {
+			return
+		}
+	}
+
+	if req.Method == http.MethodPost && strings.HasSuffix(req.URL.Path, "/bindings") {
+		if !c.checkBindingRequestOwnership(rw, req) {
+			return
+		}
+	}
+	next(rw, req)
+}
+
+func (c *Context) checkOwnership(rw web.ResponseWriter, req *web.Request, check ownershipCheck, id string) bool {
+	o, status, err := check(c, id)
+	if status == http.StatusNotFound {
+		// handler responds with its own not found error
+		return true
+	}
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return false
+	}
+	accessible, status, err := c.canAccessResource(req, o)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return false
+	}
+	if !accessible {
+		logger.Infof("User %q tried to access %q owned by %q in organization %q", c.Username, id, o.owner, o.organization)
+		commonHttp.Respond404(rw, fmt.Errorf("%q not found", id))
+		return false
+	}
+	return true
+}
+
+func (c *Context) canAccessResource(req *web.Request, o ownership) (bool, int, error) {
+	if !c.canAccess(o) {
+		return false, http.StatusOK, nil
+	}
+	if o.organization == "" {
+		return true, http.StatusOK, nil
+	}
+	return c.canAccessOrganization(req, o.organization)
+}
+
+// binding source is passed in request body, so it is restored after being checked
+func (c *Context) checkBindingRequestOwnership(rw web.ResponseWriter, req *web.Request) bool {
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return false
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	request := models.InstanceBindingRequest{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		// handler reports malformed body
+		return true
+	}
+	if request.ApplicationId != "" && !c.checkOwnership(rw, req, getApplicationOwnership, request.ApplicationId) {
+		return false
+	}
+	if request.ServiceId != "" && !c.checkOwnership(rw, req, getInstanceOwnership, request.ServiceId) {
+		return false
+	}
+	return true
+}
+
+func (c *Context) ShareApplication(rw web.ResponseWriter, req *web.Request) {
+	applicationId := req.PathParams["applicationId"]
+
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	c.share(rw, req, c.getOwnership(application.AuditTrail, application.Metadata), application.Metadata, func(patch catalogModels.Patch) (int, error) {
+		_, status, err := BrokerConfig.CatalogApi.UpdateApplication(applicationId, []catalogModels.Patch{patch})
+		return status, err
+	})
+}
+
+func (c *Context) ShareServiceInstance(rw web.ResponseWriter, req *web.Request) {
+	instanceId := req.PathParams["serviceId"]
+
+	instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	c.share(rw, req, c.getOwnership(instance.AuditTrail, instance.Metadata), instance.Metadata, func(patch catalogModels.Patch) (int, error) {
+		_, status, err := BrokerConfig.CatalogApi.UpdateInstance(instanceId, []catalogModels.Patch{patch})
+		return status, err
+	})
+}
+
+func (c *Context) share(rw web.ResponseWriter, req *web.Request, current ownership, metadata []catalogModels.Metadata,
+	update func(catalogModels.Patch) (int, error)) {
+
+	if !c.isOwner(current) {
+		commonHttp.Respond403(rw)
+		return
+	}
+
+	request := models.SharingRequest{}
+	if err := ReadJsonAndValidate(req, &request); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	users := []string{}
+	for _, user := range request.Users {
+		if user = strings.TrimSpace(user); user != "" && user != current.owner && !commonHttp.StringInSlice(user, users) {
+			users = append(users, user)
+		}
+	}
+
+	// key stays in metadata with empty value after unsharing with everyone, so it is updated then
+	operation := catalogModels.OperationAdd
+	if hasMetadataKey(metadata, sharedWithMetadataKey) {
+		operation = catalogModels.OperationUpdate
+	}
+	patch, err := builder.MakePatch("Metadata", catalogModels.Metadata{Id: sharedWithMetadataKey, Value: strings.Join(users, ",")}, operation)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	patch.Username = c.Username
+
+	if status, err := update(patch); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, models.SharingResponse{Owner: current.owner, SharedWith: users}, http.StatusOK)
+}
+
+func hasMetadataKey(metadata []catalogModels.Metadata, key string) bool {
+	for _, m := range metadata {
+		if m.Id == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,174 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	ownerUsername  = "owner"
+	sharedUsername = "shared"
+	otherUsername  = "other"
+)
+
+func getTestOwnedInstances() []catalogModels.Instance {
+	instances := getTestCatalogInstances()
+	for i := range instances {
+		instances[i].AuditTrail.CreatedBy = otherUsername
+	}
+	instances[0].AuditTrail.CreatedBy = ownerUsername
+	instances[1].Metadata = append(instances[1].Metadata, catalogModels.Metadata{Id: sharedWithMetadataKey, Value: ownerUsername})
+	return instances
+}
+
+func sendWithToken(method, url, body string, token uaa_connector.TapJWTToken, mocksAndRouter mocksAndRouter, t *testing.T) *httptest.ResponseRecorder {
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", fmt.Sprintf("bearer %s", testToken))
+	mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&token, nil)
+	return commonHttp.SendRequestWithHeaders(method, url, []byte(body), mocksAndRouter.router, header, t)
+}
+
+func TestServiceInstancesVisibility(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	userToken := uaa_connector.TapJWTToken{Username: ownerUsername, Scope: []string{userGroup}}
+	adminToken := uaa_connector.TapJWTToken{Username: "admin", Scope: []string{adminGroup}}
+
+	Convey("Test service instances visibility", t, func() {
+		Convey("When user lists service instances", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestOwnedInstances(), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(getTestCatalogServices(), http.StatusOK, nil)
+
+			response := sendWithToken("GET", fmt.Sprintf("/api/%s/services", apiPrefix), "", userToken, mocksAndRouter, t)
+
+			Convey("only owned and shared instances should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 2)
+				So(result[0].Id, ShouldEqual, instanceID1)
+				So(result[1].Id, ShouldEqual, instanceID2)
+			})
+		})
+
+		Convey("When admin lists service instances", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestOwnedInstances(), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return(getTestCatalogServices(), http.StatusOK, nil)
+
+			response := sendWithToken("GET", fmt.Sprintf("/api/%s/services", apiPrefix), "", adminToken, mocksAndRouter, t)
+
+			Convey("all instances should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 5)
+			})
+		})
+
+		Convey("When user stops instance owned by somebody else", func() {
+			instance := getTestOwnedInstances()[2]
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil)
+
+			response := sendWithToken("PUT", fmt.Sprintf("/api/%s/services/%s/stop", apiPrefix, instance.Id), "", userToken, mocksAndRouter, t)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When user binds own application to instance owned by somebody else", func() {
+			instance := getTestOwnedInstances()[0]
+			otherInstance := getTestOwnedInstances()[2]
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(otherInstance.Id).Return(otherInstance, http.StatusOK, nil),
+			)
+
+			body := fmt.Sprintf(`{"service_id": %q}`, otherInstance.Id)
+			response := sendWithToken("POST", fmt.Sprintf("/api/%s/services/%s/bindings", apiPrefix, instance.Id), body, userToken, mocksAndRouter, t)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When owner shares instance", func() {
+			instance := getTestOwnedInstances()[0]
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil).Times(2)
+			mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instance.Id, gomock.Any()).Return(instance, http.StatusOK, nil)
+
+			body := fmt.Sprintf(`{"users": [%q, %q, %q]}`, sharedUsername, sharedUsername, ownerUsername)
+			response := sendWithToken("PUT", fmt.Sprintf("/api/%s/services/%s/sharing", apiPrefix, instance.Id), body, userToken, mocksAndRouter, t)
+
+			Convey("deduplicated list of users should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := models.SharingResponse{}
+				readAndAssertJson(response, &result)
+				So(result.Owner, ShouldEqual, ownerUsername)
+				So(result.SharedWith, ShouldResemble, []string{sharedUsername})
+			})
+		})
+
+		Convey("When owner shares instance which was unshared with everyone before", func() {
+			instance := getTestOwnedInstances()[0]
+			instance.Metadata = append(instance.Metadata, catalogModels.Metadata{Id: sharedWithMetadataKey, Value: ""})
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil).Times(2)
+
+			var patches []catalogModels.Patch
+			mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instance.Id, gomock.Any()).
+				Do(func(id string, p []catalogModels.Patch) { patches = p }).
+				Return(instance, http.StatusOK, nil)
+
+			body := fmt.Sprintf(`{"users": [%q]}`, sharedUsername)
+			response := sendWithToken("PUT", fmt.Sprintf("/api/%s/services/%s/sharing", apiPrefix, instance.Id), body, userToken, mocksAndRouter, t)
+
+			Convey("existing metadata entry should be updated", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				So(patches, ShouldHaveLength, 1)
+				So(patches[0].Operation, ShouldEqual, catalogModels.OperationUpdate)
+			})
+		})
+
+		Convey("When user with whom instance is shared tries to change sharing", func() {
+			instance := getTestOwnedInstances()[1]
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instance.Id).Return(instance, http.StatusOK, nil).Times(2)
+
+			body := fmt.Sprintf(`{"users": [%q]}`, sharedUsername)
+			response := sendWithToken("PUT", fmt.Sprintf("/api/%s/services/%s/sharing", apiPrefix, instance.Id), body, userToken, mocksAndRouter, t)
+
+			Convey("status code should be 403", func() {
+				So(response.Code, ShouldEqual, http.StatusForbidden)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,196 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// schema of parameters of plan is stored in offering metadata under this prefix followed by plan name
+const parametersSchemaMetadataKeyPrefix = "PARAMETERS_SCHEMA_"
+
+func getParametersSchemaMetadataKey(planName string) string {
+	return parametersSchemaMetadataKeyPrefix + planName
+}
+
+func getRawParametersSchema(service catalogModels.Service, plan catalogModels.ServicePlan) json.RawMessage {
+	if schema := catalogModels.GetValueFromMetadata(service.Metadata, getParametersSchemaMetadataKey(plan.Name)); schema != "" {
+		return json.RawMessage(schema)
+	}
+	return nil
+}
+
+// getParametersSchema returns nil if plan does not declare schema of its parameters
+func getParametersSchema(service catalogModels.Service, plan catalogModels.ServicePlan) (*models.ParametersSchema, error) {
+	rawSchema := getRawParametersSchema(service, plan)
+	if rawSchema == nil {
+		return nil, nil
+	}
+
+	schema := &models.ParametersSchema{}
+	if err := json.Unmarshal(rawSchema, schema); err != nil {
+		return nil, fmt.Errorf("parameters schema of plan %q is not valid JSON: %v", plan.Name, err)
+	}
+	if err := validateParametersSchema(schema); err != nil {
+		return nil, fmt.Errorf("parameters schema of plan %q is invalid: %v", plan.Name, err)
+	}
+	return schema, nil
+}
+
+func validateParametersSchema(schema *models.ParametersSchema) error {
+	if schema.Type != "" && schema.Type != "object" {
+		return fmt.Errorf("type has to be object, got %q", schema.Type)
+	}
+
+	for name, property := range schema.Properties {
+		switch property.Type {
+		case models.ParameterTypeString, models.ParameterTypeInteger, models.ParameterTypeNumber, models.ParameterTypeBoolean:
+		default:
+			return fmt.Errorf("property %s has unsupported type %q", name, property.Type)
+		}
+		if commonHttp.StringInSlice(name, protectedInstanceMetadataKeys) {
+			return fmt.Errorf("property %s is managed by platform", name)
+		}
+		if property.Pattern != "" {
+			if _, err := regexp.Compile(property.Pattern); err != nil {
+				return fmt.Errorf("property %s has invalid pattern: %v", name, err)
+			}
+		}
+		if property.Default != nil {
+			if err := validateParameter(property, formatParameterValue(property.Default)); err != nil {
+				return fmt.Errorf("default of property %s is invalid: %v", name, err)
+			}
+		}
+	}
+
+	for _, name := range schema.Required {
+		if _, ok := schema.Properties[name]; !ok {
+			return fmt.Errorf("required property %s is not defined", name)
+		}
+	}
+	return nil
+}
+
+// validatePlanParameters checks instance metadata against parameters schema of plan
+// and returns metadata holding defaults of parameters which were not given
+func validatePlanParameters(service catalogModels.Service, plan catalogModels.ServicePlan,
+	metadata []catalogModels.Metadata) ([]catalogModels.Metadata, error) {
+
+	schema, err := getParametersSchema(service, plan)
+	if err != nil || schema == nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for name := range schema.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defaults := []catalogModels.Metadata{}
+	problems := []string{}
+	for _, name := range names {
+		property := schema.Properties[name]
+		value := catalogModels.GetValueFromMetadata(metadata, name)
+		if value == "" {
+			if property.Default != nil {
+				defaults = append(defaults, catalogModels.Metadata{Id: name, Value: formatParameterValue(property.Default)})
+			} else if commonHttp.StringInSlice(name, schema.Required) {
+				problems = append(problems, fmt.Sprintf("%s is required", name))
+			}
+			continue
+		}
+		if err := validateParameter(property, value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %v", name, err))
+		}
+	}
+
+	if schema.AdditionalProperties != nil && !*schema.AdditionalProperties {
+		for _, m := range metadata {
+			if _, known := schema.Properties[m.Id]; !known && !commonHttp.StringInSlice(m.Id, protectedInstanceMetadataKeys) {
+				problems = append(problems, fmt.Sprintf("%s is not allowed", m.Id))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("parameters do not match schema of plan %q: %s", plan.Name, strings.Join(problems, ", "))
+	}
+	return defaults, nil
+}
+
+// validateParameter checks value of parameter, which is always stored as string in metadata
+func validateParameter(property models.ParameterSchema, value string) error {
+	switch property.Type {
+	case models.ParameterTypeString:
+		length := utf8.RuneCountInString(value)
+		if property.MinLength != nil && length < *property.MinLength {
+			return fmt.Errorf("has to be at least %d characters long", *property.MinLength)
+		}
+		if property.MaxLength != nil && length > *property.MaxLength {
+			return fmt.Errorf("has to be at most %d characters long", *property.MaxLength)
+		}
+		if property.Pattern != "" {
+			if matched, err := regexp.MatchString(property.Pattern, value); err != nil || !matched {
+				return fmt.Errorf("has to match pattern %q", property.Pattern)
+			}
+		}
+	case models.ParameterTypeInteger, models.ParameterTypeNumber:
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil || (property.Type == models.ParameterTypeInteger && number != float64(int64(number))) {
+			return fmt.Errorf("has to be %s, got %q", property.Type, value)
+		}
+		if property.Minimum != nil && number < *property.Minimum {
+			return fmt.Errorf("has to be greater than or equal to %v", *property.Minimum)
+		}
+		if property.Maximum != nil && number > *property.Maximum {
+			return fmt.Errorf("has to be less than or equal to %v", *property.Maximum)
+		}
+	case models.ParameterTypeBoolean:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("has to be boolean, got %q", value)
+		}
+	}
+
+	if len(property.Enum) > 0 {
+		allowed := []string{}
+		for _, enumValue := range property.Enum {
+			allowed = append(allowed, formatParameterValue(enumValue))
+		}
+		if !commonHttp.StringInSlice(value, allowed) {
+			return fmt.Errorf("has to be one of: %s", strings.Join(allowed, ", "))
+		}
+	}
+	return nil
+}
+
+func formatParameterValue(value interface{}) string {
+	if number, ok := value.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
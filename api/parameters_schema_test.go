@@ -0,0 +1,114 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+const testParametersSchema = `{
+	"type": "object",
+	"properties": {
+		"size": {"type": "string", "enum": ["small", "large"], "default": "small"},
+		"replicas": {"type": "integer", "minimum": 1, "maximum": 5},
+		"name": {"type": "string", "pattern": "^[a-z]+$", "maxLength": 8}
+	},
+	"required": ["replicas"],
+	"additionalProperties": false
+}`
+
+func TestValidatePlanParameters(t *testing.T) {
+	plan := catalogModels.ServicePlan{Id: planID1, Name: planName1}
+	service := catalogModels.Service{Id: serviceID1, Name: serviceName1, Plans: []catalogModels.ServicePlan{plan},
+		Metadata: []catalogModels.Metadata{{Id: getParametersSchemaMetadataKey(planName1), Value: testParametersSchema}}}
+	planMetadata := catalogModels.Metadata{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}
+
+	testCases := []struct {
+		metadata         []catalogModels.Metadata
+		expectedDefaults []catalogModels.Metadata
+		valid            bool
+	}{
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "3"}}, []catalogModels.Metadata{{Id: "size", Value: "small"}}, true},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "1"}, {Id: "size", Value: "large"}, {Id: "name", Value: "db"}},
+			[]catalogModels.Metadata{}, true},
+		{[]catalogModels.Metadata{planMetadata}, nil, false},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "2.5"}}, nil, false},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "6"}}, nil, false},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "1"}, {Id: "size", Value: "medium"}}, nil, false},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "1"}, {Id: "name", Value: "Db"}}, nil, false},
+		{[]catalogModels.Metadata{planMetadata, {Id: "replicas", Value: "1"}, {Id: "unknown", Value: "x"}}, nil, false},
+	}
+
+	Convey("For set of test cases validatePlanParameters should return proper results", t, func() {
+		for i, tc := range testCases {
+			Convey(fmt.Sprintf("For test case %d", i), func() {
+				defaults, err := validatePlanParameters(service, plan, tc.metadata)
+				if tc.valid {
+					So(err, ShouldBeNil)
+					So(defaults, ShouldResemble, tc.expectedDefaults)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			})
+		}
+
+		Convey("Plan without schema should accept any parameters", func() {
+			defaults, err := validatePlanParameters(catalogModels.Service{Plans: []catalogModels.ServicePlan{plan}}, plan,
+				[]catalogModels.Metadata{{Id: "unknown", Value: "x"}})
+			So(err, ShouldBeNil)
+			So(defaults, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestGetParametersSchema(t *testing.T) {
+	plan := catalogModels.ServicePlan{Name: planName1}
+
+	testCases := []struct {
+		schema string
+		valid  bool
+	}{
+		{testParametersSchema, true},
+		{`{"type": "object", "properties": {"size": {"type": "string"}}, "title": "Parameters"}`, true},
+		{`{"type": "array"}`, false},
+		{`{"properties": {"config": {"type": "object"}}}`, false},
+		{`{"properties": {"size": {"type": "string", "pattern": "("}}}`, false},
+		{`{"properties": {"size": {"type": "integer", "default": "small"}}}`, false},
+		{`{"properties": {"PLAN_ID": {"type": "string"}}}`, false},
+		{`{"required": ["size"]}`, false},
+		{`not json`, false},
+	}
+
+	Convey("For set of test cases getParametersSchema should validate stored schema", t, func() {
+		for i, tc := range testCases {
+			Convey(fmt.Sprintf("For test case %d", i), func() {
+				service := catalogModels.Service{Metadata: []catalogModels.Metadata{{Id: getParametersSchemaMetadataKey(planName1), Value: tc.schema}}}
+				_, err := getParametersSchema(service, plan)
+				if tc.valid {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,238 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// permissionAuthenticated marks routes available to every user granted any permission
+const permissionAuthenticated models.Permission = ""
+
+var allPermissions = []models.Permission{
+	models.PermissionPlatformRead,
+	models.PermissionOfferingsRead,
+	models.PermissionOfferingsWrite,
+	models.PermissionOfferingsApplicationWrite,
+	models.PermissionApplicationsRead,
+	models.PermissionApplicationsWrite,
+	models.PermissionApplicationsExec,
+	models.PermissionServicesRead,
+	models.PermissionServicesWrite,
+	models.PermissionServicesExec,
+	models.PermissionServicesCredentialsRead,
+	models.PermissionOrganizationsRead,
+	models.PermissionOrganizationsWrite,
+	models.PermissionUsersRead,
+	models.PermissionUsersDelete,
+	models.PermissionUsersInvite,
+	models.PermissionUsersInvitationsManage,
+	models.PermissionMetricsRead,
+	models.PermissionEventsRead,
+	models.PermissionOperationsRead,
+	models.PermissionQuotasRead,
+	models.PermissionAuditRead,
+	models.PermissionOrphansRead,
+	models.PermissionOrphansDelete,
+	models.PermissionServiceAccountsManage,
+	models.PermissionAllResourcesManage,
+}
+
+// defaultAccessPolicy keeps split between tap.admin and tap.user groups used before policies were configurable
+var defaultAccessPolicy = models.AccessPolicy{Roles: []models.AccessPolicyRole{
+	{Scopes: []string{adminGroup}, Permissions: []models.Permission{models.PermissionAll}},
+	{Scopes: []string{userGroup}, Permissions: []models.Permission{
+		models.PermissionPlatformRead,
+		models.PermissionOfferingsRead,
+		models.PermissionOfferingsApplicationWrite,
+		"applications.*",
+		"services.*",
+		models.PermissionOrganizationsRead,
+		models.PermissionUsersRead,
+		models.PermissionUsersDelete,
+		models.PermissionUsersInvitationsManage,
+		models.PermissionMetricsRead,
+		models.PermissionEventsRead,
+		models.PermissionOperationsRead,
+		models.PermissionQuotasRead,
+	}},
+}}
+
+// routePermissions holds permission required by each route, keyed by method and path relative to API version prefix
+var routePermissions = map[string]models.Permission{}
+
+// permissionRouter registers routes together with permissions required to call them
+type permissionRouter struct {
+	router *web.Router
+}
+
+func (r permissionRouter) Get(path string, permission models.Permission, fn interface{}) {
+	r.register(http.MethodGet, path, permission)
+	r.router.Get(path, fn)
+}
+
+func (r permissionRouter) Post(path string, permission models.Permission, fn interface{}) {
+	r.register(http.MethodPost, path, permission)
+	r.router.Post(path, fn)
+}
+
+func (r permissionRouter) Put(path string, permission models.Permission, fn interface{}) {
+	r.register(http.MethodPut, path, permission)
+	r.router.Put(path, fn)
+}
+
+func (r permissionRouter) Patch(path string, permission models.Permission, fn interface{}) {
+	r.register(http.MethodPatch, path, permission)
+	r.router.Patch(path, fn)
+}
+
+func (r permissionRouter) Delete(path string, permission models.Permission, fn interface{}) {
+	r.register(http.MethodDelete, path, permission)
+	r.router.Delete(path, fn)
+}
+
+func (r permissionRouter) register(method, path string, permission models.Permission) {
+	routePermissions[getRouteKey(method, path)] = permission
+}
+
+func getRouteKey(method, path string) string {
+	return method + " " + path
+}
+
+// getRoutePermission returns permission required by route matched for request.
+// Routes are registered under several /api/<version> aliases, so the alias is stripped.
+func getRoutePermission(req *web.Request) (models.Permission, bool) {
+	_, path := splitApiAlias(req.RoutePath())
+	permission, found := routePermissions[getRouteKey(req.Method, path)]
+	return permission, found
+}
+
+// LoadAccessPolicy reads policy from JSON file. Default policy is returned if path is empty.
+func LoadAccessPolicy(path string) (*models.AccessPolicy, error) {
+	if path == "" {
+		return &defaultAccessPolicy, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	policy := &models.AccessPolicy{}
+	if err := json.Unmarshal(content, policy); err != nil {
+		return nil, fmt.Errorf("access policy %s is not valid JSON: %v", path, err)
+	}
+	if err := validateAccessPolicy(policy); err != nil {
+		return nil, fmt.Errorf("access policy %s is invalid: %v", path, err)
+	}
+	return policy, nil
+}
+
+func validateAccessPolicy(policy *models.AccessPolicy) error {
+	for i, role := range policy.Roles {
+		if len(role.Scopes) == 0 {
+			return fmt.Errorf("role %d has no scopes", i)
+		}
+		for _, pattern := range role.Permissions {
+			if len(expandPermission(pattern)) == 0 {
+				return fmt.Errorf("role %d grants unknown permission %q", i, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+func getAccessPolicy() *models.AccessPolicy {
+	if BrokerConfig.AccessPolicy != nil {
+		return BrokerConfig.AccessPolicy
+	}
+	return &defaultAccessPolicy
+}
+
+// getGrantedPermissions returns sorted permissions granted by policy to user having given scopes
+func getGrantedPermissions(policy *models.AccessPolicy, scopes []string) []models.Permission {
+	granted := map[models.Permission]bool{}
+	for _, role := range policy.Roles {
+		if !hasRole(scopes, role.Scopes) {
+			continue
+		}
+		for _, pattern := range role.Permissions {
+			for _, permission := range expandPermission(pattern) {
+				granted[permission] = true
+			}
+		}
+	}
+
+	names := []string{}
+	for permission := range granted {
+		names = append(names, string(permission))
+	}
+	sort.Strings(names)
+
+	result := []models.Permission{}
+	for _, name := range names {
+		result = append(result, models.Permission(name))
+	}
+	return result
+}
+
+func expandPermission(pattern models.Permission) []models.Permission {
+	result := []models.Permission{}
+	for _, permission := range allPermissions {
+		if permissionMatches(pattern, permission) {
+			result = append(result, permission)
+		}
+	}
+	return result
+}
+
+func permissionMatches(pattern, permission models.Permission) bool {
+	if pattern == models.PermissionAll || pattern == permission {
+		return true
+	}
+	if strings.HasSuffix(string(pattern), ".*") {
+		return strings.HasPrefix(string(permission), strings.TrimSuffix(string(pattern), "*"))
+	}
+	return false
+}
+
+func hasPermission(permissions []models.Permission, permission models.Permission) bool {
+	for _, granted := range permissions {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) GetCurrentUserPermissions(rw web.ResponseWriter, req *web.Request) {
+	response := models.UserPermissions{Username: c.Username, Scopes: c.Scopes, Permissions: c.Permissions}
+	if c.Permissions == nil {
+		// OAuth2 is not enabled, so caller has full access
+		response.Permissions = allPermissions
+	}
+	commonHttp.WriteJson(rw, response, http.StatusOK)
+}
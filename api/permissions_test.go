@@ -0,0 +1,150 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const teamLeadScope = "tap.team_lead"
+
+var teamLeadPolicy = models.AccessPolicy{Roles: append(defaultAccessPolicy.Roles, models.AccessPolicyRole{
+	Scopes:      []string{teamLeadScope},
+	Permissions: []models.Permission{models.PermissionUsersInvite, "users.invitations.*"},
+})}
+
+func TestGetGrantedPermissions(t *testing.T) {
+	Convey("Test getGrantedPermissions", t, func() {
+		Convey("admin should be granted all permissions", func() {
+			So(getGrantedPermissions(&defaultAccessPolicy, []string{adminGroup}), ShouldHaveLength, len(allPermissions))
+		})
+
+		Convey("user should be granted permissions matching wildcards, but not admin ones", func() {
+			permissions := getGrantedPermissions(&defaultAccessPolicy, []string{userGroup})
+			So(permissions, ShouldContain, models.PermissionServicesCredentialsRead)
+			So(permissions, ShouldContain, models.PermissionApplicationsExec)
+			So(permissions, ShouldNotContain, models.PermissionUsersInvite)
+			So(permissions, ShouldNotContain, models.PermissionAllResourcesManage)
+		})
+
+		Convey("permissions of all matching roles should be merged", func() {
+			permissions := getGrantedPermissions(&teamLeadPolicy, []string{userGroup, teamLeadScope})
+			So(permissions, ShouldContain, models.PermissionUsersInvite)
+			So(permissions, ShouldContain, models.PermissionServicesRead)
+		})
+
+		Convey("user without known scopes should be granted nothing", func() {
+			So(getGrantedPermissions(&defaultAccessPolicy, []string{"other.scope"}), ShouldBeEmpty)
+		})
+	})
+}
+
+func TestLoadAccessPolicy(t *testing.T) {
+	writePolicy := func(content string) string {
+		file, _ := ioutil.TempFile("", "access_policy")
+		file.WriteString(content)
+		file.Close()
+		return file.Name()
+	}
+
+	Convey("Test LoadAccessPolicy", t, func() {
+		Convey("When path is empty default policy should be returned", func() {
+			policy, err := LoadAccessPolicy("")
+			So(err, ShouldBeNil)
+			So(*policy, ShouldResemble, defaultAccessPolicy)
+		})
+
+		Convey("When policy is valid it should be loaded", func() {
+			path := writePolicy(`{"roles": [{"scopes": ["tap.team_lead"], "permissions": ["users.invite"]}]}`)
+			defer os.Remove(path)
+
+			policy, err := LoadAccessPolicy(path)
+			So(err, ShouldBeNil)
+			So(policy.Roles, ShouldHaveLength, 1)
+		})
+
+		Convey("When policy grants unknown permission error should be returned", func() {
+			path := writePolicy(`{"roles": [{"scopes": ["tap.team_lead"], "permissions": ["users.promote"]}]}`)
+			defer os.Remove(path)
+
+			_, err := LoadAccessPolicy(path)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestPermissionsMiddleware(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	authorization := fmt.Sprintf("bearer %s", testToken)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("Authorization", authorization)
+
+	Convey("Given access policy with team lead role", t, func() {
+		BrokerConfig.AccessPolicy = &teamLeadPolicy
+		teamLeadToken := uaa_connector.TapJWTToken{Username: "lead", Scope: []string{userGroup, teamLeadScope}}
+
+		Convey("team lead should be able to invite users", func() {
+			mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&teamLeadToken, nil)
+			mocksAndRouter.userManagementApiFactoryMock.EXPECT().GetConfiguredUserManagementConnector(authorization).
+				Return(mocksAndRouter.userManagementApiMock)
+			mocksAndRouter.userManagementApiMock.EXPECT().InviteUser(fakeEmail).
+				Return(&user_management_connector.InvitationResponse{}, 0, nil)
+
+			response := commonHttp.SendRequestWithHeaders("POST", adminAllowedUrl, []byte(fakeEmailJsonBody), mocksAndRouter.router, header, t)
+			So(response.Code, ShouldEqual, http.StatusCreated)
+		})
+
+		Convey("team lead should not be able to create organizations", func() {
+			mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&teamLeadToken, nil)
+
+			response := commonHttp.SendRequestWithHeaders("POST", "/api/v3/organizations", []byte(`{"name": "org"}`), mocksAndRouter.router, header, t)
+			So(response.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("team lead should get own permissions", func() {
+			mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&teamLeadToken, nil)
+
+			response := commonHttp.SendRequestWithHeaders("GET", "/api/v1/users/current/permissions", nil, mocksAndRouter.router, header, t)
+			So(response.Code, ShouldEqual, http.StatusOK)
+
+			permissions := models.UserPermissions{}
+			So(json.Unmarshal(response.Body.Bytes(), &permissions), ShouldBeNil)
+			So(permissions.Username, ShouldEqual, "lead")
+			So(permissions.Permissions, ShouldContain, models.PermissionUsersInvite)
+			So(permissions.Permissions, ShouldNotContain, models.PermissionOrganizationsWrite)
+		})
+
+		Reset(func() {
+			BrokerConfig.AccessPolicy = nil
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,388 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+// quota limits set to 0 are not enforced. *_BY_PLAN limits are comma separated <offering name>/<plan name>=<limit>
+// entries, plans which are not listed there are limited by *_PER_PLAN value.
+const (
+	QuotaMaxReplicasPerApplication        = "QUOTA_MAX_REPLICAS_PER_APPLICATION"
+	QuotaMaxReplicasPerApplicationDefault = 5
+
+	UserQuotaMaxApplications                    = "USER_QUOTA_MAX_APPLICATIONS"
+	UserQuotaMaxServiceInstancesPerPlan         = "USER_QUOTA_MAX_SERVICE_INSTANCES_PER_PLAN"
+	UserQuotaMaxServiceInstancesByPlan          = "USER_QUOTA_MAX_SERVICE_INSTANCES_BY_PLAN"
+	UserQuotaMaxReplicas                        = "USER_QUOTA_MAX_REPLICAS"
+	UserQuotaMaxMemory                          = "USER_QUOTA_MAX_MEMORY_MB"
+	OrganizationQuotaMaxApplications            = "ORGANIZATION_QUOTA_MAX_APPLICATIONS"
+	OrganizationQuotaMaxServiceInstancesPerPlan = "ORGANIZATION_QUOTA_MAX_SERVICE_INSTANCES_PER_PLAN"
+	OrganizationQuotaMaxServiceInstancesByPlan  = "ORGANIZATION_QUOTA_MAX_SERVICE_INSTANCES_BY_PLAN"
+	OrganizationQuotaMaxReplicas                = "ORGANIZATION_QUOTA_MAX_REPLICAS"
+	OrganizationQuotaMaxMemory                  = "ORGANIZATION_QUOTA_MAX_MEMORY_MB"
+)
+
+func getMaxReplicasPerApplication() int {
+	value, _ := util.GetUint32EnvValueOrDefault(QuotaMaxReplicasPerApplication, QuotaMaxReplicasPerApplicationDefault)
+	return int(value)
+}
+
+func getQuotaLimits(applications, serviceInstancesPerPlan, serviceInstancesByPlan, replicas, memory string) models.QuotaLimits {
+	get := func(name string) int {
+		value, _ := util.GetUint32EnvValueOrDefault(name, 0)
+		return int(value)
+	}
+	return models.QuotaLimits{
+		Applications:            get(applications),
+		ServiceInstancesPerPlan: get(serviceInstancesPerPlan),
+		ServiceInstancesByPlan:  parsePlanQuotaLimits(serviceInstancesByPlan),
+		Replicas:                get(replicas),
+		MemoryMB:                get(memory),
+	}
+}
+
+// parsePlanQuotaLimits skips invalid entries, so single typo does not disable all of the limits
+func parsePlanQuotaLimits(name string) []models.PlanQuotaLimit {
+	result := []models.PlanQuotaLimit{}
+	for _, entry := range strings.Split(os.Getenv(name), ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(entry, "=")
+		names := []string{}
+		if separator > 0 {
+			names = strings.SplitN(entry[:separator], "/", 2)
+		}
+		if len(names) != 2 || names[0] == "" || names[1] == "" {
+			logger.Warningf("Entry %q of %s skipped: expected <offering name>/<plan name>=<limit>", entry, name)
+			continue
+		}
+		limit, err := strconv.ParseUint(strings.TrimSpace(entry[separator+1:]), 10, 32)
+		if err != nil {
+			logger.Warningf("Entry %q of %s skipped: invalid limit: %v", entry, name, err)
+			continue
+		}
+
+		result = append(result, models.PlanQuotaLimit{
+			OfferingName: strings.TrimSpace(names[0]),
+			PlanName:     strings.TrimSpace(names[1]),
+			Limit:        int(limit),
+		})
+	}
+	return result
+}
+
+func getUserQuotaLimits() models.QuotaLimits {
+	return getQuotaLimits(UserQuotaMaxApplications, UserQuotaMaxServiceInstancesPerPlan, UserQuotaMaxServiceInstancesByPlan,
+		UserQuotaMaxReplicas, UserQuotaMaxMemory)
+}
+
+func getOrganizationQuotaLimits() models.QuotaLimits {
+	return getQuotaLimits(OrganizationQuotaMaxApplications, OrganizationQuotaMaxServiceInstancesPerPlan,
+		OrganizationQuotaMaxServiceInstancesByPlan, OrganizationQuotaMaxReplicas, OrganizationQuotaMaxMemory)
+}
+
+func isAnyQuotaLimitSet(limits models.QuotaLimits) bool {
+	for _, planLimit := range limits.ServiceInstancesByPlan {
+		if planLimit.Limit > 0 {
+			return true
+		}
+	}
+	return limits.Applications > 0 || limits.ServiceInstancesPerPlan > 0 || limits.Replicas > 0 || limits.MemoryMB > 0
+}
+
+// getServiceInstancesLimit returns limit configured for plan of offering, or limit of every plan if there is none
+func getServiceInstancesLimit(limits models.QuotaLimits, offeringName, planName string) int {
+	for _, planLimit := range limits.ServiceInstancesByPlan {
+		if planLimit.OfferingName == offeringName && planLimit.PlanName == planName {
+			return planLimit.Limit
+		}
+	}
+	return limits.ServiceInstancesPerPlan
+}
+
+// quotaRequest describes resources which will be additionally used after request is executed
+type quotaRequest struct {
+	applications     int
+	serviceInstances int
+	offeringId       string
+	offeringName     string
+	planId           string
+	planName         string
+	replicas         int
+	memoryMB         int
+}
+
+func (r quotaRequest) add(other quotaRequest) quotaRequest {
+	r.applications += other.applications
+	r.replicas += other.replicas
+	r.memoryMB += other.memoryMB
+	return r
+}
+
+func applicationQuotaRequest(manifest *models.Manifest) (quotaRequest, error) {
+	memory := manifest.Memory
+	if memory == "" {
+		memory = apiApplicationInstanceMemoryDefault
+	}
+	memoryPerReplica, err := parseMemoryInMB(memory)
+	if err != nil {
+		return quotaRequest{}, err
+	}
+	return quotaRequest{applications: 1, replicas: manifest.Instances, memoryMB: manifest.Instances * memoryPerReplica}, nil
+}
+
+func scaleQuotaRequest(application catalogModels.Application, replicas int) (quotaRequest, error) {
+	memoryPerReplica, err := getApplicationMemoryPerReplicaInMB(application.Metadata)
+	if err != nil {
+		return quotaRequest{}, err
+	}
+	delta := replicas - application.Replication
+	return quotaRequest{replicas: delta, memoryMB: delta * memoryPerReplica}, nil
+}
+
+// memoryChangeQuotaRequest returns memory which will be additionally used when replicas get new memory limit
+func memoryChangeQuotaRequest(application catalogModels.Application, memory string) (quotaRequest, error) {
+	currentMemoryPerReplica, err := getApplicationMemoryPerReplicaInMB(application.Metadata)
+	if err != nil {
+		return quotaRequest{}, err
+	}
+	if memory == "" {
+		memory = apiApplicationInstanceMemoryDefault
+	}
+	memoryPerReplica, err := parseMemoryInMB(memory)
+	if err != nil {
+		return quotaRequest{}, err
+	}
+	return quotaRequest{memoryMB: application.Replication * (memoryPerReplica - currentMemoryPerReplica)}, nil
+}
+
+func serviceInstanceQuotaRequest(offering catalogModels.Service, plan catalogModels.ServicePlan) quotaRequest {
+	return quotaRequest{serviceInstances: 1, offeringId: offering.Id, offeringName: offering.Name, planId: plan.Id, planName: plan.Name}
+}
+
+func getApplicationMemoryPerReplicaInMB(metadata []catalogModels.Metadata) (int, error) {
+	return parseMemoryInMB(getApplicationMemory(metadata))
+}
+
+type quotaScope struct {
+	scope    models.QuotaScope
+	id       string
+	limits   models.QuotaLimits
+	contains func(auditTrail catalogModels.AuditTrail, metadata []catalogModels.Metadata) bool
+}
+
+// quotas are not applied to user when OAuth2 middleware is not activated
+func (c *Context) getQuotaScopes() []quotaScope {
+	scopes := []quotaScope{}
+	if c.Username != "" {
+		scopes = append(scopes, quotaScope{
+			scope:  models.QuotaScopeUser,
+			id:     c.Username,
+			limits: getUserQuotaLimits(),
+			contains: func(auditTrail catalogModels.AuditTrail, metadata []catalogModels.Metadata) bool {
+				return auditTrail.CreatedBy == c.Username
+			},
+		})
+	}
+	if c.Organization != "" {
+		scopes = append(scopes, quotaScope{
+			scope:  models.QuotaScopeOrganization,
+			id:     c.Organization,
+			limits: getOrganizationQuotaLimits(),
+			contains: func(auditTrail catalogModels.AuditTrail, metadata []catalogModels.Metadata) bool {
+				return c.getOrganization(metadata) == c.Organization
+			},
+		})
+	}
+	return scopes
+}
+
+func (c *Context) areQuotasEnabled() bool {
+	for _, scope := range c.getQuotaScopes() {
+		if isAnyQuotaLimitSet(scope.limits) {
+			return true
+		}
+	}
+	return false
+}
+
+type quotaUsageSource struct {
+	applications []catalogModels.Application
+	instances    []catalogModels.Instance
+}
+
+func fetchQuotaUsageSource() (quotaUsageSource, int, error) {
+	applications, status, err := BrokerConfig.CatalogApi.ListApplications(nil)
+	if err != nil {
+		return quotaUsageSource{}, status, fmt.Errorf("cannot fetch applications from Catalog: %v", err)
+	}
+	instances, status, err := BrokerConfig.CatalogApi.ListServicesInstances()
+	if err != nil {
+		return quotaUsageSource{}, status, fmt.Errorf("cannot fetch service instances from Catalog: %v", err)
+	}
+	return quotaUsageSource{applications: applications, instances: instances}, http.StatusOK, nil
+}
+
+func (s quotaScope) getUsage(source quotaUsageSource) (models.QuotaUsage, error) {
+	usage := models.QuotaUsage{ServiceInstances: []models.PlanUsage{}}
+
+	for _, application := range source.applications {
+		if s.contains(application.AuditTrail, application.Metadata) {
+			memoryPerReplica, err := getApplicationMemoryPerReplicaInMB(application.Metadata)
+			if err != nil {
+				return usage, err
+			}
+			usage.Applications++
+			usage.Replicas += application.Replication
+			usage.MemoryMB += application.Replication * memoryPerReplica
+		}
+	}
+
+	for _, instance := range source.instances {
+		if instance.Type != catalogModels.InstanceTypeService || !s.contains(instance.AuditTrail, instance.Metadata) {
+			continue
+		}
+		planId := catalogModels.GetValueFromMetadata(instance.Metadata, catalogModels.OFFERING_PLAN_ID)
+		usage.ServiceInstances = addPlanUsage(usage.ServiceInstances, instance.ClassId, planId)
+	}
+	return usage, nil
+}
+
+func addPlanUsage(usages []models.PlanUsage, offeringId, planId string) []models.PlanUsage {
+	for i := range usages {
+		if usages[i].OfferingId == offeringId && usages[i].PlanId == planId {
+			usages[i].Count++
+			return usages
+		}
+	}
+	return append(usages, models.PlanUsage{OfferingId: offeringId, PlanId: planId, Count: 1})
+}
+
+func getPlanUsage(usages []models.PlanUsage, offeringId, planId string) int {
+	for _, usage := range usages {
+		if usage.OfferingId == offeringId && usage.PlanId == planId {
+			return usage.Count
+		}
+	}
+	return 0
+}
+
+func (s quotaScope) check(usage models.QuotaUsage, request quotaRequest) *models.QuotaExceededResponse {
+	checks := []struct {
+		resource  models.QuotaResource
+		limit     int
+		usage     int
+		requested int
+	}{
+		{models.QuotaResourceApplications, s.limits.Applications, usage.Applications, request.applications},
+		{models.QuotaResourceServiceInstancesPerPlan, getServiceInstancesLimit(s.limits, request.offeringName, request.planName),
+			getPlanUsage(usage.ServiceInstances, request.offeringId, request.planId), request.serviceInstances},
+		{models.QuotaResourceReplicas, s.limits.Replicas, usage.Replicas, request.replicas},
+		{models.QuotaResourceMemory, s.limits.MemoryMB, usage.MemoryMB, request.memoryMB},
+	}
+
+	for _, check := range checks {
+		if check.limit > 0 && check.requested > 0 && check.usage+check.requested > check.limit {
+			return &models.QuotaExceededResponse{
+				Message: fmt.Sprintf("%s quota of %s %q exceeded: limit %d, used %d, requested %d",
+					check.resource, s.scope, s.id, check.limit, check.usage, check.requested),
+				Scope:     s.scope,
+				Id:        s.id,
+				Resource:  check.resource,
+				Limit:     check.limit,
+				Usage:     check.usage,
+				Requested: check.requested,
+			}
+		}
+	}
+	return nil
+}
+
+// respondIfQuotaExceeded writes 403 with details of exceeded quota and returns true if request cannot be executed
+func (c *Context) respondIfQuotaExceeded(rw web.ResponseWriter, request quotaRequest) bool {
+	if !c.areQuotasEnabled() {
+		return false
+	}
+
+	source, status, err := fetchQuotaUsageSource()
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return true
+	}
+
+	for _, scope := range c.getQuotaScopes() {
+		usage, err := scope.getUsage(source)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return true
+		}
+		if exceeded := scope.check(usage, request); exceeded != nil {
+			logger.Infof("Request of user %q rejected: %s", c.Username, exceeded.Message)
+			commonHttp.WriteJson(rw, exceeded, http.StatusForbidden)
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Context) GetQuotas(rw web.ResponseWriter, req *web.Request) {
+	source, status, err := fetchQuotaUsageSource()
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	response := models.QuotasResponse{
+		MaxReplicasPerApplication: getMaxReplicasPerApplication(),
+		Quotas:                    []models.Quota{},
+	}
+	for _, scope := range c.getQuotaScopes() {
+		usage, err := scope.getUsage(source)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return
+		}
+		response.Quotas = append(response.Quotas, models.Quota{Scope: scope.scope, Id: scope.id, Limits: scope.limits, Usage: usage})
+	}
+	commonHttp.WriteJson(rw, response, http.StatusOK)
+}
+
+func limitInstanceNumber(instances int) error {
+	if maxReplicas := getMaxReplicasPerApplication(); instances > maxReplicas {
+		return fmt.Errorf("Maximum allowed replication is %d", maxReplicas)
+	}
+	if instances < 0 {
+		return errors.New("Minimum allowed replication is 0")
+	}
+	return nil
+}
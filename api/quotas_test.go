@@ -0,0 +1,144 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func TestQuotaScopeCheck(t *testing.T) {
+	offering1 := catalogModels.Service{Id: serviceID1, Name: "offering1"}
+	offering2 := catalogModels.Service{Id: serviceID2, Name: "offering2"}
+	plan1 := catalogModels.ServicePlan{Id: planID1, Name: "plan1"}
+	plan2 := catalogModels.ServicePlan{Id: planID2, Name: "plan2"}
+
+	scope := quotaScope{
+		scope: models.QuotaScopeUser,
+		id:    ownerUsername,
+		limits: models.QuotaLimits{
+			Applications:            2,
+			ServiceInstancesPerPlan: 1,
+			ServiceInstancesByPlan:  []models.PlanQuotaLimit{{OfferingName: offering2.Name, PlanName: plan1.Name, Limit: 2}},
+			Replicas:                4,
+		},
+	}
+	usage := models.QuotaUsage{
+		Applications: 1,
+		ServiceInstances: []models.PlanUsage{
+			{OfferingId: serviceID1, PlanId: planID1, Count: 1},
+			{OfferingId: serviceID2, PlanId: planID1, Count: 1},
+		},
+		Replicas: 3,
+		MemoryMB: 768,
+	}
+
+	testCases := []struct {
+		request          quotaRequest
+		exceededResource models.QuotaResource
+	}{
+		{quotaRequest{applications: 1, replicas: 1}, ""},
+		{quotaRequest{applications: 1, replicas: 2}, models.QuotaResourceReplicas},
+		{quotaRequest{replicas: -2}, ""},
+		{serviceInstanceQuotaRequest(offering1, plan2), ""},
+		{serviceInstanceQuotaRequest(offering1, plan1), models.QuotaResourceServiceInstancesPerPlan},
+		{serviceInstanceQuotaRequest(offering2, plan1), ""},
+		{quotaRequest{memoryMB: 10000}, ""},
+	}
+
+	Convey("For set of test cases quota check should return proper result", t, func() {
+		for _, tc := range testCases {
+			Convey(fmt.Sprintf("For request %+v exceeded resource should be %q", tc.request, tc.exceededResource), func() {
+				result := scope.check(usage, tc.request)
+				if tc.exceededResource == "" {
+					So(result, ShouldBeNil)
+				} else {
+					So(result, ShouldNotBeNil)
+					So(result.Resource, ShouldEqual, tc.exceededResource)
+					So(result.Scope, ShouldEqual, models.QuotaScopeUser)
+				}
+			})
+		}
+	})
+}
+
+func TestGetQuotas(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	userToken := uaa_connector.TapJWTToken{Username: ownerUsername, Scope: []string{userGroup}}
+
+	Convey("Test GET /quotas", t, func() {
+		os.Setenv(UserQuotaMaxApplications, "3")
+		os.Setenv(UserQuotaMaxServiceInstancesByPlan, "offering1/plan1=2")
+
+		applications := []catalogModels.Application{
+			{Id: applicationID1, Replication: 2, AuditTrail: catalogModels.AuditTrail{CreatedBy: ownerUsername}},
+			{Id: "other", Replication: 1, AuditTrail: catalogModels.AuditTrail{CreatedBy: otherUsername}},
+		}
+		mocksAndRouter.catalogApiMock.EXPECT().ListApplications(nil).Return(applications, http.StatusOK, nil)
+		mocksAndRouter.catalogApiMock.EXPECT().ListServicesInstances().Return(getTestOwnedInstances(), http.StatusOK, nil)
+
+		response := sendWithToken("GET", fmt.Sprintf("/api/%s/quotas", apiPrefix), "", userToken, mocksAndRouter, t)
+
+		Convey("limits and usage of current user should be returned", func() {
+			So(response.Code, ShouldEqual, http.StatusOK)
+			result := models.QuotasResponse{}
+			readAndAssertJson(response, &result)
+			So(result.MaxReplicasPerApplication, ShouldEqual, QuotaMaxReplicasPerApplicationDefault)
+			So(result.Quotas, ShouldNotBeEmpty)
+
+			userQuota := result.Quotas[0]
+			So(userQuota.Scope, ShouldEqual, models.QuotaScopeUser)
+			So(userQuota.Limits.Applications, ShouldEqual, 3)
+			So(userQuota.Limits.ServiceInstancesByPlan, ShouldResemble, []models.PlanQuotaLimit{{OfferingName: "offering1", PlanName: "plan1", Limit: 2}})
+			So(userQuota.Usage.Applications, ShouldEqual, 1)
+			So(userQuota.Usage.Replicas, ShouldEqual, 2)
+			So(userQuota.Usage.MemoryMB, ShouldEqual, 512)
+			So(userQuota.Usage.ServiceInstances, ShouldResemble, []models.PlanUsage{{OfferingId: serviceID1, PlanId: planID1, Count: 1}})
+		})
+
+		Reset(func() {
+			os.Unsetenv(UserQuotaMaxApplications)
+			os.Unsetenv(UserQuotaMaxServiceInstancesByPlan)
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestParsePlanQuotaLimits(t *testing.T) {
+	Convey("Given limits of plans with invalid entries", t, func() {
+		os.Setenv(UserQuotaMaxServiceInstancesByPlan, "postgresql/free=1, mysql/premium = 3,broken,redis/=2,mongo/small=abc")
+		defer os.Unsetenv(UserQuotaMaxServiceInstancesByPlan)
+
+		limits := getUserQuotaLimits()
+
+		Convey("only valid entries should be returned", func() {
+			So(limits.ServiceInstancesByPlan, ShouldResemble, []models.PlanQuotaLimit{
+				{OfferingName: "postgresql", PlanName: "free", Limit: 1},
+				{OfferingName: "mysql", PlanName: "premium", Limit: 3},
+			})
+			So(isAnyQuotaLimitSet(limits), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,346 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/gocraft/web"
+	"github.com/twinj/uuid"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+func generateApplicationVersion() string {
+	return uuid.NewV4().String()[:8]
+}
+
+// startApplicationVersionSwitch is a variable, so tests can run the switch synchronously
+var startApplicationVersionSwitch = func(applicationId string) {
+	go completeApplicationVersionSwitch(applicationId)
+}
+
+func (c *Context) RedeployApplication(rw web.ResponseWriter, req *web.Request) {
+	applicationId := req.PathParams["applicationId"]
+
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	if err = req.ParseMultipartForm(defaultMaxMemory); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	manifest, err := c.getValidatedParsedManifest(req)
+	if err != nil {
+		commonHttp.Respond400(rw, getValidatedParsedManifestReadableError(err))
+		return
+	}
+
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	if manifest.Name != application.Name {
+		commonHttp.Respond400(rw, fmt.Errorf("manifest name %q does not match application name %q", manifest.Name, application.Name))
+		return
+	}
+
+	instances, status, err := BrokerConfig.CatalogApi.ListApplicationInstances(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	if len(instances) == 0 {
+		commonHttp.GenericRespond(http.StatusConflict, rw, fmt.Errorf("application %q has no instance to redeploy", applicationId))
+		return
+	}
+
+	blob, handler, err := req.FormFile(getManifestBlobField(manifest))
+	if err != nil {
+		commonHttp.Respond400(rw, fmt.Errorf("failed to read %s: %v", getManifestBlobField(manifest), err))
+		return
+	}
+	defer blob.Close()
+	logger.Infof("Read %v", handler.Filename)
+
+	versionId := generateApplicationVersion()
+	version := applicationVersionRecord{
+		Version:   versionId,
+		ImageId:   getApplicationVersionImageId(applicationId, versionId),
+		CreatedOn: time.Now().Unix(),
+		CreatedBy: c.Username,
+	}
+
+	s := newSaga(fmt.Sprintf("redeploy of application %s", applicationId))
+	defer s.rollbackUnlessCommitted()
+
+	if status, err = beginApplicationVersionSwitch(s, application, version, c.Username); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	if status, err = c.buildApplicationVersionImage(s, version, manifest.ImageType, blob); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	s.commit()
+
+	startApplicationVersionSwitch(applicationId)
+
+	operationId := startOperation(rw, req, c.Username, models.OperationTypeRedeploy, models.OperationTargetApplication, applicationId,
+		applicationVersionSwitchedCheck(applicationId, version.Version))
+	respondAccepted(rw, timeout, applicationVersionSwitchedCondition(applicationId, version.Version), operationId)
+}
+
+// beginApplicationVersionSwitch marks version as pending in application metadata, so the switch is resumed after restart.
+// Image application currently runs is left untouched, it is replaced only when image of pending version is ready.
+func beginApplicationVersionSwitch(s *saga, application catalogModels.Application, pending applicationVersionRecord, username string) (int, error) {
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if versions.Pending != nil {
+		return http.StatusConflict, fmt.Errorf("application %q is already being switched to version %q", application.Id, versions.Pending.Version)
+	}
+
+	status, err := updateApplicationVersions(application.Id, username, func(versions *applicationVersions) {
+		versions.Pending = &pending
+		versions.RequestedBy = username
+	})
+	if err != nil {
+		return status, fmt.Errorf("cannot mark version %q of application %q as pending: %v", pending.Version, application.Id, err)
+	}
+	s.onRollback("clear pending version", clearPendingApplicationVersion(application.Id, username))
+	return http.StatusAccepted, nil
+}
+
+// buildApplicationVersionImage adds separate image for pushed version and stores its blob, so image can be built
+func (c *Context) buildApplicationVersionImage(s *saga, version applicationVersionRecord, imageType catalogModels.ImageType, blob multipart.File) (int, error) {
+	image := catalogModels.Image{
+		Id:         version.ImageId,
+		Type:       imageType,
+		BlobType:   catalogModels.BlobTypeTarGz,
+		AuditTrail: c.getAuditTrail(),
+	}
+	if _, status, err := BrokerConfig.CatalogApi.AddImage(image); err != nil {
+		return status, fmt.Errorf("cannot add image %q to Catalog: %v", version.ImageId, err)
+	}
+	s.onRollback("delete image "+version.ImageId, deleteImageFromCatalog(version.ImageId))
+
+	if err := BrokerConfig.BlobStoreApi.StoreBlob(version.ImageId, blob); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot store blob %q in Blob Store: %v", version.ImageId, err)
+	}
+	s.onRollback("delete blob "+version.ImageId, deleteBlobFromBlobStore(version.ImageId))
+
+	if _, err := updateImageState(version.ImageId, catalogModels.ImageStatePending, c.Username); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusAccepted, nil
+}
+
+// completeApplicationVersionSwitch waits until image of pending version is ready, then points application to it and
+// restarts application instance, so bindings, metadata and exposure of the application are kept. If the switch fails,
+// application keeps running image of current version and image of pushed version is removed.
+func completeApplicationVersionSwitch(applicationId string) {
+	application, _, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		logger.Errorf("Cannot fetch application %q to complete its version switch: %v", applicationId, err)
+		return
+	}
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		logger.Errorf("Cannot complete version switch: %v", err)
+		return
+	}
+	if versions.Pending == nil {
+		return
+	}
+	pending := *versions.Pending
+	username := versions.RequestedBy
+
+	s := newSaga(fmt.Sprintf("switch of application %s to version %s", applicationId, pending.Version))
+	defer s.rollbackUnlessCommitted()
+
+	s.onRollback("clear pending version", clearPendingApplicationVersion(applicationId, username))
+	if _, retained := versions.find(pending.Version); !retained {
+		s.onRollback("delete image of version "+pending.Version, func() error {
+			deleteApplicationVersionImage(pending)
+			return nil
+		})
+	}
+
+	maxTimeout, _ := util.GetUint32EnvValueOrDefault(MaxWaitTimeout, MaxWaitTimeoutDefault)
+	if _, _, err = waitUntil(imageReadyCondition(pending.ImageId), time.Duration(maxTimeout)*time.Second); err != nil {
+		logger.Errorf("Image of version %q of application %q is not ready, application stays at version %q: %v",
+			pending.Version, applicationId, versions.Current, err)
+		return
+	}
+
+	if status, err := switchApplicationImage(s, application, pending, username); err != nil {
+		logger.Errorf("Cannot switch application %q to version %q, status: %d: %v", applicationId, pending.Version, status, err)
+		return
+	}
+	s.commit()
+
+	pruneApplicationVersions(applicationId, username)
+}
+
+// switchApplicationImage points application to ready image of the version, restarts its instance and makes the version current one
+func switchApplicationImage(s *saga, application catalogModels.Application, version applicationVersionRecord, username string) (int, error) {
+	instances, status, err := BrokerConfig.CatalogApi.ListApplicationInstances(application.Id)
+	if err != nil {
+		return status, err
+	}
+	if len(instances) == 0 {
+		return http.StatusConflict, fmt.Errorf("application %q has no instance to restart", application.Id)
+	}
+
+	if _, status, err = UpdateApplicationImageId(application.Id, version.ImageId, username); err != nil {
+		return status, fmt.Errorf("cannot point application %q to image %q: %v", application.Id, version.ImageId, err)
+	}
+	s.onRollback("restore image of application "+application.Id, restoreApplicationImageId(application.Id, application.ImageId, username))
+
+	if err = restartInstanceInCatalog(instances[0].Id, fmt.Sprintf("Switch to version %s requested by: %s", version.Version, username)); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("cannot restart instance %q: %v", instances[0].Id, err)
+	}
+
+	status, err = updateApplicationVersions(application.Id, username, func(versions *applicationVersions) {
+		if _, found := versions.find(version.Version); !found {
+			versions.Versions = append(versions.Versions, version)
+		}
+		versions.Current = version.Version
+		versions.Pending = nil
+		versions.RequestedBy = ""
+	})
+	if err != nil {
+		return status, fmt.Errorf("cannot make version %q current version of application %q: %v", version.Version, application.Id, err)
+	}
+	return http.StatusOK, nil
+}
+
+// ResumeApplicationVersionSwitches continues switches interrupted by restart of api-service
+func ResumeApplicationVersionSwitches() {
+	applications, _, err := BrokerConfig.CatalogApi.ListApplications(&commonHttp.ItemFilter{})
+	if err != nil {
+		logger.Errorf("Cannot fetch applications to resume their version switches: %v", err)
+		return
+	}
+
+	for _, application := range applications {
+		versions, err := getApplicationVersions(application)
+		if err != nil {
+			logger.Errorf("Cannot resume version switch: %v", err)
+			continue
+		}
+		if versions.Pending != nil {
+			logger.Infof("Resuming switch of application %q to version %q", application.Id, versions.Pending.Version)
+			startApplicationVersionSwitch(application.Id)
+		}
+	}
+}
+
+func imageReadyCondition(imageId string) waitCondition {
+	return func() (interface{}, bool, int, error) {
+		image, status, err := BrokerConfig.CatalogApi.GetImage(imageId)
+		if err != nil {
+			return nil, false, status, err
+		}
+		if image.State == catalogModels.ImageStateError {
+			return nil, false, http.StatusInternalServerError, errors.New(reasonImageBuildFailed)
+		}
+		return image, image.State == catalogModels.ImageStateReady, http.StatusOK, nil
+	}
+}
+
+func restartInstanceInCatalog(instanceId, message string) error {
+	instance, _, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		return err
+	}
+	patches, err := builder.MakePatchesForInstanceStateAndLastStateMetadata(message, instance.State, catalogModels.InstanceStateReconfiguration)
+	if err != nil {
+		return err
+	}
+	_, _, err = BrokerConfig.CatalogApi.UpdateInstance(instanceId, patches)
+	return err
+}
+
+func applicationVersionSwitchedCheck(applicationId, version string) operationCheck {
+	return func() (models.OperationState, string, error) {
+		application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+		if status == http.StatusNotFound {
+			return models.OperationStateFailed, reasonTargetNotFound, nil
+		}
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch application %q from Catalog: %v", applicationId, err)
+		}
+
+		versions, err := getApplicationVersions(application)
+		if err != nil {
+			return models.OperationStatePending, "", err
+		}
+		if versions.Pending != nil && versions.Pending.Version == version {
+			return models.OperationStatePending, "", nil
+		}
+		if versions.Current != version {
+			return models.OperationStateFailed, reasonVersionSwitchFailed, nil
+		}
+
+		instances, _, err := BrokerConfig.CatalogApi.ListApplicationInstances(applicationId)
+		if err != nil {
+			return models.OperationStatePending, "", fmt.Errorf("cannot fetch application %q instances from Catalog: %v", applicationId, err)
+		}
+		if len(instances) == 0 {
+			return models.OperationStateFailed, reasonTargetNotFound, nil
+		}
+		return getOperationStateFromInstance(instances[0].State, instances[0].Metadata,
+			[]catalogModels.InstanceState{catalogModels.InstanceStateRunning})
+	}
+}
+
+func applicationVersionSwitchedCondition(applicationId, version string) waitCondition {
+	check := applicationVersionSwitchedCheck(applicationId, version)
+	return func() (interface{}, bool, int, error) {
+		state, reason, err := check()
+		if err != nil {
+			return nil, false, http.StatusInternalServerError, err
+		}
+		switch state {
+		case models.OperationStateFailed:
+			return nil, false, http.StatusInternalServerError, fmt.Errorf("switching application %q to version %q failed: %s", applicationId, version, reason)
+		case models.OperationStateSucceeded:
+			application, err := getApplicationInstance(applicationId)
+			if err != nil {
+				return nil, false, getStatusError(err), err
+			}
+			return application, true, http.StatusOK, nil
+		}
+		return nil, false, http.StatusOK, nil
+	}
+}
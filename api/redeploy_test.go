@@ -0,0 +1,283 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gocraft/web"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func sendRedeployForm(applicationId string, router *web.Router) *httptest.ResponseRecorder {
+	bodyBuf, contentType := PrepareCreateApplicationForm(
+		fmt.Sprintf("%s/%s/%s", testDataDirPath, testApplicationsDir, blobFilename),
+		fmt.Sprintf("%s/%s/%s", testDataDirPath, testApplicationsDir, manifestFilename))
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/%s/applications/%s/blob", apiPrefix, applicationId), bodyBuf)
+	req.Header.Set("Content-Type", contentType)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRedeployApplication(t *testing.T) {
+	originalVersionSwitch := startApplicationVersionSwitch
+	defer func() { startApplicationVersionSwitch = originalVersionSwitch }()
+
+	imageId := catalogModels.GenerateImageId(applicationID1)
+	instance := catalogModels.Instance{Id: instanceID1, ClassId: applicationID1, State: catalogModels.InstanceStateRunning}
+
+	Convey("Test PUT /applications/:applicationId/blob", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		switchedApplicationId := ""
+		startApplicationVersionSwitch = func(applicationId string) {
+			switchedApplicationId = applicationId
+		}
+
+		Convey("When application has never been switched", func() {
+			application := catalogModels.Application{Id: applicationID1, Name: "sample", ImageId: imageId}
+
+			var addedImage catalogModels.Image
+			var storedBlobId string
+			var patches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { patches = p }).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().AddImage(gomock.Any()).Do(func(image catalogModels.Image) {
+					addedImage = image
+				}).Return(catalogModels.Image{}, http.StatusCreated, nil),
+				mocksAndRouter.blobStoreApiMock.EXPECT().StoreBlob(gomock.Any(), gomock.Any()).Do(func(blobId string, _ interface{}) {
+					storedBlobId = blobId
+				}).Return(nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateImage(gomock.Any(), gomock.Any()).Return(catalogModels.Image{}, http.StatusOK, nil),
+			)
+
+			response := sendRedeployForm(applicationID1, mocksAndRouter.router)
+
+			Convey("new version should get its own image, be marked as pending and switch started", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(response.Header().Get("Location"), ShouldNotBeEmpty)
+				So(patches, ShouldHaveLength, 1)
+				So(patches[0].Operation, ShouldEqual, catalogModels.OperationAdd)
+
+				versions := readApplicationVersionsPatch(patches[0])
+				So(versions.Current, ShouldEqual, initialApplicationVersion)
+				So(versions.Versions[0].ImageId, ShouldEqual, imageId)
+				So(versions.Pending, ShouldNotBeNil)
+				So(versions.Pending.ImageId, ShouldEqual, getApplicationVersionImageId(applicationID1, versions.Pending.Version))
+				So(addedImage.Id, ShouldEqual, versions.Pending.ImageId)
+				So(storedBlobId, ShouldEqual, versions.Pending.ImageId)
+				So(switchedApplicationId, ShouldEqual, applicationID1)
+			})
+		})
+
+		Convey("When pushed blob cannot be stored", func() {
+			application := getTestApplicationWithVersions(applicationVersions{
+				Current:  "v1",
+				Versions: []applicationVersionRecord{{Version: "v1", ImageId: imageId}},
+			})
+
+			var addedImageId, deletedImageId string
+			var patches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().AddImage(gomock.Any()).Do(func(image catalogModels.Image) {
+					addedImageId = image.Id
+				}).Return(catalogModels.Image{}, http.StatusCreated, nil),
+				mocksAndRouter.blobStoreApiMock.EXPECT().StoreBlob(gomock.Any(), gomock.Any()).Return(fmt.Errorf("blob store failure")),
+				mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(gomock.Any()).Do(func(imageId string) {
+					deletedImageId = imageId
+				}).Return(http.StatusNoContent, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { patches = p }).Return(application, http.StatusOK, nil),
+			)
+
+			response := sendRedeployForm(applicationID1, mocksAndRouter.router)
+
+			Convey("status code should be 500, image of pushed version should be removed and current one left untouched", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+				So(deletedImageId, ShouldEqual, addedImageId)
+				So(deletedImageId, ShouldNotEqual, imageId)
+				So(readApplicationVersionsPatch(patches[0]).Pending, ShouldBeNil)
+				So(switchedApplicationId, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When application is already being switched", func() {
+			application := getTestApplicationWithVersions(applicationVersions{
+				Current:  "v1",
+				Pending:  &applicationVersionRecord{Version: "v2"},
+				Versions: []applicationVersionRecord{{Version: "v1"}},
+			})
+
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+			)
+
+			response := sendRedeployForm(applicationID1, mocksAndRouter.router)
+
+			Convey("status code should be 409 and nothing should be stored", func() {
+				So(response.Code, ShouldEqual, http.StatusConflict)
+				So(switchedApplicationId, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When manifest name does not match application", func() {
+			application := catalogModels.Application{Id: applicationID1, Name: "other"}
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil)
+
+			response := sendRedeployForm(applicationID1, mocksAndRouter.router)
+
+			Convey("status code should be 400 and nothing should be stored", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+				So(strings.Contains(response.Body.String(), "does not match"), ShouldBeTrue)
+				So(switchedApplicationId, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When application does not exist", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(catalogModels.Application{}, http.StatusNotFound, fmt.Errorf("not found"))
+
+			response := sendRedeployForm(applicationID1, mocksAndRouter.router)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
+
+func TestCompleteApplicationVersionSwitch(t *testing.T) {
+	imageId := catalogModels.GenerateImageId(applicationID1)
+	pendingImageId := getApplicationVersionImageId(applicationID1, "v2")
+
+	Convey("Test completing switch of application to pending version", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		application := getTestApplicationWithVersions(applicationVersions{
+			Current:     "v1",
+			Pending:     &applicationVersionRecord{Version: "v2", ImageId: pendingImageId, CreatedOn: 200},
+			RequestedBy: ownerUsername,
+			Versions:    []applicationVersionRecord{{Version: "v1", ImageId: imageId, CreatedOn: 100}},
+		})
+
+		Convey("When image is built", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+			var imagePatches, versionsPatches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetImage(pendingImageId).
+					Return(catalogModels.Image{Id: pendingImageId, State: catalogModels.ImageStateReady}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { imagePatches = p }).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { versionsPatches = p }).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+			)
+
+			completeApplicationVersionSwitch(applicationID1)
+
+			Convey("application should be pointed to image of pending version, which should become current one", func() {
+				So(*imagePatches[0].Field, ShouldEqual, "ImageId")
+				So(string(*imagePatches[0].Value), ShouldEqual, fmt.Sprintf("%q", pendingImageId))
+
+				versions := readApplicationVersionsPatch(versionsPatches[0])
+				So(versions.Current, ShouldEqual, "v2")
+				So(versions.Pending, ShouldBeNil)
+				So(versions.Versions, ShouldHaveLength, 2)
+			})
+		})
+
+		Convey("When image build failed", func() {
+			var patches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetImage(pendingImageId).
+					Return(catalogModels.Image{Id: pendingImageId, State: catalogModels.ImageStateError}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(pendingImageId).Return(http.StatusNoContent, nil),
+				mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(pendingImageId).Return(http.StatusNoContent, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { patches = p }).Return(application, http.StatusOK, nil),
+			)
+
+			completeApplicationVersionSwitch(applicationID1)
+
+			Convey("application should keep its image and pushed version should be removed", func() {
+				versions := readApplicationVersionsPatch(patches[0])
+				So(versions.Current, ShouldEqual, "v1")
+				So(versions.Pending, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestResumeApplicationVersionSwitches(t *testing.T) {
+	originalVersionSwitch := startApplicationVersionSwitch
+	defer func() { startApplicationVersionSwitch = originalVersionSwitch }()
+
+	Convey("Given application interrupted during version switch and application without pending version", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		switched := []string{}
+		startApplicationVersionSwitch = func(applicationId string) {
+			switched = append(switched, applicationId)
+		}
+
+		applications := []catalogModels.Application{
+			getTestApplicationWithVersions(applicationVersions{Current: "v1", Pending: &applicationVersionRecord{Version: "v2"}}),
+			{Id: applicationID1 + "x"},
+		}
+		mocksAndRouter.catalogApiMock.EXPECT().ListApplications(gomock.Any()).Return(applications, http.StatusOK, nil)
+
+		ResumeApplicationVersionSwitches()
+
+		Convey("only interrupted switch should be resumed", func() {
+			So(switched, ShouldResemble, []string{applicationID1})
+		})
+	})
+}
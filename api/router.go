@@ -17,6 +17,7 @@ package api
 
 import (
 	"os"
+	"strings"
 
 	"fmt"
 	"github.com/gocraft/web"
@@ -36,11 +37,38 @@ func SetupRouter(r *web.Router, oauthMiddlewareActivated bool) {
 func (c Context) buildRouteAliasses(r *web.Router, aliasses []string, oauthMiddlewareActivated bool) {
 	for _, alias := range aliasses {
 		aliasString := fmt.Sprintf("/api/%s", alias)
-		r.Get(fmt.Sprintf("%s/login", aliasString), c.Login)
 
-		aliasRouter := r.Subrouter(c, aliasString)
-		route(aliasRouter, &c, oauthMiddlewareActivated)
+		aliasRouter := r.Subrouter(Context{}, aliasString)
+		aliasRouter.Middleware(c.PlatformSettingsMiddleware)
+		aliasRouter.Middleware((*Context).AuditMiddleware)
+		aliasRouter.Get("/login", (*Context).Login)
+		aliasRouter.Post("/login/refresh", (*Context).RefreshToken)
+
+		route(aliasRouter, oauthMiddlewareActivated)
+	}
+}
+
+// splitApiAlias splits route path into /api/<version> alias it was registered under and the rest of the path
+func splitApiAlias(path string) (string, string) {
+	if strings.HasPrefix(path, "/api/") {
+		if idx := strings.Index(path[len("/api/"):], "/"); idx >= 0 {
+			return path[:len("/api/")+idx], path[len("/api/")+idx:]
+		}
 	}
+	return "", path
+}
+
+// PlatformSettingsMiddleware fills context of the request with platform settings.
+// gocraft creates new context for every request, so identity of the caller set by
+// authorization middlewares is never shared between requests.
+func (c Context) PlatformSettingsMiddleware(ctx *Context, rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	ctx.Domain = c.Domain
+	ctx.TapVersion = c.TapVersion
+	ctx.CliVersion = c.CliVersion
+	ctx.CdhVersion = c.CdhVersion
+	ctx.K8sVersion = c.K8sVersion
+	ctx.CoreOrganization = c.CoreOrganization
+	next(rw, req)
 }
 
 func getPlatformSettings() Context {
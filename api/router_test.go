@@ -46,3 +46,27 @@ func TestIntroduceRoute(t *testing.T) {
 		})
 	})
 }
+
+func TestPlatformSettingsMiddleware(t *testing.T) {
+	Convey("Given platform settings and new request context", t, func() {
+		settings := Context{Domain: "domain", TapVersion: "1.0", CoreOrganization: "coreOrg", Username: "admin", IsAdmin: true}
+		ctx := &Context{}
+		nextCalled := false
+
+		settings.PlatformSettingsMiddleware(ctx, nil, nil, func(rw web.ResponseWriter, req *web.Request) {
+			nextCalled = true
+		})
+
+		Convey("platform settings should be copied to request context", func() {
+			So(nextCalled, ShouldBeTrue)
+			So(ctx.Domain, ShouldEqual, "domain")
+			So(ctx.TapVersion, ShouldEqual, "1.0")
+			So(ctx.CoreOrganization, ShouldEqual, "coreOrg")
+		})
+
+		Convey("identity should not be copied to request context", func() {
+			So(ctx.Username, ShouldBeEmpty)
+			So(ctx.IsAdmin, ShouldBeFalse)
+		})
+	})
+}
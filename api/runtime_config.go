@@ -0,0 +1,369 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocraft/web"
+
+	kubernetesApi "github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// runtime configuration is stored in metadata of catalog application
+const (
+	applicationEnvMetadataKey       = "APPLICATION_ENV"
+	applicationMemoryMetadataKey    = "APPLICATION_MEMORY"
+	applicationDiskQuotaMetadataKey = "APPLICATION_DISK_QUOTA"
+	applicationCommandMetadataKey   = "APPLICATION_COMMAND"
+	applicationPortsMetadataKey     = "APPLICATION_PORTS"
+)
+
+var runtimeConfigMetadataKeys = []string{
+	applicationEnvMetadataKey,
+	applicationMemoryMetadataKey,
+	applicationDiskQuotaMetadataKey,
+	applicationCommandMetadataKey,
+	applicationPortsMetadataKey,
+}
+
+// runtimeConfigApplyTimeout covers build of application image, after which its instance is deployed
+const runtimeConfigApplyTimeout = time.Hour
+
+var envVariableNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func validateRuntimeConfig(config models.ApplicationRuntimeConfig) error {
+	for name := range config.Env {
+		if !envVariableNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+	}
+
+	if config.Memory != "" {
+		if memory, err := parseMemoryInMB(config.Memory); err != nil || memory <= 0 {
+			return fmt.Errorf("invalid memory %q, expected positive value e.g. 256MB or 1GB", config.Memory)
+		}
+	}
+	if config.DiskQuota != "" {
+		if diskQuota, err := parseMemoryInMB(config.DiskQuota); err != nil || diskQuota <= 0 {
+			return fmt.Errorf("invalid disk_quota %q, expected positive value e.g. 1024MB or 2GB", config.DiskQuota)
+		}
+	}
+
+	usedPorts := map[int]bool{}
+	for _, port := range config.Ports {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d, allowed range is 1-65535", port)
+		}
+		if usedPorts[port] {
+			return fmt.Errorf("port %d is duplicated", port)
+		}
+		usedPorts[port] = true
+	}
+	return nil
+}
+
+// runtimeConfigToMetadata returns metadata only for fields which are set
+func runtimeConfigToMetadata(config models.ApplicationRuntimeConfig) []catalogModels.Metadata {
+	var metadata []catalogModels.Metadata
+	if len(config.Env) > 0 {
+		// marshaling map of strings cannot fail
+		env, _ := json.Marshal(config.Env)
+		metadata = append(metadata, catalogModels.Metadata{Id: applicationEnvMetadataKey, Value: string(env)})
+	}
+	if config.Memory != "" {
+		metadata = append(metadata, catalogModels.Metadata{Id: applicationMemoryMetadataKey, Value: config.Memory})
+	}
+	if config.DiskQuota != "" {
+		metadata = append(metadata, catalogModels.Metadata{Id: applicationDiskQuotaMetadataKey, Value: config.DiskQuota})
+	}
+	if config.Command != "" {
+		metadata = append(metadata, catalogModels.Metadata{Id: applicationCommandMetadataKey, Value: config.Command})
+	}
+	if len(config.Ports) > 0 {
+		ports := []string{}
+		for _, port := range config.Ports {
+			ports = append(ports, strconv.Itoa(port))
+		}
+		metadata = append(metadata, catalogModels.Metadata{Id: applicationPortsMetadataKey, Value: strings.Join(ports, ",")})
+	}
+	return metadata
+}
+
+func getRuntimeConfig(metadata []catalogModels.Metadata) models.ApplicationRuntimeConfig {
+	config := getStoredRuntimeConfig(metadata)
+	config.Memory = getApplicationMemory(metadata)
+	config.DiskQuota = getApplicationDiskQuota(metadata)
+	return config
+}
+
+// getStoredRuntimeConfig returns runtime configuration without defaults of fields which are not set
+func getStoredRuntimeConfig(metadata []catalogModels.Metadata) models.ApplicationRuntimeConfig {
+	config := models.ApplicationRuntimeConfig{
+		Env:       map[string]string{},
+		Memory:    catalogModels.GetValueFromMetadata(metadata, applicationMemoryMetadataKey),
+		DiskQuota: catalogModels.GetValueFromMetadata(metadata, applicationDiskQuotaMetadataKey),
+		Command:   catalogModels.GetValueFromMetadata(metadata, applicationCommandMetadataKey),
+		Ports:     []int{},
+	}
+
+	if env := catalogModels.GetValueFromMetadata(metadata, applicationEnvMetadataKey); env != "" {
+		if err := json.Unmarshal([]byte(env), &config.Env); err != nil {
+			logger.Warningf("Cannot parse %s metadata %q: %v", applicationEnvMetadataKey, env, err)
+		}
+	}
+	if ports := catalogModels.GetValueFromMetadata(metadata, applicationPortsMetadataKey); ports != "" {
+		for _, value := range strings.Split(ports, ",") {
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				logger.Warningf("Cannot parse port %q of %s metadata: %v", value, applicationPortsMetadataKey, err)
+				continue
+			}
+			config.Ports = append(config.Ports, port)
+		}
+	}
+	return config
+}
+
+func hasRuntimeConfig(metadata []catalogModels.Metadata) bool {
+	for _, key := range runtimeConfigMetadataKeys {
+		if catalogModels.GetValueFromMetadata(metadata, key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func getApplicationMemory(metadata []catalogModels.Metadata) string {
+	if memory := catalogModels.GetValueFromMetadata(metadata, applicationMemoryMetadataKey); memory != "" {
+		return memory
+	}
+	return apiApplicationInstanceMemoryDefault
+}
+
+func getApplicationDiskQuota(metadata []catalogModels.Metadata) string {
+	if diskQuota := catalogModels.GetValueFromMetadata(metadata, applicationDiskQuotaMetadataKey); diskQuota != "" {
+		return diskQuota
+	}
+	return apiApplicationInstanceDiskQuotaDefault
+}
+
+// makeRuntimeConfigPatches returns patches which replace whole runtime configuration stored in current metadata
+func makeRuntimeConfigPatches(current []catalogModels.Metadata, config models.ApplicationRuntimeConfig, username string) ([]catalogModels.Patch, error) {
+	desired := map[string]string{}
+	for _, metadata := range runtimeConfigToMetadata(config) {
+		desired[metadata.Id] = metadata.Value
+	}
+
+	patches := []catalogModels.Patch{}
+	for _, key := range runtimeConfigMetadataKeys {
+		currentValue := catalogModels.GetValueFromMetadata(current, key)
+		desiredValue := desired[key]
+
+		var operation catalogModels.PatchOperation
+		switch {
+		case currentValue == desiredValue:
+			continue
+		case currentValue == "":
+			operation = catalogModels.OperationAdd
+		case desiredValue == "":
+			operation = catalogModels.OperationDelete
+		default:
+			operation = catalogModels.OperationUpdate
+		}
+
+		patch, err := builder.MakePatch("Metadata", catalogModels.Metadata{Id: key, Value: desiredValue}, operation)
+		if err != nil {
+			return nil, err
+		}
+		patch.Username = username
+		patches = append(patches, patch)
+	}
+	return patches, nil
+}
+
+// toContainerConfig maps runtime configuration onto container of application instance. Memory limit is always set,
+// so that the one reported for instance is enforced, disk quota only if it was set explicitly, as not every cluster
+// limits ephemeral storage. Values of previous configuration missing in the new one are removed.
+func toContainerConfig(config, previous models.ApplicationRuntimeConfig) kubernetesApi.ContainerConfig {
+	containerConfig := kubernetesApi.ContainerConfig{Env: config.Env, Ports: config.Ports, ResetCommand: previous.Command != ""}
+	for name := range previous.Env {
+		containerConfig.RemovedEnv = append(containerConfig.RemovedEnv, name)
+	}
+	sort.Strings(containerConfig.RemovedEnv)
+	if len(previous.Ports) > 0 {
+		containerConfig.RemovedPorts = previous.Ports
+	}
+
+	memory := config.Memory
+	if memory == "" {
+		memory = apiApplicationInstanceMemoryDefault
+	}
+	// memory has been validated before it was stored
+	memoryInMB, _ := parseMemoryInMB(memory)
+	containerConfig.MemoryLimit = fmt.Sprintf("%dMi", memoryInMB)
+	if config.DiskQuota != "" {
+		diskQuotaInMB, _ := parseMemoryInMB(config.DiskQuota)
+		containerConfig.StorageLimit = fmt.Sprintf("%dMi", diskQuotaInMB)
+	}
+
+	if config.Command != "" {
+		containerConfig.Command = []string{"/bin/sh", "-c", config.Command}
+	}
+	return containerConfig
+}
+
+// startRuntimeConfigApplication is variable, so that tests can replace background application of configuration
+var startRuntimeConfigApplication = func(applicationId string) {
+	go applyRuntimeConfigWhenRunning(applicationId)
+}
+
+// applyRuntimeConfigWhenRunning waits until Container Broker deploys instance of application from its template
+// and then applies runtime configuration onto it
+func applyRuntimeConfigWhenRunning(applicationId string) {
+	if _, _, err := waitUntil(applicationStateCondition(applicationId, catalogModels.InstanceStateRunning), runtimeConfigApplyTimeout); err != nil {
+		logger.Errorf("Cannot apply runtime configuration of application %q, its instance is not running: %v", applicationId, err)
+		return
+	}
+	application, _, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		logger.Errorf("Cannot fetch application %q to apply its runtime configuration: %v", applicationId, err)
+		return
+	}
+	instances, _, err := BrokerConfig.CatalogApi.ListApplicationInstances(applicationId)
+	if err != nil || len(instances) == 0 {
+		logger.Errorf("Cannot fetch instance of application %q to apply its runtime configuration: %v", applicationId, err)
+		return
+	}
+	config := toContainerConfig(getStoredRuntimeConfig(application.Metadata), models.ApplicationRuntimeConfig{})
+	if _, err := BrokerConfig.KubernetesApi.UpdateInstanceContainers(instances[0].Id, config); err != nil {
+		logger.Errorf("Cannot apply runtime configuration of application %q: %v", applicationId, err)
+		return
+	}
+	logger.Infof("Runtime configuration of application %q applied to instance %s", applicationId, instances[0].Id)
+}
+
+// ApplyApplicationsRuntimeConfig makes sure instances run with stored runtime configuration, also for applications
+// created while api-service was restarted. Patching deployment with unchanged configuration does not restart its pods.
+func ApplyApplicationsRuntimeConfig() {
+	applications, _, err := BrokerConfig.CatalogApi.ListApplications(&commonHttp.ItemFilter{})
+	if err != nil {
+		logger.Errorf("Cannot fetch applications to apply their runtime configuration: %v", err)
+		return
+	}
+	for _, application := range applications {
+		if hasRuntimeConfig(application.Metadata) {
+			startRuntimeConfigApplication(application.Id)
+		}
+	}
+}
+
+func (c *Context) GetApplicationEnv(rw web.ResponseWriter, req *web.Request) {
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(req.PathParams["applicationId"])
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, getRuntimeConfig(application.Metadata), http.StatusOK)
+}
+
+// UpdateApplicationEnv replaces runtime configuration of application, applies it to deployment of its instance
+// and restarts the instance
+func (c *Context) UpdateApplicationEnv(rw web.ResponseWriter, req *web.Request) {
+	applicationId := req.PathParams["applicationId"]
+
+	config := models.ApplicationRuntimeConfig{}
+	if err := ReadJsonAndValidate(req, &config); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	if err := validateRuntimeConfig(config); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	if c.areQuotasEnabled() {
+		quota, err := memoryChangeQuotaRequest(application, config.Memory)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return
+		}
+		if c.respondIfQuotaExceeded(rw, quota) {
+			return
+		}
+	}
+
+	instanceId, status, err := c.getApplicationInstanceID(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	tx := newSaga("update application runtime configuration")
+	defer tx.rollbackUnlessCommitted()
+
+	previous := getStoredRuntimeConfig(application.Metadata)
+	patches, err := makeRuntimeConfigPatches(application.Metadata, config, c.Username)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	if len(patches) > 0 {
+		if _, status, err = BrokerConfig.CatalogApi.UpdateApplication(applicationId, patches); err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		tx.onRollback("restore runtime configuration of application "+applicationId,
+			restoreRuntimeConfig(applicationId, config, previous, c.Username))
+	}
+
+	if status, err = BrokerConfig.KubernetesApi.UpdateInstanceContainers(instanceId, toContainerConfig(config, previous)); err != nil {
+		commonHttp.GenericRespond(status, rw, fmt.Errorf("cannot apply runtime configuration to instance %s: %v", instanceId, err))
+		return
+	}
+	tx.commit()
+
+	RestartInstance(instanceId, c.Username, rw, req)
+}
+
+func restoreRuntimeConfig(applicationId string, config, previous models.ApplicationRuntimeConfig, username string) func() error {
+	return func() error {
+		patches, err := makeRuntimeConfigPatches(runtimeConfigToMetadata(config), previous, username)
+		if err != nil {
+			return err
+		}
+		_, _, err = BrokerConfig.CatalogApi.UpdateApplication(applicationId, patches)
+		return err
+	}
+}
@@ -0,0 +1,217 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+func TestValidateRuntimeConfig(t *testing.T) {
+	testCases := []struct {
+		config models.ApplicationRuntimeConfig
+		valid  bool
+	}{
+		{models.ApplicationRuntimeConfig{}, true},
+		{models.ApplicationRuntimeConfig{Env: map[string]string{"DB_URL": "x", "_debug": "1"}, Memory: "1GB", DiskQuota: "512MB", Ports: []int{80, 8080}}, true},
+		{models.ApplicationRuntimeConfig{Env: map[string]string{"1VAR": "x"}}, false},
+		{models.ApplicationRuntimeConfig{Env: map[string]string{"MY-VAR": "x"}}, false},
+		{models.ApplicationRuntimeConfig{Memory: "lots"}, false},
+		{models.ApplicationRuntimeConfig{Memory: "0MB"}, false},
+		{models.ApplicationRuntimeConfig{DiskQuota: "10KB"}, false},
+		{models.ApplicationRuntimeConfig{Ports: []int{0}}, false},
+		{models.ApplicationRuntimeConfig{Ports: []int{70000}}, false},
+		{models.ApplicationRuntimeConfig{Ports: []int{80, 80}}, false},
+	}
+
+	Convey("For set of test cases validateRuntimeConfig should return proper result", t, func() {
+		for _, tc := range testCases {
+			Convey(fmt.Sprintf("For config %+v valid should be %v", tc.config, tc.valid), func() {
+				err := validateRuntimeConfig(tc.config)
+				if tc.valid {
+					So(err, ShouldBeNil)
+				} else {
+					So(err, ShouldNotBeNil)
+				}
+			})
+		}
+	})
+}
+
+func TestRuntimeConfigMetadata(t *testing.T) {
+	Convey("Given runtime config stored in metadata", t, func() {
+		config := models.ApplicationRuntimeConfig{
+			Env:     map[string]string{"KEY": "value"},
+			Memory:  "512MB",
+			Command: "python app.py",
+			Ports:   []int{8080, 9090},
+		}
+		metadata := runtimeConfigToMetadata(config)
+
+		Convey("it should be read back with default disk quota", func() {
+			result := getRuntimeConfig(metadata)
+			So(result.Env, ShouldResemble, config.Env)
+			So(result.Memory, ShouldEqual, config.Memory)
+			So(result.DiskQuota, ShouldEqual, apiApplicationInstanceDiskQuotaDefault)
+			So(result.Command, ShouldEqual, config.Command)
+			So(result.Ports, ShouldResemble, config.Ports)
+		})
+
+		Convey("patches replacing it should add, update and delete proper keys", func() {
+			newConfig := models.ApplicationRuntimeConfig{
+				Env:       config.Env,
+				Memory:    "1GB",
+				DiskQuota: "2GB",
+			}
+			patches, err := makeRuntimeConfigPatches(metadata, newConfig, ownerUsername)
+			So(err, ShouldBeNil)
+
+			operations := []catalogModels.PatchOperation{}
+			for _, patch := range patches {
+				operations = append(operations, patch.Operation)
+			}
+			So(operations, ShouldResemble, []catalogModels.PatchOperation{
+				catalogModels.OperationUpdate, catalogModels.OperationAdd, catalogModels.OperationDelete, catalogModels.OperationDelete,
+			})
+		})
+	})
+}
+
+func TestApplicationEnv(t *testing.T) {
+	envURL := fmt.Sprintf("/api/%s/applications/%s/env", apiPrefix, applicationID1)
+
+	Convey("Test /applications/:applicationId/env", t, func() {
+		application := catalogModels.Application{
+			Id:       applicationID1,
+			Metadata: []catalogModels.Metadata{{Id: applicationMemoryMetadataKey, Value: "512MB"}},
+		}
+		instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+
+		Convey("When configuration is requested", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil)
+
+			response := SendGet(envURL, mocksAndRouter.router)
+
+			Convey("stored values and defaults should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := models.ApplicationRuntimeConfig{}
+				readAndAssertJson(response, &result)
+				So(result.Memory, ShouldEqual, "512MB")
+				So(result.DiskQuota, ShouldEqual, apiApplicationInstanceDiskQuotaDefault)
+			})
+		})
+
+		Convey("When configuration is replaced", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+				mocksAndRouter.kubernetesApiMock.EXPECT().UpdateInstanceContainers(instanceID1, kubernetes_connector.ContainerConfig{
+					Env:         map[string]string{"KEY": "value"},
+					MemoryLimit: "256Mi",
+				}).Return(http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+			)
+
+			body, _ := json.Marshal(models.ApplicationRuntimeConfig{Env: map[string]string{"KEY": "value"}})
+			response := commonHttp.SendRequest("PUT", envURL, body, mocksAndRouter.router, t)
+
+			Convey("deployment of instance should be updated and instance restarted", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+			})
+		})
+
+		Convey("When configuration cannot be applied to deployment", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+				mocksAndRouter.kubernetesApiMock.EXPECT().UpdateInstanceContainers(instanceID1, gomock.Any()).
+					Return(http.StatusBadGateway, errors.New("forbidden")),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+			)
+
+			body, _ := json.Marshal(models.ApplicationRuntimeConfig{Env: map[string]string{"KEY": "value"}})
+			response := commonHttp.SendRequest("PUT", envURL, body, mocksAndRouter.router, t)
+
+			Convey("stored configuration should be restored and error returned", func() {
+				So(response.Code, ShouldEqual, http.StatusBadGateway)
+			})
+		})
+
+		Convey("When configuration is invalid", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			body, _ := json.Marshal(models.ApplicationRuntimeConfig{Ports: []int{-1}})
+			response := commonHttp.SendRequest("PUT", envURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestToContainerConfig(t *testing.T) {
+	Convey("Given previous runtime configuration", t, func() {
+		previous := models.ApplicationRuntimeConfig{
+			Env:     map[string]string{"KEPT": "old", "REMOVED": "value"},
+			Command: "./run.sh",
+			Ports:   []int{8080, 9090},
+		}
+
+		Convey("new configuration should replace it", func() {
+			config := toContainerConfig(models.ApplicationRuntimeConfig{
+				Env:       map[string]string{"KEPT": "new"},
+				Memory:    "1GB",
+				DiskQuota: "2GB",
+				Ports:     []int{8080},
+			}, previous)
+
+			So(config, ShouldResemble, kubernetes_connector.ContainerConfig{
+				Env:          map[string]string{"KEPT": "new"},
+				RemovedEnv:   []string{"KEPT", "REMOVED"},
+				MemoryLimit:  "1024Mi",
+				StorageLimit: "2048Mi",
+				ResetCommand: true,
+				Ports:        []int{8080},
+				RemovedPorts: []int{8080, 9090},
+			})
+		})
+	})
+}
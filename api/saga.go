@@ -0,0 +1,146 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+// saga remembers how to undo steps of multi-step flow. Steps which already succeeded are compensated
+// in reverse order if the flow fails, so no orphan entities are left in Catalog, Template Repository and Blob Store.
+type saga struct {
+	name          string
+	compensations []compensation
+	committed     bool
+}
+
+type compensation struct {
+	description string
+	undo        func() error
+}
+
+func newSaga(name string) *saga {
+	return &saga{name: name}
+}
+
+// onRollback registers compensation of step which has just succeeded
+func (s *saga) onRollback(description string, undo func() error) {
+	s.compensations = append(s.compensations, compensation{description: description, undo: undo})
+}
+
+func (s *saga) commit() {
+	s.committed = true
+}
+
+// rollbackUnlessCommitted runs compensations of finished steps if flow did not reach commit.
+// Compensation errors are only logged, as error of failed step is the one returned to the client;
+// whatever could not be undone is found later by orphans cleanup.
+func (s *saga) rollbackUnlessCommitted() {
+	if s.committed || len(s.compensations) == 0 {
+		return
+	}
+
+	logger.Warningf("Flow %q failed, rolling back %d step(s)", s.name, len(s.compensations))
+	for i := len(s.compensations) - 1; i >= 0; i-- {
+		step := s.compensations[i]
+		if err := step.undo(); err != nil {
+			logger.Errorf("Rollback of flow %q: cannot %s: %v", s.name, step.description, err)
+		} else {
+			logger.Infof("Rollback of flow %q: %s done", s.name, step.description)
+		}
+	}
+	s.compensations = nil
+}
+
+// ignoreNotFound treats already removed entity as successfully removed
+func ignoreNotFound(status int, err error) error {
+	if err != nil && status != http.StatusNotFound {
+		return err
+	}
+	return nil
+}
+
+func deleteServiceFromCatalog(serviceId string) func() error {
+	return func() error {
+		return ignoreNotFound(BrokerConfig.CatalogApi.DeleteService(serviceId))
+	}
+}
+
+func deleteApplicationFromCatalog(applicationId string) func() error {
+	return func() error {
+		return ignoreNotFound(BrokerConfig.CatalogApi.DeleteApplication(applicationId))
+	}
+}
+
+func deleteImageFromCatalog(imageId string) func() error {
+	return func() error {
+		return ignoreNotFound(BrokerConfig.CatalogApi.DeleteImage(imageId))
+	}
+}
+
+// deleteBlobFromBlobStore records blob which could not be removed, as Blob Store cannot be listed by orphans cleanup
+func deleteBlobFromBlobStore(blobId string) func() error {
+	return func() error {
+		err := ignoreNotFound(BrokerConfig.BlobStoreApi.DeleteBlob(blobId))
+		if err != nil {
+			recordLeftover(models.OrphanTypeBlob, blobId, "blob could not be removed from Blob Store")
+		}
+		return err
+	}
+}
+
+// deleteTemplateFromTemplateRepository records template which could not be removed, as templates cannot be listed by orphans cleanup
+func deleteTemplateFromTemplateRepository(templateId string) func() error {
+	return func() error {
+		err := ignoreNotFound(BrokerConfig.TemplateRepositoryApi.DeleteTemplate(templateId))
+		if err != nil {
+			recordLeftover(models.OrphanTypeTemplate, templateId, "template could not be removed from Template Repository")
+		}
+		return err
+	}
+}
+
+// markTemplateUnavailable is used instead of removal, as Catalog does not allow to delete templates
+func markTemplateUnavailable(templateId, username string) func() error {
+	return func() error {
+		patch, err := builder.MakePatch("State", catalogModels.TemplateStateUnavailable, catalogModels.OperationUpdate)
+		if err != nil {
+			return err
+		}
+		patch.Username = username
+		_, status, err := BrokerConfig.CatalogApi.UpdateTemplate(templateId, []catalogModels.Patch{patch})
+		if err = ignoreNotFound(status, err); err != nil {
+			recordLeftover(models.OrphanTypeTemplate, templateId, "template could not be marked unavailable in Catalog")
+		}
+		return err
+	}
+}
+
+func (c *Context) deleteInstanceFromCatalog(instanceId string) func() error {
+	return func() error {
+		status, err := c.deleteInstance(instanceId)
+		if err = ignoreNotFound(status, err); err != nil {
+			return fmt.Errorf("cannot request removal of instance %s: %v", instanceId, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,103 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+func TestSaga(t *testing.T) {
+	Convey("Test saga", t, func() {
+		undone := []string{}
+		tx := newSaga("test")
+		tx.onRollback("undo first", func() error { undone = append(undone, "first"); return nil })
+		tx.onRollback("undo second", func() error { undone = append(undone, "second"); return errors.New("failed") })
+		tx.onRollback("undo third", func() error { undone = append(undone, "third"); return nil })
+
+		Convey("When it is not committed", func() {
+			tx.rollbackUnlessCommitted()
+
+			Convey("all steps should be undone in reverse order despite errors", func() {
+				So(undone, ShouldResemble, []string{"third", "second", "first"})
+			})
+
+			Convey("steps should not be undone twice", func() {
+				tx.rollbackUnlessCommitted()
+				So(undone, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When it is committed", func() {
+			tx.commit()
+			tx.rollbackUnlessCommitted()
+
+			Convey("no step should be undone", func() {
+				So(undone, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestCreateServiceInstanceRollback(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	servicesURL := fmt.Sprintf("/api/%s/services", apiPrefix)
+
+	Convey("Test POST /services when dependency cannot be created", t, func() {
+		service := catalogModels.Service{Id: serviceID1, Name: serviceName1, State: catalogModels.ServiceStateReady,
+			Plans: []catalogModels.ServicePlan{{Id: planID1, Name: planName1, Dependencies: []catalogModels.ServiceDependency{
+				{ServiceId: serviceID2, ServiceName: serviceName2, PlanId: planID1},
+				{ServiceId: serviceID3, ServiceName: serviceName3, PlanId: planID2},
+			}}}}
+		createdDependency := catalogModels.Instance{Id: instanceID2, Name: instanceName1 + "-" + serviceName2, ClassId: serviceID2,
+			Type: catalogModels.InstanceTypeService, State: catalogModels.InstanceStateRequested}
+
+		gomock.InOrder(
+			mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(service, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID2).Return(catalogModels.Service{Id: serviceID2}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().AddServiceInstance(serviceID2, gomock.Any()).Return(createdDependency, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID3).Return(catalogModels.Service{Id: serviceID3}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().AddServiceInstance(serviceID3, gomock.Any()).
+				Return(catalogModels.Instance{}, http.StatusInternalServerError, errors.New("catalog failure")),
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(createdDependency, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{createdDependency}, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID2, gomock.Any()).Return(createdDependency, http.StatusOK, nil),
+		)
+
+		body, _ := json.Marshal(models.ServiceInstanceRequest{Name: instanceName1, Type: catalogModels.InstanceTypeService, OfferingId: serviceID1,
+			Metadata: []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}}})
+		response := commonHttp.SendRequest("POST", servicesURL, body, mocksAndRouter.router, t)
+
+		Convey("already created dependency should be removed and error returned", func() {
+			So(response.Code, ShouldEqual, http.StatusInternalServerError)
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -19,19 +19,25 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gocraft/web"
 
 	"github.com/trustedanalytics-ng/tap-api-service/models"
 	"github.com/trustedanalytics-ng/tap-catalog/builder"
 	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
-	containerBrokerModels "github.com/trustedanalytics-ng/tap-container-broker/models"
 	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
 )
 
 const AcceptedRequest = "Accepted"
 
 func RestartInstance(instanceId, username string, rw web.ResponseWriter, req *web.Request) {
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
 	if err != nil {
 		commonHttp.GenericRespond(status, rw, err)
@@ -50,10 +56,18 @@ func RestartInstance(instanceId, username string, rw web.ResponseWriter, req *we
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
-	commonHttp.WriteJson(rw, containerBrokerModels.MessageResponse{Message: AcceptedRequest}, http.StatusAccepted)
+	operationId := startOperation(rw, req, username, models.OperationTypeRestart, models.OperationTargetInstance, instanceId,
+		instanceStateCheck(instanceId, catalogModels.InstanceStateRunning))
+	respondAccepted(rw, timeout, instanceStateCondition(instanceId, catalogModels.InstanceStateRunning), operationId)
 }
 
 func StartInstance(instanceId, username string, rw web.ResponseWriter, req *web.Request) {
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	message := fmt.Sprintf("StartInstance request made by: %s", username)
 	patches, err := builder.MakePatchesForInstanceStateAndLastStateMetadata(message, catalogModels.InstanceStateStopped, catalogModels.InstanceStateStartReq)
 	if err != nil {
@@ -66,14 +80,25 @@ func StartInstance(instanceId, username string, rw web.ResponseWriter, req *web.
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
-	commonHttp.WriteJson(rw, containerBrokerModels.MessageResponse{Message: AcceptedRequest}, http.StatusAccepted)
+	operationId := startOperation(rw, req, username, models.OperationTypeStart, models.OperationTargetInstance, instanceId,
+		instanceStateCheck(instanceId, catalogModels.InstanceStateRunning))
+	respondAccepted(rw, timeout, instanceStateCondition(instanceId, catalogModels.InstanceStateRunning), operationId)
 }
 
 func StopInstance(instanceId, username string, rw web.ResponseWriter, req *web.Request) {
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
 	if status, err := stopInstance(instanceId, username); err != nil {
 		commonHttp.GenericRespond(status, rw, err)
+		return
 	}
-	commonHttp.WriteJson(rw, containerBrokerModels.MessageResponse{Message: AcceptedRequest}, http.StatusAccepted)
+	operationId := startOperation(rw, req, username, models.OperationTypeStop, models.OperationTargetInstance, instanceId,
+		instanceStateCheck(instanceId, catalogModels.InstanceStateStopped))
+	respondAccepted(rw, timeout, instanceStateCondition(instanceId, catalogModels.InstanceStateStopped), operationId)
 }
 
 func stopInstance(instanceId, username string) (int, error) {
@@ -91,9 +116,14 @@ func stopInstance(instanceId, username string) (int, error) {
 	return http.StatusAccepted, nil
 }
 
-func ScaleInstance(instanceId, username string, rw web.ResponseWriter, req *web.Request) {
-	scaleReq := models.ScaleApplicationRequest{}
+func (c *Context) ScaleInstance(instanceId, username string, rw web.ResponseWriter, req *web.Request) {
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
 
+	scaleReq := models.ScaleApplicationRequest{}
 	if err := ReadJsonAndValidate(req, &scaleReq); err != nil {
 		commonHttp.Respond400(rw, err)
 		return
@@ -110,6 +140,22 @@ func ScaleInstance(instanceId, username string, rw web.ResponseWriter, req *web.
 		return
 	}
 
+	if c.areQuotasEnabled() {
+		application, status, err := BrokerConfig.CatalogApi.GetApplication(instance.ClassId)
+		if err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		quota, err := scaleQuotaRequest(application, scaleReq.Replicas)
+		if err != nil {
+			commonHttp.Respond500(rw, err)
+			return
+		}
+		if c.respondIfQuotaExceeded(rw, quota) {
+			return
+		}
+	}
+
 	patch, err := builder.MakePatch("Replication", scaleReq.Replicas, catalogModels.OperationUpdate)
 	if err != nil {
 		commonHttp.Respond400(rw, err)
@@ -134,5 +180,21 @@ func ScaleInstance(instanceId, username string, rw web.ResponseWriter, req *web.
 		commonHttp.GenericRespond(status, rw, err)
 		return
 	}
-	commonHttp.WriteJson(rw, containerBrokerModels.MessageResponse{Message: AcceptedRequest}, http.StatusAccepted)
+
+	targetState := catalogModels.InstanceStateRunning
+	if scaleReq.Replicas == 0 {
+		targetState = catalogModels.InstanceStateStopped
+	}
+	operationId := startOperation(rw, req, username, models.OperationTypeScale, models.OperationTargetInstance, instanceId,
+		instanceStateCheck(instanceId, targetState))
+	respondAccepted(rw, timeout, instanceStateCondition(instanceId, targetState), operationId)
+}
+
+// respondAccepted responds with 202 or, if wait timeout was requested, with result of finished operation
+func respondAccepted(rw web.ResponseWriter, timeout time.Duration, condition waitCondition, operationId string) {
+	if timeout > 0 {
+		respondWhenConditionMet(rw, timeout, condition)
+		return
+	}
+	commonHttp.WriteJson(rw, models.OperationAcceptedResponse{Message: AcceptedRequest, OperationId: operationId}, http.StatusAccepted)
 }
@@ -0,0 +1,234 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/serviceaccounts"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	apiKeyHeader = "X-Api-Key"
+	// serviceAccountUsernamePrefix distinguishes service accounts from UAA users in audit trails and ownership
+	serviceAccountUsernamePrefix = "serviceaccount:"
+)
+
+func getServiceAccountUsername(account models.ServiceAccount) string {
+	return serviceAccountUsernamePrefix + account.Name
+}
+
+// apiKeyAuthorize authenticates request carrying API key of service account
+func (c *Context) apiKeyAuthorize(rw web.ResponseWriter, req *web.Request, next web.NextMiddlewareFunc) {
+	secret := req.Header.Get(apiKeyHeader)
+	if BrokerConfig.ServiceAccountStore == nil {
+		logger.Warning("API key provided, but service accounts are not configured")
+		commonHttp.RespondUnauthorized(rw)
+		return
+	}
+	account, key, err := BrokerConfig.ServiceAccountStore.Authenticate(secret)
+	if err != nil {
+		logger.Infof("API key authentication failed: %v", err)
+		commonHttp.RespondUnauthorized(rw)
+		return
+	}
+
+	scopes := key.Scopes
+	if len(scopes) == 0 {
+		scopes = account.Scopes
+	}
+	logger.Infof("Service account %s authenticated with key %s", account.Name, key.Id)
+	c.authorizePrincipal(getServiceAccountUsername(account), scopes, rw, req, next)
+}
+
+func getServiceAccountStore() (serviceaccounts.Store, error) {
+	if BrokerConfig.ServiceAccountStore == nil {
+		return nil, errors.New("service accounts are not configured")
+	}
+	return BrokerConfig.ServiceAccountStore, nil
+}
+
+func (c *Context) CreateServiceAccount(rw web.ResponseWriter, req *web.Request) {
+	accountReq := models.ServiceAccountCreateRequest{}
+	if err := ReadJsonAndValidate(req, &accountReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	if status, err := c.validateScopes(accountReq.Scopes); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	account, err := store.CreateAccount(models.ServiceAccount{
+		Name:        accountReq.Name,
+		Description: accountReq.Description,
+		Scopes:      accountReq.Scopes,
+		CreatedBy:   c.Username,
+	})
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, account, http.StatusCreated)
+}
+
+func (c *Context) ListServiceAccounts(rw web.ResponseWriter, req *web.Request) {
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	accounts, err := store.ListAccounts()
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, accounts, http.StatusOK)
+}
+
+func (c *Context) GetServiceAccount(rw web.ResponseWriter, req *web.Request) {
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	account, err := store.GetAccount(req.PathParams["accountId"])
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, account, http.StatusOK)
+}
+
+func (c *Context) DeleteServiceAccount(rw web.ResponseWriter, req *web.Request) {
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	if err := store.DeleteAccount(req.PathParams["accountId"]); err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, "", http.StatusNoContent)
+}
+
+func (c *Context) CreateApiKey(rw web.ResponseWriter, req *web.Request) {
+	keyReq := models.ApiKeyCreateRequest{}
+	if err := ReadJsonAndValidate(req, &keyReq); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	accountId := req.PathParams["accountId"]
+	account, err := store.GetAccount(accountId)
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+	for _, scope := range keyReq.Scopes {
+		if !commonHttp.StringInSlice(scope, account.Scopes) {
+			commonHttp.Respond400(rw, fmt.Errorf("scope %q is not granted to service account %q", scope, account.Name))
+			return
+		}
+	}
+	keyScopes := keyReq.Scopes
+	if len(keyScopes) == 0 {
+		keyScopes = account.Scopes
+	}
+	if status, err := c.validateScopes(keyScopes); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	key := models.ApiKey{Description: keyReq.Description, Scopes: keyReq.Scopes, CreatedBy: c.Username}
+	if keyReq.ExpiresIn > 0 {
+		key.ExpiresOn = time.Now().Unix() + keyReq.ExpiresIn
+	}
+	key, secret, err := store.CreateKey(accountId, key)
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, models.ApiKeyCreateResponse{ApiKey: key, Key: secret}, http.StatusCreated)
+}
+
+func (c *Context) ListApiKeys(rw web.ResponseWriter, req *web.Request) {
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	account, err := store.GetAccount(req.PathParams["accountId"])
+	if err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, account.Keys, http.StatusOK)
+}
+
+func (c *Context) RevokeApiKey(rw web.ResponseWriter, req *web.Request) {
+	store, err := getServiceAccountStore()
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	if err := store.RevokeKey(req.PathParams["accountId"], req.PathParams["keyId"]); err != nil {
+		commonHttp.HandleError(rw, err)
+		return
+	}
+
+	commonHttp.WriteJson(rw, "", http.StatusNoContent)
+}
+
+// validateScopes rejects scopes which would not grant any permission, as they are most likely typos, and scopes
+// the caller does not hold, so service account cannot get more permissions than user creating it, unless user is admin
+func (c *Context) validateScopes(scopes []string) (int, error) {
+	policy := getAccessPolicy()
+	for _, scope := range scopes {
+		if len(getGrantedPermissions(policy, []string{scope})) == 0 {
+			return http.StatusBadRequest, fmt.Errorf("scope %q is not granted any permission by access policy", scope)
+		}
+		if !c.IsAdmin && !commonHttp.StringInSlice(scope, c.Scopes) {
+			return http.StatusForbidden, fmt.Errorf("scope %q is not granted to %s", scope, c.Username)
+		}
+	}
+	return http.StatusOK, nil
+}
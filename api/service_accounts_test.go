@@ -0,0 +1,162 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/serviceaccounts"
+	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+func TestServiceAccounts(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouterWithOauth2Activated(t)
+	adminToken := uaa_connector.TapJWTToken{Username: "admin", Scope: []string{adminGroup}}
+
+	adminHeader := http.Header{}
+	adminHeader.Set("Content-Type", "application/json")
+	adminHeader.Set("Authorization", fmt.Sprintf("bearer %s", testToken))
+
+	sendAsAdmin := func(method, url string, body interface{}) *http.Response {
+		mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&adminToken, nil)
+		bodyBytes, _ := json.Marshal(body)
+		return commonHttp.SendRequestWithHeaders(method, url, bodyBytes, mocksAndRouter.router, adminHeader, t).Result()
+	}
+	sendWithApiKey := func(method, url, key string) int {
+		header := http.Header{}
+		header.Set(apiKeyHeader, key)
+		return commonHttp.SendRequestWithHeaders(method, url, nil, mocksAndRouter.router, header, t).Code
+	}
+
+	Convey("Given service account created by admin", t, func() {
+		dir, _ := ioutil.TempDir("", "serviceaccounts")
+		BrokerConfig.ServiceAccountStore = serviceaccounts.NewJsonFileStore(filepath.Join(dir, "service_accounts.json"))
+
+		response := sendAsAdmin("POST", "/api/v3/service_accounts",
+			models.ServiceAccountCreateRequest{Name: "ci", Scopes: []string{userGroup}})
+		So(response.StatusCode, ShouldEqual, http.StatusCreated)
+		account := models.ServiceAccount{}
+		json.NewDecoder(response.Body).Decode(&account)
+
+		response = sendAsAdmin("POST", fmt.Sprintf("/api/v3/service_accounts/%s/keys", account.Id),
+			models.ApiKeyCreateRequest{Description: "pipeline", ExpiresIn: 3600})
+		So(response.StatusCode, ShouldEqual, http.StatusCreated)
+		key := models.ApiKeyCreateResponse{}
+		json.NewDecoder(response.Body).Decode(&key)
+		So(key.Key, ShouldNotBeEmpty)
+		So(key.ExpiresOn, ShouldBeGreaterThan, 0)
+
+		Convey("API key should grant permissions of account scopes", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil)
+
+			So(sendWithApiKey("GET", userAllowedUrl, key.Key), ShouldEqual, http.StatusOK)
+			So(sendWithApiKey("GET", "/api/v3/service_accounts", key.Key), ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("request without credentials after API key request should be rejected", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetServices().Return([]catalogModels.Service{}, http.StatusOK, nil)
+			So(sendWithApiKey("GET", userAllowedUrl, key.Key), ShouldEqual, http.StatusOK)
+
+			response := commonHttp.SendRequestWithHeaders("GET", "/api/v3/service_accounts", nil, mocksAndRouter.router, http.Header{}, t)
+			So(response.Code, ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("bearer token should take precedence over API key", func() {
+			userToken := uaa_connector.TapJWTToken{Username: "user", Scope: []string{userGroup}}
+			mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&userToken, nil)
+
+			header := http.Header{}
+			header.Set("Authorization", fmt.Sprintf("bearer %s", testToken))
+			header.Set(apiKeyHeader, key.Key)
+			response := commonHttp.SendRequestWithHeaders("GET", "/api/v3/service_accounts", nil, mocksAndRouter.router, header, t)
+			So(response.Code, ShouldEqual, http.StatusForbidden)
+		})
+
+		Convey("revoked API key should be rejected", func() {
+			response := sendAsAdmin("DELETE", fmt.Sprintf("/api/v3/service_accounts/%s/keys/%s", account.Id, key.Id), nil)
+			So(response.StatusCode, ShouldEqual, http.StatusNoContent)
+
+			So(sendWithApiKey("GET", userAllowedUrl, key.Key), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("key with scope not granted to account should not be created", func() {
+			response := sendAsAdmin("POST", fmt.Sprintf("/api/v3/service_accounts/%s/keys", account.Id),
+				models.ApiKeyCreateRequest{Scopes: []string{adminGroup}})
+			So(response.StatusCode, ShouldEqual, http.StatusBadRequest)
+		})
+
+		Convey("When service accounts are managed by user who is not admin", func() {
+			accountsManagerScope := "tap.accounts_manager"
+			BrokerConfig.AccessPolicy = &models.AccessPolicy{Roles: append(defaultAccessPolicy.Roles, models.AccessPolicyRole{
+				Scopes:      []string{accountsManagerScope},
+				Permissions: []models.Permission{models.PermissionServiceAccountsManage},
+			})}
+			managerToken := uaa_connector.TapJWTToken{Username: "manager", Scope: []string{userGroup, accountsManagerScope}}
+			sendAsManager := func(method, url string, body interface{}) int {
+				mocksAndRouter.uaaApiMock.EXPECT().ValidateOauth2Token(testToken).Return(&managerToken, nil)
+				bodyBytes, _ := json.Marshal(body)
+				return commonHttp.SendRequestWithHeaders(method, url, bodyBytes, mocksAndRouter.router, adminHeader, t).Code
+			}
+
+			Convey("account with scopes held by the user should be created", func() {
+				So(sendAsManager("POST", "/api/v3/service_accounts",
+					models.ServiceAccountCreateRequest{Name: "deployer", Scopes: []string{userGroup}}), ShouldEqual, http.StatusCreated)
+			})
+
+			Convey("account with scope the user does not hold should not be created", func() {
+				So(sendAsManager("POST", "/api/v3/service_accounts",
+					models.ServiceAccountCreateRequest{Name: "escalated", Scopes: []string{adminGroup}}), ShouldEqual, http.StatusForbidden)
+			})
+
+			Convey("key of account with scope the user does not hold should not be created", func() {
+				response := sendAsAdmin("POST", "/api/v3/service_accounts",
+					models.ServiceAccountCreateRequest{Name: "admin-ci", Scopes: []string{adminGroup}})
+				So(response.StatusCode, ShouldEqual, http.StatusCreated)
+				adminAccount := models.ServiceAccount{}
+				json.NewDecoder(response.Body).Decode(&adminAccount)
+
+				So(sendAsManager("POST", fmt.Sprintf("/api/v3/service_accounts/%s/keys", adminAccount.Id),
+					models.ApiKeyCreateRequest{}), ShouldEqual, http.StatusForbidden)
+			})
+
+			Reset(func() {
+				BrokerConfig.AccessPolicy = nil
+			})
+		})
+
+		Convey("account with the same name should not be created", func() {
+			response := sendAsAdmin("POST", "/api/v3/service_accounts",
+				models.ServiceAccountCreateRequest{Name: "ci", Scopes: []string{userGroup}})
+			So(response.StatusCode, ShouldEqual, http.StatusConflict)
+		})
+
+		Reset(func() {
+			BrokerConfig.ServiceAccountStore = nil
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,373 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// offerings allow to change plan of their instances only when this metadata is set to "true"
+const offeringPlanUpdateableMetadataKey = "planUpdateable"
+
+// metadata managed by platform, which cannot be changed as parameters of instance
+var protectedInstanceMetadataKeys = []string{
+	catalogModels.OFFERING_PLAN_ID,
+	catalogModels.LAST_STATE_CHANGE_REASON,
+	catalogModels.APPLICATION_IMAGE_ADDRESS,
+	organizationMetadataKey,
+	sharedWithMetadataKey,
+	dependencyOfMetadataKey,
+}
+
+// dependencyChanges describes how dependent instances have to be changed after plan of instance is changed
+type dependencyChanges struct {
+	bindingPatches []catalogModels.Patch
+	removed        []string
+}
+
+func isOfferingPlanUpdateable(service catalogModels.Service) bool {
+	return strings.ToLower(catalogModels.GetValueFromMetadata(service.Metadata, offeringPlanUpdateableMetadataKey)) == "true"
+}
+
+// UpdateServiceInstance moves service instance to another plan of its offering and/or changes its parameters.
+// Dependencies of the new plan are created, the ones not needed anymore are removed and the instance is reconfigured.
+func (c *Context) UpdateServiceInstance(rw web.ResponseWriter, req *web.Request) {
+	instanceId := req.PathParams["serviceId"]
+
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	request := models.ServiceInstanceUpdateRequest{}
+	if err := ReadJsonAndValidate(req, &request); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+	if err := validateServiceInstanceUpdateRequest(request); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, fmt.Errorf(errNoServiceInstanceInCatalog, instanceId, err))
+		return
+	}
+	if instance.Type != catalogModels.InstanceTypeService {
+		commonHttp.Respond404(rw, fmt.Errorf(errInstanceIsNotAService, instanceId))
+		return
+	}
+	if instance.State != catalogModels.InstanceStateRunning && instance.State != catalogModels.InstanceStateStopped {
+		commonHttp.GenericRespond(http.StatusConflict, rw, fmt.Errorf("service instance %s has inappropriate state %q", instanceId, string(instance.State)))
+		return
+	}
+
+	service, status, err := BrokerConfig.CatalogApi.GetService(instance.ClassId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	currentPlan, err := getPlanByInstanceMetadata(service, instance.Metadata, instance.Name)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+
+	plan := currentPlan
+	if request.PlanName != "" && request.PlanName != currentPlan.Name {
+		if !isOfferingPlanUpdateable(service) {
+			commonHttp.Respond400(rw, fmt.Errorf("offering %q does not allow to change plan of its instances", service.Name))
+			return
+		}
+		if plan, err = getPlanByName(service, request.PlanName); err != nil {
+			commonHttp.Respond400(rw, err)
+			return
+		}
+		if c.respondIfQuotaExceeded(rw, serviceInstanceQuotaRequest(service, plan)) {
+			return
+		}
+	}
+
+	defaults, err := validatePlanParameters(service, plan, mergeInstanceParameters(instance.Metadata, request.Metadata))
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	patches, err := makeServiceInstanceUpdatePatches(instance, plan, append(request.Metadata, defaults...), c.Username)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+
+	tx := newSaga("update service instance")
+	defer tx.rollbackUnlessCommitted()
+
+	changes, status, err := c.updateServiceInstanceDependencies(instance, currentPlan, plan, tx)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	patches = append(patches, changes.bindingPatches...)
+
+	if _, status, err = BrokerConfig.CatalogApi.UpdateInstance(instanceId, patches); err != nil {
+		commonHttp.GenericRespond(status, rw, fmt.Errorf("cannot update service instance %s in Catalog: %v", instanceId, err))
+		return
+	}
+	tx.commit()
+
+	for _, removedId := range changes.removed {
+		if _, err := c.deleteInstance(removedId); err != nil {
+			logger.Errorf("Cannot delete instance %s which is no longer dependency of instance %s: %v", removedId, instanceId, err)
+		}
+	}
+
+	operationId := startOperation(rw, req, c.Username, models.OperationTypeUpdateService, models.OperationTargetInstance, instanceId,
+		instanceStateCheck(instanceId, catalogModels.InstanceStateRunning))
+	respondAccepted(rw, timeout, instanceStateCondition(instanceId, catalogModels.InstanceStateRunning), operationId)
+}
+
+func validateServiceInstanceUpdateRequest(request models.ServiceInstanceUpdateRequest) error {
+	if request.PlanName == "" && len(request.Metadata) == 0 {
+		return errors.New("planName or metadata has to be given")
+	}
+	for _, metadata := range request.Metadata {
+		if metadata.Id == "" {
+			return errors.New("metadata id cannot be empty")
+		}
+		if commonHttp.StringInSlice(metadata.Id, protectedInstanceMetadataKeys) {
+			return fmt.Errorf("metadata %s is managed by platform and cannot be changed", metadata.Id)
+		}
+	}
+	return nil
+}
+
+// mergeInstanceParameters returns metadata of instance after parameters are applied
+func mergeInstanceParameters(metadata, parameters []catalogModels.Metadata) []catalogModels.Metadata {
+	result := []catalogModels.Metadata{}
+	for _, m := range metadata {
+		if !isParameterGiven(parameters, m.Id) {
+			result = append(result, m)
+		}
+	}
+	for _, parameter := range parameters {
+		if parameter.Value != "" {
+			result = append(result, parameter)
+		}
+	}
+	return result
+}
+
+func isParameterGiven(parameters []catalogModels.Metadata, id string) bool {
+	for _, parameter := range parameters {
+		if parameter.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func getPlanByName(service catalogModels.Service, planName string) (catalogModels.ServicePlan, error) {
+	for _, plan := range service.Plans {
+		if plan.Name == planName {
+			return plan, nil
+		}
+	}
+	return catalogModels.ServicePlan{}, fmt.Errorf("plan %q does not exist in offering %q", planName, service.Name)
+}
+
+// makeServiceInstanceUpdatePatches returns patches which set plan and parameters of instance and start its reconfiguration
+func makeServiceInstanceUpdatePatches(instance catalogModels.Instance, plan catalogModels.ServicePlan,
+	parameters []catalogModels.Metadata, username string) ([]catalogModels.Patch, error) {
+
+	desired := []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: plan.Id}}
+	desired = append(desired, parameters...)
+
+	patches := []catalogModels.Patch{}
+	for _, metadata := range desired {
+		currentValue := catalogModels.GetValueFromMetadata(instance.Metadata, metadata.Id)
+
+		var operation catalogModels.PatchOperation
+		switch {
+		case currentValue == metadata.Value:
+			continue
+		case currentValue == "":
+			operation = catalogModels.OperationAdd
+		case metadata.Value == "":
+			operation = catalogModels.OperationDelete
+		default:
+			operation = catalogModels.OperationUpdate
+		}
+
+		patch, err := builder.MakePatch("Metadata", metadata, operation)
+		if err != nil {
+			return nil, err
+		}
+		patches = append(patches, patch)
+	}
+
+	message := fmt.Sprintf("UpdateServiceInstance request made by: %s", username)
+	statePatches, err := builder.MakePatchesForInstanceStateAndLastStateMetadata(message, instance.State, catalogModels.InstanceStateReconfiguration)
+	if err != nil {
+		return nil, err
+	}
+	patches = append(patches, statePatches...)
+
+	for i := range patches {
+		patches[i].Username = username
+	}
+	return patches, nil
+}
+
+// updateServiceInstanceDependencies creates instances required by new plan and finds the ones not needed anymore.
+// Dependent instance which stays with another plan is moved to that plan, its own dependencies are kept.
+// Created instances are registered in tx, so they are removed when the update fails.
+func (c *Context) updateServiceInstanceDependencies(instance catalogModels.Instance,
+	currentPlan, plan catalogModels.ServicePlan, tx *saga) (dependencyChanges, int, error) {
+
+	changes := dependencyChanges{}
+	if currentPlan.Id == plan.Id {
+		return changes, http.StatusOK, nil
+	}
+
+	currentDependencies := map[string]catalogModels.ServiceDependency{}
+	for _, dependency := range currentPlan.Dependencies {
+		currentDependencies[dependency.ServiceId] = dependency
+	}
+	dependencies := map[string]catalogModels.ServiceDependency{}
+	for _, dependency := range plan.Dependencies {
+		dependencies[dependency.ServiceId] = dependency
+	}
+
+	for _, dependency := range currentPlan.Dependencies {
+		newDependency, kept := dependencies[dependency.ServiceId]
+		if kept && newDependency.PlanId == dependency.PlanId {
+			continue
+		}
+
+		dependentInstance, found, status, err := findDependentInstance(instance, dependency)
+		if err != nil {
+			return changes, status, err
+		}
+		if !found {
+			logger.Warningf("Dependency %s of instance %s not found in its bindings", dependency.ServiceName, instance.Id)
+			if kept {
+				delete(currentDependencies, dependency.ServiceId)
+			}
+			continue
+		}
+
+		if kept {
+			if status, err := changeDependentInstancePlan(dependentInstance, newDependency.PlanId, c.Username, tx); err != nil {
+				return changes, status, err
+			}
+			continue
+		}
+
+		patch, err := builder.MakePatch("Bindings", catalogModels.InstanceBindings{Id: dependentInstance.Id}, catalogModels.OperationDelete)
+		if err != nil {
+			return changes, http.StatusInternalServerError, err
+		}
+		patch.Username = c.Username
+		changes.bindingPatches = append(changes.bindingPatches, patch)
+		changes.removed = append(changes.removed, dependentInstance.Id)
+	}
+
+	for _, dependency := range plan.Dependencies {
+		if _, exists := currentDependencies[dependency.ServiceId]; exists {
+			continue
+		}
+
+		dependentInstance, status, err := c.AddCatalogInstanceFromApiServiceInstance(prepareInstanceFromDependency(instance.Name, dependency))
+		if err != nil {
+			return changes, status, fmt.Errorf("cannot add service instance %s dependency %s to Catalog: %v", instance.Id, dependency.ServiceName, err)
+		}
+		tx.onRollback("delete dependency instance "+dependentInstance.Id, c.deleteInstanceFromCatalog(dependentInstance.Id))
+
+		patch, err := builder.MakePatch("Bindings", catalogModels.InstanceBindings{Id: dependentInstance.Id}, catalogModels.OperationAdd)
+		if err != nil {
+			return changes, http.StatusInternalServerError, err
+		}
+		patch.Username = c.Username
+		changes.bindingPatches = append(changes.bindingPatches, patch)
+	}
+	return changes, http.StatusOK, nil
+}
+
+// findDependentInstance looks for instance created for dependency among instances bound to parent instance
+func findDependentInstance(instance catalogModels.Instance, dependency catalogModels.ServiceDependency) (catalogModels.Instance, bool, int, error) {
+	name := prepareInstanceFromDependency(instance.Name, dependency).Name
+	for _, binding := range instance.Bindings {
+		boundInstance, status, err := BrokerConfig.CatalogApi.GetInstance(binding.Id)
+		if status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return catalogModels.Instance{}, false, status, fmt.Errorf("cannot fetch instance %s bound to %s from Catalog: %v", binding.Id, instance.Id, err)
+		}
+		if boundInstance.ClassId == dependency.ServiceId && boundInstance.Name == name {
+			return boundInstance, true, http.StatusOK, nil
+		}
+	}
+	return catalogModels.Instance{}, false, http.StatusOK, nil
+}
+
+// changeDependentInstancePlan registers change in tx, so dependent instance is moved back to its previous plan when the update fails
+func changeDependentInstancePlan(instance catalogModels.Instance, planId, username string, tx *saga) (int, error) {
+	if status, err := updateInstancePlanInCatalog(instance, planId, username); err != nil {
+		return status, err
+	}
+	previousPlanId := catalogModels.GetValueFromMetadata(instance.Metadata, catalogModels.OFFERING_PLAN_ID)
+	tx.onRollback("restore plan of dependent instance "+instance.Id, restoreInstancePlan(instance.Id, previousPlanId, username))
+	return http.StatusOK, nil
+}
+
+func updateInstancePlanInCatalog(instance catalogModels.Instance, planId, username string) (int, error) {
+	patches, err := makeServiceInstanceUpdatePatches(instance, catalogModels.ServicePlan{Id: planId}, nil, username)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if _, status, err := BrokerConfig.CatalogApi.UpdateInstance(instance.Id, patches); err != nil {
+		return status, fmt.Errorf("cannot change plan of dependent instance %s in Catalog: %v", instance.Id, err)
+	}
+	return http.StatusOK, nil
+}
+
+// restoreInstancePlan reconfigures instance again, as it may have already been reconfigured with the new plan
+func restoreInstancePlan(instanceId, planId, username string) func() error {
+	return func() error {
+		instance, _, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+		if err != nil {
+			return err
+		}
+		_, err = updateInstancePlanInCatalog(instance, planId, username)
+		return err
+	}
+}
@@ -0,0 +1,203 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func describePatch(operation catalogModels.PatchOperation, value interface{}) string {
+	valueBytes, _ := json.Marshal(value)
+	return fmt.Sprintf("%s %s", operation, string(valueBytes))
+}
+
+func describePatchesOfField(patches []catalogModels.Patch, field string) []string {
+	result := []string{}
+	for _, patch := range patches {
+		if *patch.Field == field {
+			result = append(result, fmt.Sprintf("%s %s", patch.Operation, string(*patch.Value)))
+		}
+	}
+	return result
+}
+
+func TestUpdateServiceInstance(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	updateURL := fmt.Sprintf("/api/%s/services/%s", apiPrefix, instanceID1)
+
+	service := catalogModels.Service{Id: serviceID1, Name: serviceName1, Plans: []catalogModels.ServicePlan{
+		{Id: planID1, Name: planName1, Dependencies: []catalogModels.ServiceDependency{{ServiceId: serviceID2, ServiceName: serviceName2, PlanId: planID1}}},
+		{Id: planID2, Name: planName2, Dependencies: []catalogModels.ServiceDependency{{ServiceId: serviceID3, ServiceName: serviceName3, PlanId: planID2}}},
+	}}
+	instance := catalogModels.Instance{Id: instanceID1, Name: instanceName1, ClassId: serviceID1, Type: catalogModels.InstanceTypeService,
+		State:    catalogModels.InstanceStateRunning,
+		Bindings: []catalogModels.InstanceBindings{{Id: instanceID2}},
+		Metadata: []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}, {Id: "SIZE", Value: "small"}},
+	}
+	dependentInstance := catalogModels.Instance{Id: instanceID2, Name: instanceName1 + "-" + serviceName2, ClassId: serviceID2,
+		Type: catalogModels.InstanceTypeService, State: catalogModels.InstanceStateRunning}
+
+	sendUpdate := func(request models.ServiceInstanceUpdateRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(request)
+		return SendPatch(updateURL, bytes.NewReader(body), mocksAndRouter.router)
+	}
+
+	Convey("Test PATCH /services/:serviceId", t, func() {
+		Convey("When plan is changed in offering allowing plan updates", func() {
+			updateableService := service
+			updateableService.Metadata = []catalogModels.Metadata{{Id: offeringPlanUpdateableMetadataKey, Value: "true"}}
+			var instancePatches []catalogModels.Patch
+
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(updateableService, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(dependentInstance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID3).Return(catalogModels.Service{Id: serviceID3}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().AddServiceInstance(serviceID3, gomock.Any()).
+					Return(catalogModels.Instance{Id: instanceID3}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).
+					Do(func(id string, patches []catalogModels.Patch) { instancePatches = patches }).
+					Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(dependentInstance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{dependentInstance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID2, gomock.Any()).Return(dependentInstance, http.StatusOK, nil),
+			)
+
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{PlanName: planName2})
+
+			Convey("new dependency should be bound, old one removed and instance reconfigured", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(describePatchesOfField(instancePatches, "Metadata"), ShouldContain,
+					describePatch(catalogModels.OperationUpdate, catalogModels.Metadata{Id: catalogModels.OFFERING_PLAN_ID, Value: planID2}))
+				So(describePatchesOfField(instancePatches, "Bindings"), ShouldResemble, []string{
+					describePatch(catalogModels.OperationDelete, catalogModels.InstanceBindings{Id: instanceID2}),
+					describePatch(catalogModels.OperationAdd, catalogModels.InstanceBindings{Id: instanceID3}),
+				})
+				So(describePatchesOfField(instancePatches, "State"), ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When dependency stays with other plan and instance update fails", func() {
+			updateableService := catalogModels.Service{Id: serviceID1, Name: serviceName1, Plans: []catalogModels.ServicePlan{
+				{Id: planID1, Name: planName1, Dependencies: []catalogModels.ServiceDependency{{ServiceId: serviceID2, ServiceName: serviceName2, PlanId: planID1}}},
+				{Id: planID2, Name: planName2, Dependencies: []catalogModels.ServiceDependency{{ServiceId: serviceID2, ServiceName: serviceName2, PlanId: planID2}}},
+			}, Metadata: []catalogModels.Metadata{{Id: offeringPlanUpdateableMetadataKey, Value: "true"}}}
+			dependentWithPlan := dependentInstance
+			dependentWithPlan.Metadata = []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}}
+			movedDependent := dependentInstance
+			movedDependent.State = catalogModels.InstanceStateReconfiguration
+			movedDependent.Metadata = []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: planID2}}
+			var changePatches, restorePatches []catalogModels.Patch
+
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(updateableService, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(dependentWithPlan, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID2, gomock.Any()).
+					Do(func(id string, patches []catalogModels.Patch) { changePatches = patches }).
+					Return(movedDependent, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).
+					Return(catalogModels.Instance{}, http.StatusInternalServerError, fmt.Errorf("catalog failure")),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID2).Return(movedDependent, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID2, gomock.Any()).
+					Do(func(id string, patches []catalogModels.Patch) { restorePatches = patches }).
+					Return(dependentWithPlan, http.StatusOK, nil),
+			)
+
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{PlanName: planName2})
+
+			Convey("status code should be 500 and dependent instance should be moved back to its previous plan", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+				So(describePatchesOfField(changePatches, "Metadata"), ShouldContain,
+					describePatch(catalogModels.OperationUpdate, catalogModels.Metadata{Id: catalogModels.OFFERING_PLAN_ID, Value: planID2}))
+				So(describePatchesOfField(restorePatches, "Metadata"), ShouldContain,
+					describePatch(catalogModels.OperationUpdate, catalogModels.Metadata{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}))
+			})
+		})
+
+		Convey("When plan is changed in offering not allowing plan updates", func() {
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(service, http.StatusOK, nil),
+			)
+
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{PlanName: planName2})
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When only parameters are changed", func() {
+			var instancePatches []catalogModels.Patch
+
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(service, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).
+					Do(func(id string, patches []catalogModels.Patch) { instancePatches = patches }).
+					Return(instance, http.StatusOK, nil),
+			)
+
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{PlanName: planName1, Metadata: []catalogModels.Metadata{
+				{Id: "SIZE", Value: ""}, {Id: "REPLICAS", Value: "3"},
+			}})
+
+			Convey("parameters should be patched and dependencies kept", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(describePatchesOfField(instancePatches, "Metadata"), ShouldContain,
+					describePatch(catalogModels.OperationDelete, catalogModels.Metadata{Id: "SIZE"}))
+				So(describePatchesOfField(instancePatches, "Metadata"), ShouldContain,
+					describePatch(catalogModels.OperationAdd, catalogModels.Metadata{Id: "REPLICAS", Value: "3"}))
+				So(describePatchesOfField(instancePatches, "Bindings"), ShouldBeEmpty)
+			})
+		})
+
+		Convey("When platform managed metadata is sent", func() {
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{Metadata: []catalogModels.Metadata{
+				{Id: catalogModels.OFFERING_PLAN_ID, Value: planID2},
+			}})
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When neither plan nor metadata is sent", func() {
+			response := sendUpdate(models.ServiceInstanceUpdateRequest{})
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -37,6 +37,7 @@ func ParseServiceToOffering(service catalogModels.Service, brokerInstance *apiSe
 	apiService.Description = service.Description
 	apiService.Version = catalogModels.GetValueFromMetadata(service.Metadata, "version")
 	apiService.Bindable = service.Bindable
+	apiService.PlanUpdateable = isOfferingPlanUpdateable(service)
 	apiService.Id = service.Id
 	apiService.State = string(service.State)
 	apiService.Metadata = service.Metadata
@@ -49,6 +50,7 @@ func ParseServiceToOffering(service catalogModels.Service, brokerInstance *apiSe
 		servicePlan.OfferingId = apiService.Id
 		servicePlan.Id = plan.Id
 		servicePlan.Active = true
+		servicePlan.ParametersSchema = getRawParametersSchema(service, plan)
 		servicePlan.Free = strings.ToLower(plan.Cost) == "free"
 		apiService.OfferingPlans = append(apiService.OfferingPlans, servicePlan)
 	}
@@ -80,6 +82,7 @@ func (c *Context) AddServiceInDeployingState(catalogService catalogModels.Servic
 	catalogService.State = "DEPLOYING"
 	catalogService.TemplateId = templateIdRelatedToThisService
 	catalogService.AuditTrail = c.getAuditTrail()
+	catalogService.Metadata = c.withOrganization(catalogService.Metadata)
 	return BrokerConfig.CatalogApi.AddService(catalogService)
 }
 
@@ -160,6 +163,9 @@ func validateSingleOffering(service catalogModels.Service) error {
 	}
 
 	for _, plan := range service.Plans {
+		if _, err := getParametersSchema(service, plan); err != nil {
+			return err
+		}
 		for _, dependency := range plan.Dependencies {
 			if dependency.ServiceId == "" || dependency.PlanId == "" {
 				return errors.New(fmt.Sprintf("Dependency: %s service error: ServiceId and PlanId should not be empty!", dependency.ServiceName))
@@ -32,6 +32,8 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 
 	"github.com/trustedanalytics-ng/tap-api-service/client"
+	"github.com/trustedanalytics-ng/tap-api-service/container-stream-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
 	"github.com/trustedanalytics-ng/tap-api-service/models"
 	"github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
 	"github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
@@ -115,6 +117,8 @@ type mocksAndRouter struct {
 	catalogApiMock               *MockTapCatalogApi
 	blobStoreApiMock             *MockTapBlobStoreApi
 	containerBrokerApiMock       *MockTapContainerBrokerApi
+	containerStreamApiMock       *container_stream_connector.MockContainerStreamApi
+	kubernetesApiMock            *kubernetes_connector.MockKubernetesApi
 	uaaApiMock                   *uaa_connector.MockUaaApi
 	userManagementApiFactoryMock *user_management_connector.MockUserManagementFactory
 	userManagementApiMock        *user_management_connector.MockUserManagementApi
@@ -153,6 +157,8 @@ func prepareMocksAndRouterGeneric(t *testing.T, oauthMiddlewareActivated bool) m
 		catalogApiMock:               NewMockTapCatalogApi(mockCtrl),
 		blobStoreApiMock:             NewMockTapBlobStoreApi(mockCtrl),
 		containerBrokerApiMock:       NewMockTapContainerBrokerApi(mockCtrl),
+		containerStreamApiMock:       container_stream_connector.NewMockContainerStreamApi(mockCtrl),
+		kubernetesApiMock:            kubernetes_connector.NewMockKubernetesApi(mockCtrl),
 		uaaApiMock:                   uaa_connector.NewMockUaaApi(mockCtrl),
 		userManagementApiFactoryMock: user_management_connector.NewMockUserManagementFactory(mockCtrl),
 		userManagementApiMock:        user_management_connector.NewMockUserManagementApi(mockCtrl),
@@ -164,6 +170,8 @@ func prepareMocksAndRouterGeneric(t *testing.T, oauthMiddlewareActivated bool) m
 		CatalogApi:         result.catalogApiMock,
 		BlobStoreApi:       result.blobStoreApiMock,
 		ContainerBrokerApi: result.containerBrokerApiMock,
+		ContainerStreamApi: result.containerStreamApiMock,
+		KubernetesApi:      result.kubernetesApiMock,
 		UaaApi:             result.uaaApiMock,
 		UserManagementApiFactory: result.userManagementApiFactoryMock,
 		TemplateRepositoryApi:    result.templateRepositoryApiMock,
@@ -198,6 +206,22 @@ func SendGet(path string, r *web.Router) *httptest.ResponseRecorder {
 	return rr
 }
 
+func SendPut(path string, body io.Reader, r *web.Router) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", path, body)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func SendPatch(path string, body io.Reader, r *web.Router) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", path, body)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
 func PrepareCreateApplicationForm(blobFilename string, manifestFilename string) (bodyBuf *bytes.Buffer, contentType string) {
 	bodyBuf = &bytes.Buffer{}
 	bodyWriter := multipart.NewWriter(bodyBuf)
@@ -0,0 +1,150 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gocraft/web"
+	"github.com/gorilla/websocket"
+
+	"github.com/trustedanalytics-ng/tap-api-service/utils"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const portEnvSuffix = "_PORT"
+
+// OpenServiceTunnel connects to host of service instance and relays TCP connection over WebSocket,
+// so service instance can be used from outside of the platform without exposing it.
+func (c *Context) OpenServiceTunnel(rw web.ResponseWriter, req *web.Request) {
+	instanceId := req.PathParams["serviceId"]
+
+	status, err := c.checkServiceInstanceID(instanceId)
+	if err != nil {
+		c.recordAuditEntry(req, status, "")
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	if !websocket.IsWebSocketUpgrade(req.Request) {
+		c.recordAuditEntry(req, http.StatusBadRequest, "")
+		commonHttp.Respond400(rw, errors.New("tunnel requires WebSocket connection"))
+		return
+	}
+
+	address, status, err := getServiceInstanceAddress(instanceId, commonHttp.GetQueryParameterCaseInsensitive(req, "port"))
+	if err != nil {
+		c.recordAuditEntry(req, status, "")
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	tcpConn, err := net.DialTimeout("tcp", address, commonHttp.ConnectionTimeout)
+	if err != nil {
+		c.recordAuditEntry(req, http.StatusBadGateway, "")
+		commonHttp.GenericRespond(http.StatusBadGateway, rw, fmt.Errorf("cannot connect to service instance %s: %v", instanceId, err))
+		return
+	}
+	defer tcpConn.Close()
+
+	conn, err := upgradeToWebSocket(rw, req, "")
+	if err != nil {
+		// upgrader has already responded with error
+		logger.Errorf("Cannot upgrade tunnel connection to instance %s: %v", instanceId, err)
+		c.recordAuditEntry(req, http.StatusBadRequest, "")
+		return
+	}
+	defer conn.Close()
+
+	c.recordAuditEntry(req, http.StatusSwitchingProtocols, "")
+	logger.Infof("User %s opened tunnel to %s of instance %s", c.Username, address, instanceId)
+	utils.RelayTcpOverWebSocket(conn, tcpConn)
+	logger.Infof("User %s closed tunnel to %s of instance %s", c.Username, address, instanceId)
+}
+
+// getServiceInstanceAddress returns host of instance with requested port. When port is not requested,
+// port from host or the only port found in credentials of instance is used.
+func getServiceInstanceAddress(instanceId, requestedPort string) (string, int, error) {
+	hosts, err := BrokerConfig.ContainerBrokerApi.GetInstanceHosts(instanceId)
+	if err != nil {
+		return "", http.StatusInternalServerError, fmt.Errorf("cannot fetch instance %s hosts from Container Broker: %v", instanceId, err)
+	}
+	if len(hosts) == 0 {
+		return "", http.StatusConflict, fmt.Errorf("service instance %s has no hosts", instanceId)
+	}
+
+	host, hostPort, err := net.SplitHostPort(hosts[0])
+	if err != nil {
+		host, hostPort = hosts[0], ""
+	}
+
+	if requestedPort != "" {
+		if port, err := strconv.Atoi(requestedPort); err != nil || port < 1 || port > 65535 {
+			return "", http.StatusBadRequest, fmt.Errorf("invalid port %q, allowed range is 1-65535", requestedPort)
+		}
+		return net.JoinHostPort(host, requestedPort), http.StatusOK, nil
+	}
+	if hostPort != "" {
+		return net.JoinHostPort(host, hostPort), http.StatusOK, nil
+	}
+
+	ports, status, err := getServiceInstancePorts(instanceId)
+	if err != nil {
+		return "", status, err
+	}
+	switch len(ports) {
+	case 0:
+		return "", http.StatusBadRequest, fmt.Errorf("port of service instance %s cannot be found, it has to be given", instanceId)
+	case 1:
+		return net.JoinHostPort(host, ports[0]), http.StatusOK, nil
+	default:
+		return "", http.StatusBadRequest, fmt.Errorf("service instance %s has many ports, one of them has to be given: %s", instanceId, strings.Join(ports, ", "))
+	}
+}
+
+// getServiceInstancePorts returns values of PORT and *_PORT credentials of instance containers
+func getServiceInstancePorts(instanceId string) ([]string, int, error) {
+	credentials, status, err := BrokerConfig.ContainerBrokerApi.GetCredentials(instanceId)
+	if err != nil {
+		return nil, status, fmt.Errorf("cannot fetch instance %s credentials from Container Broker: %v", instanceId, err)
+	}
+
+	found := map[string]bool{}
+	for _, container := range credentials {
+		for name, value := range container.Envs {
+			if name != "PORT" && !strings.HasSuffix(strings.ToUpper(name), portEnvSuffix) {
+				continue
+			}
+			if port, err := strconv.Atoi(fmt.Sprint(value)); err == nil && port > 0 && port <= 65535 {
+				found[strconv.Itoa(port)] = true
+			}
+		}
+	}
+
+	ports := []string{}
+	for port := range found {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports, http.StatusOK, nil
+}
@@ -0,0 +1,125 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	containerBrokerModels "github.com/trustedanalytics-ng/tap-container-broker/models"
+)
+
+// startTcpEchoServer imitates service instance which sends back everything it receives
+func startTcpEchoServer() net.Listener {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	checkTestingError(err)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener
+}
+
+func TestGetServiceInstanceAddress(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+
+	Convey("Test resolving address of service instance", t, func() {
+		mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceHosts(serviceID1).Return([]string{"db.svc"}, nil)
+
+		Convey("When port is requested it should be used", func() {
+			address, _, err := getServiceInstanceAddress(serviceID1, "5432")
+			So(err, ShouldBeNil)
+			So(address, ShouldEqual, "db.svc:5432")
+		})
+
+		Convey("When port is not requested and credentials contain many ports", func() {
+			credentials := []containerBrokerModels.ContainerCredenials{
+				{Envs: map[string]interface{}{"DB_PORT": "5432", "ADMIN_PORT": float64(8080), "USER": "admin"}},
+			}
+			mocksAndRouter.containerBrokerApiMock.EXPECT().GetCredentials(serviceID1).Return(credentials, http.StatusOK, nil)
+
+			_, status, err := getServiceInstanceAddress(serviceID1, "")
+
+			Convey("error listing them should be returned", func() {
+				So(status, ShouldEqual, http.StatusBadRequest)
+				So(err.Error(), ShouldContainSubstring, "5432, 8080")
+			})
+		})
+
+		Convey("When requested port is invalid", func() {
+			_, status, err := getServiceInstanceAddress(serviceID1, "100000")
+
+			Convey("status code should be 400", func() {
+				So(err, ShouldNotBeNil)
+				So(status, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestOpenServiceTunnel(t *testing.T) {
+	mocksAndRouter, client := prepareMocksAndRouterWithClient(t)
+	echoServer := startTcpEchoServer()
+	echoPort := echoServer.Addr().(*net.TCPAddr).Port
+
+	Convey("Test tunnel opened by client", t, func() {
+		mocksAndRouter.catalogApiMock.EXPECT().GetInstance(serviceID1).
+			Return(catalogModels.Instance{Id: serviceID1, Type: catalogModels.InstanceTypeService}, http.StatusOK, nil)
+		mocksAndRouter.containerBrokerApiMock.EXPECT().GetInstanceHosts(serviceID1).Return([]string{"127.0.0.1"}, nil)
+		mocksAndRouter.containerBrokerApiMock.EXPECT().GetCredentials(serviceID1).Return([]containerBrokerModels.ContainerCredenials{
+			{Envs: map[string]interface{}{"POSTGRES_PORT": float64(echoPort)}},
+		}, http.StatusOK, nil)
+
+		tunnel, err := client.OpenServiceTunnel(serviceID1, 0, "127.0.0.1:0")
+		So(err, ShouldBeNil)
+
+		Convey("data sent to local address should reach service instance and come back", func() {
+			conn, err := net.Dial("tcp", tunnel.Addr().String())
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("ping"))
+			So(err, ShouldBeNil)
+			response := make([]byte, 4)
+			_, err = io.ReadFull(conn, response)
+			So(err, ShouldBeNil)
+			So(string(response), ShouldEqual, "ping")
+		})
+
+		Reset(func() {
+			tunnel.Close()
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
@@ -0,0 +1,347 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gocraft/web"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-catalog/builder"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+// number of previous application versions kept besides the current one
+const (
+	ApplicationPreviousVersionsToKeep        = "APPLICATION_PREVIOUS_VERSIONS_TO_KEEP"
+	ApplicationPreviousVersionsToKeepDefault = 5
+
+	applicationVersionsMetadataKey = "APPLICATION_VERSIONS"
+	initialApplicationVersion      = "initial"
+)
+
+// applicationVersions are kept in application metadata. Every version has its own image built once from blob pushed
+// with it, so application is switched between versions by pointing its ImageId to image of the version.
+type applicationVersions struct {
+	Current     string                     `json:"current"`
+	Pending     *applicationVersionRecord  `json:"pending,omitempty"`
+	RequestedBy string                     `json:"requestedBy,omitempty"`
+	Versions    []applicationVersionRecord `json:"versions"`
+}
+
+type applicationVersionRecord struct {
+	Version   string `json:"version"`
+	ImageId   string `json:"imageId"`
+	CreatedOn int64  `json:"createdOn"`
+	CreatedBy string `json:"createdBy"`
+}
+
+func (v applicationVersions) find(version string) (applicationVersionRecord, bool) {
+	for _, record := range v.Versions {
+		if record.Version == version {
+			return record, true
+		}
+	}
+	return applicationVersionRecord{}, false
+}
+
+// withPending returns retained versions together with pending one
+func (v applicationVersions) withPending() []applicationVersionRecord {
+	records := append([]applicationVersionRecord{}, v.Versions...)
+	if v.Pending != nil {
+		if _, found := v.find(v.Pending.Version); !found {
+			records = append(records, *v.Pending)
+		}
+	}
+	return records
+}
+
+// getApplicationVersionImageId is also id of blob from which image of the version is built
+func getApplicationVersionImageId(applicationId, version string) string {
+	return fmt.Sprintf("%s-%s", catalogModels.GenerateImageId(applicationId), version)
+}
+
+// getApplicationVersions reads versions from application metadata. Application which was never switched
+// has only its initial version, which runs image created with application.
+func getApplicationVersions(application catalogModels.Application) (applicationVersions, error) {
+	value := catalogModels.GetValueFromMetadata(application.Metadata, applicationVersionsMetadataKey)
+	if value == "" {
+		return applicationVersions{
+			Current: initialApplicationVersion,
+			Versions: []applicationVersionRecord{{
+				Version:   initialApplicationVersion,
+				ImageId:   application.ImageId,
+				CreatedOn: application.AuditTrail.CreatedOn,
+				CreatedBy: application.AuditTrail.CreatedBy,
+			}},
+		}, nil
+	}
+
+	versions := applicationVersions{}
+	if err := json.Unmarshal([]byte(value), &versions); err != nil {
+		return versions, fmt.Errorf("cannot parse versions of application %q: %v", application.Id, err)
+	}
+	return versions, nil
+}
+
+// updateApplicationVersions applies change to versions kept in metadata of freshly fetched application
+func updateApplicationVersions(applicationId, username string, change func(*applicationVersions)) (int, error) {
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		return status, err
+	}
+
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	change(&versions)
+
+	value, err := json.Marshal(versions)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	operation := catalogModels.OperationAdd
+	if hasMetadataKey(application.Metadata, applicationVersionsMetadataKey) {
+		operation = catalogModels.OperationUpdate
+	}
+	patch, err := builder.MakePatch("Metadata", catalogModels.Metadata{Id: applicationVersionsMetadataKey, Value: string(value)}, operation)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	patch.Username = username
+
+	_, status, err = BrokerConfig.CatalogApi.UpdateApplication(applicationId, []catalogModels.Patch{patch})
+	return status, err
+}
+
+func clearPendingApplicationVersion(applicationId, username string) func() error {
+	return func() error {
+		_, err := updateApplicationVersions(applicationId, username, func(versions *applicationVersions) {
+			versions.Pending = nil
+			versions.RequestedBy = ""
+		})
+		return err
+	}
+}
+
+func restoreApplicationImageId(applicationId, imageId, username string) func() error {
+	return func() error {
+		_, _, err := UpdateApplicationImageId(applicationId, imageId, username)
+		return err
+	}
+}
+
+// deleteApplicationVersionImage removes image of the version from Catalog and blob it was built from
+func deleteApplicationVersionImage(record applicationVersionRecord) {
+	if record.ImageId == "" {
+		return
+	}
+	if err := deleteImageFromCatalog(record.ImageId)(); err != nil {
+		logger.Warningf("Cannot delete image %q from Catalog: %v", record.ImageId, err)
+	}
+	if err := deleteBlobFromBlobStore(record.ImageId)(); err != nil {
+		logger.Warningf("Cannot delete blob %q from Blob Store: %v", record.ImageId, err)
+	}
+}
+
+func sortApplicationVersionsNewestFirst(records []applicationVersionRecord) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].CreatedOn > records[j].CreatedOn
+	})
+}
+
+// pruneApplicationVersions removes images of versions exceeding configured limit. Current version is never removed.
+func pruneApplicationVersions(applicationId, username string) {
+	toKeep, _ := util.GetUint32EnvValueOrDefault(ApplicationPreviousVersionsToKeep, ApplicationPreviousVersionsToKeepDefault)
+
+	removed := []applicationVersionRecord{}
+	_, err := updateApplicationVersions(applicationId, username, func(versions *applicationVersions) {
+		sortApplicationVersionsNewestFirst(versions.Versions)
+
+		kept := []applicationVersionRecord{}
+		previous := uint32(0)
+		for _, record := range versions.Versions {
+			if record.Version != versions.Current {
+				if previous >= toKeep {
+					removed = append(removed, record)
+					continue
+				}
+				previous++
+			}
+			kept = append(kept, record)
+		}
+		versions.Versions = kept
+	})
+	if err != nil {
+		logger.Errorf("Cannot prune versions of application %q: %v", applicationId, err)
+		return
+	}
+
+	for _, record := range removed {
+		logger.Infof("Removing version %q of application %q", record.Version, applicationId)
+		deleteApplicationVersionImage(record)
+	}
+}
+
+// deleteApplicationVersionImages removes images retained for rollback when application is removed.
+// Image application currently runs is removed with application, as it always was.
+func deleteApplicationVersionImages(application catalogModels.Application) {
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		logger.Warningf("Cannot delete versions of application %q: %v", application.Id, err)
+		return
+	}
+
+	for _, record := range versions.withPending() {
+		if record.ImageId != application.ImageId {
+			deleteApplicationVersionImage(record)
+		}
+	}
+}
+
+func toApplicationVersion(record applicationVersionRecord, versions applicationVersions, pendingImageState catalogModels.ImageState) models.ApplicationVersion {
+	state := catalogModels.ImageStateReady
+	if versions.Pending != nil && versions.Pending.Version == record.Version {
+		state = pendingImageState
+	}
+	return models.ApplicationVersion{
+		Version:   record.Version,
+		State:     state,
+		CreatedOn: record.CreatedOn,
+		CreatedBy: record.CreatedBy,
+		Current:   record.Version == versions.Current,
+	}
+}
+
+func (c *Context) GetApplicationVersions(rw web.ResponseWriter, req *web.Request) {
+	applicationId := req.PathParams["applicationId"]
+
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+
+	records := versions.withPending()
+	pendingImageState := catalogModels.ImageStateReady
+	if versions.Pending != nil {
+		image, status, err := BrokerConfig.CatalogApi.GetImage(versions.Pending.ImageId)
+		if err != nil {
+			commonHttp.GenericRespond(status, rw, err)
+			return
+		}
+		pendingImageState = image.State
+	}
+	sortApplicationVersionsNewestFirst(records)
+
+	result := []models.ApplicationVersion{}
+	for _, record := range records {
+		result = append(result, toApplicationVersion(record, versions, pendingImageState))
+	}
+	commonHttp.WriteJson(rw, result, http.StatusOK)
+}
+
+// checkApplicationVersionImageRetained makes sure application can be switched to the version without rebuilding its image
+func checkApplicationVersionImageRetained(record applicationVersionRecord) (int, error) {
+	if record.ImageId == "" {
+		return http.StatusConflict, fmt.Errorf("image of version %q is not retained", record.Version)
+	}
+	image, status, err := BrokerConfig.CatalogApi.GetImage(record.ImageId)
+	if status == http.StatusNotFound {
+		return http.StatusConflict, fmt.Errorf("image of version %q is not retained", record.Version)
+	}
+	if err != nil {
+		return status, err
+	}
+	if image.State != catalogModels.ImageStateReady {
+		return http.StatusConflict, fmt.Errorf("image of version %q is in state %s", record.Version, image.State)
+	}
+	return http.StatusOK, nil
+}
+
+// RollbackApplication points application to retained image of previous version and restarts its instance, no image is rebuilt
+func (c *Context) RollbackApplication(rw web.ResponseWriter, req *web.Request) {
+	applicationId := req.PathParams["applicationId"]
+
+	timeout, err := parseWaitTimeout(req)
+	if err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	request := models.RollbackRequest{}
+	if err = ReadJsonAndValidate(req, &request); err != nil {
+		commonHttp.Respond400(rw, err)
+		return
+	}
+
+	application, status, err := BrokerConfig.CatalogApi.GetApplication(applicationId)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+
+	versions, err := getApplicationVersions(application)
+	if err != nil {
+		commonHttp.Respond500(rw, err)
+		return
+	}
+	record, found := versions.find(request.Version)
+	if !found {
+		commonHttp.Respond404(rw, fmt.Errorf("version %q of application %q does not exist", request.Version, applicationId))
+		return
+	}
+	if versions.Current == request.Version {
+		commonHttp.GenericRespond(http.StatusConflict, rw, fmt.Errorf("version %q is already current version of application %q", request.Version, applicationId))
+		return
+	}
+	if versions.Pending != nil {
+		commonHttp.GenericRespond(http.StatusConflict, rw, fmt.Errorf("application %q is already being switched to version %q", applicationId, versions.Pending.Version))
+		return
+	}
+	if status, err = checkApplicationVersionImageRetained(record); err != nil {
+		commonHttp.GenericRespond(status, rw, fmt.Errorf("cannot roll back application %q: %v", applicationId, err))
+		return
+	}
+
+	s := newSaga(fmt.Sprintf("rollback of application %s to version %s", applicationId, request.Version))
+	defer s.rollbackUnlessCommitted()
+
+	if status, err = switchApplicationImage(s, application, record, c.Username); err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	s.commit()
+
+	operationId := startOperation(rw, req, c.Username, models.OperationTypeRollback, models.OperationTargetApplication, applicationId,
+		applicationVersionSwitchedCheck(applicationId, record.Version))
+	respondAccepted(rw, timeout, applicationVersionSwitchedCondition(applicationId, record.Version), operationId)
+}
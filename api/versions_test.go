@@ -0,0 +1,328 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+func getTestApplicationWithVersions(versions applicationVersions) catalogModels.Application {
+	imageId := catalogModels.GenerateImageId(applicationID1)
+	if record, found := versions.find(versions.Current); found && record.ImageId != "" {
+		imageId = record.ImageId
+	}
+	value, _ := json.Marshal(versions)
+	return catalogModels.Application{
+		Id:       applicationID1,
+		Name:     "sample",
+		ImageId:  imageId,
+		Metadata: []catalogModels.Metadata{{Id: applicationVersionsMetadataKey, Value: string(value)}},
+	}
+}
+
+func getTestApplicationVersions() applicationVersions {
+	return applicationVersions{
+		Current: "v3",
+		Versions: []applicationVersionRecord{
+			{Version: initialApplicationVersion, ImageId: catalogModels.GenerateImageId(applicationID1), CreatedOn: 100},
+			{Version: "v3", ImageId: getApplicationVersionImageId(applicationID1, "v3"), CreatedOn: 300},
+			{Version: "v2", ImageId: getApplicationVersionImageId(applicationID1, "v2"), CreatedOn: 200},
+		},
+	}
+}
+
+func readApplicationVersionsPatch(patch catalogModels.Patch) applicationVersions {
+	metadata := catalogModels.Metadata{}
+	json.Unmarshal(*patch.Value, &metadata)
+	versions := applicationVersions{}
+	json.Unmarshal([]byte(metadata.Value), &versions)
+	return versions
+}
+
+func TestGetApplicationVersions(t *testing.T) {
+	imageId := catalogModels.GenerateImageId(applicationID1)
+	pendingImageId := getApplicationVersionImageId(applicationID1, "v4")
+	versionsURL := fmt.Sprintf("/api/%s/applications/%s/versions", apiPrefix, applicationID1)
+
+	Convey("Test GET /applications/:applicationId/versions", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		Convey("When application is being switched to pushed version", func() {
+			versions := getTestApplicationVersions()
+			versions.Pending = &applicationVersionRecord{Version: "v4", ImageId: pendingImageId, CreatedOn: 400}
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(getTestApplicationWithVersions(versions), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetImage(pendingImageId).
+				Return(catalogModels.Image{Id: pendingImageId, State: catalogModels.ImageStateBuilding}, http.StatusOK, nil)
+
+			response := SendGet(versionsURL, mocksAndRouter.router)
+
+			Convey("all versions should be returned, the newest first", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ApplicationVersion{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 4)
+				So(result[0].Version, ShouldEqual, "v4")
+				So(result[0].State, ShouldEqual, catalogModels.ImageStateBuilding)
+				So(result[1].Version, ShouldEqual, "v3")
+				So(result[1].Current, ShouldBeTrue)
+				So(result[2].Version, ShouldEqual, "v2")
+				So(result[2].State, ShouldEqual, catalogModels.ImageStateReady)
+				So(result[3].Version, ShouldEqual, initialApplicationVersion)
+				So(result[3].Current, ShouldBeFalse)
+			})
+		})
+
+		Convey("When application has never been switched", func() {
+			application := catalogModels.Application{Id: applicationID1, ImageId: imageId,
+				AuditTrail: catalogModels.AuditTrail{CreatedOn: 100, CreatedBy: ownerUsername}}
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil)
+
+			response := SendGet(versionsURL, mocksAndRouter.router)
+
+			Convey("only initial version should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := []models.ApplicationVersion{}
+				readAndAssertJson(response, &result)
+				So(result, ShouldHaveLength, 1)
+				So(result[0].Version, ShouldEqual, initialApplicationVersion)
+				So(result[0].CreatedBy, ShouldEqual, ownerUsername)
+				So(result[0].Current, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestRollbackApplication(t *testing.T) {
+	rollbackURL := fmt.Sprintf("/api/%s/applications/%s/rollback", apiPrefix, applicationID1)
+	currentImageId := getApplicationVersionImageId(applicationID1, "v3")
+	previousImageId := getApplicationVersionImageId(applicationID1, "v2")
+	previousImage := catalogModels.Image{Id: previousImageId, State: catalogModels.ImageStateReady}
+	instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+
+	Convey("Test POST /applications/:applicationId/rollback", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		Convey("When previous version is retained", func() {
+			application := getTestApplicationWithVersions(getTestApplicationVersions())
+			var imagePatches, versionsPatches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetImage(previousImageId).Return(previousImage, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { imagePatches = p }).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { versionsPatches = p }).Return(application, http.StatusOK, nil),
+			)
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v2"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("application should be pointed to retained image of the version without rebuild and instance restarted", func() {
+				So(response.Code, ShouldEqual, http.StatusAccepted)
+				So(response.Header().Get("Location"), ShouldNotBeEmpty)
+				So(*imagePatches[0].Field, ShouldEqual, "ImageId")
+				So(string(*imagePatches[0].Value), ShouldEqual, fmt.Sprintf("%q", previousImageId))
+
+				versions := readApplicationVersionsPatch(versionsPatches[0])
+				So(versions.Current, ShouldEqual, "v2")
+				So(versions.Pending, ShouldBeNil)
+				So(versions.Versions, ShouldHaveLength, 3)
+			})
+		})
+
+		Convey("When instance cannot be restarted", func() {
+			application := getTestApplicationWithVersions(getTestApplicationVersions())
+			var restorePatches []catalogModels.Patch
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetImage(previousImageId).Return(previousImage, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+					Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).Return(application, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+					Return(catalogModels.Instance{}, http.StatusInternalServerError, fmt.Errorf("catalog failure")),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+					Do(func(id string, p []catalogModels.Patch) { restorePatches = p }).Return(application, http.StatusOK, nil),
+			)
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v2"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 500 and application should be pointed back to current image", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+				So(string(*restorePatches[0].Value), ShouldEqual, fmt.Sprintf("%q", currentImageId))
+			})
+		})
+
+		Convey("When image of previous version no longer exists", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(getTestApplicationWithVersions(getTestApplicationVersions()), http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().GetImage(previousImageId).
+				Return(catalogModels.Image{}, http.StatusNotFound, fmt.Errorf("not found"))
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v2"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 409", func() {
+				So(response.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When application is already being switched", func() {
+			versions := getTestApplicationVersions()
+			versions.Pending = &applicationVersionRecord{Version: "v4"}
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(getTestApplicationWithVersions(versions), http.StatusOK, nil)
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v2"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 409", func() {
+				So(response.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When requested version is current one", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(getTestApplicationWithVersions(getTestApplicationVersions()), http.StatusOK, nil)
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v3"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 409", func() {
+				So(response.Code, ShouldEqual, http.StatusConflict)
+			})
+		})
+
+		Convey("When requested version is not retained", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).
+				Return(getTestApplicationWithVersions(getTestApplicationVersions()), http.StatusOK, nil)
+
+			body, _ := json.Marshal(models.RollbackRequest{Version: "v1"})
+			response := commonHttp.SendRequest("POST", rollbackURL, body, mocksAndRouter.router, t)
+
+			Convey("status code should be 404", func() {
+				So(response.Code, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When version is not provided", func() {
+			response := commonHttp.SendRequest("POST", rollbackURL, []byte("{}"), mocksAndRouter.router, t)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+	})
+}
+
+func TestPruneApplicationVersions(t *testing.T) {
+	imageId := catalogModels.GenerateImageId(applicationID1)
+
+	Convey("Given only one previous version should be kept", t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		os.Setenv(ApplicationPreviousVersionsToKeep, "1")
+		defer os.Unsetenv(ApplicationPreviousVersionsToKeep)
+
+		application := getTestApplicationWithVersions(getTestApplicationVersions())
+		var patches []catalogModels.Patch
+		gomock.InOrder(
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().UpdateApplication(applicationID1, gomock.Any()).
+				Do(func(id string, p []catalogModels.Patch) { patches = p }).Return(application, http.StatusOK, nil),
+			mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(imageId).Return(http.StatusNoContent, nil),
+			mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(imageId).Return(http.StatusNotFound, fmt.Errorf("not found")),
+		)
+
+		pruneApplicationVersions(applicationID1, ownerUsername)
+
+		Convey("the oldest version should be removed with its image", func() {
+			versions := readApplicationVersionsPatch(patches[0])
+			So(versions.Versions, ShouldHaveLength, 2)
+			So(versions.Versions[0].Version, ShouldEqual, "v3")
+			So(versions.Versions[1].Version, ShouldEqual, "v2")
+		})
+	})
+}
+
+func TestDeleteApplicationWithVersions(t *testing.T) {
+	currentImageId := getApplicationVersionImageId(applicationID1, "v3")
+	deleteURL := fmt.Sprintf("/api/%s/applications/%s", apiPrefix, applicationID1)
+
+	Convey(fmt.Sprintf("Test DELETE %s", deleteURL), t, func() {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		defer mocksAndRouter.mockCtrl.Finish()
+
+		application := getTestApplicationWithVersions(getTestApplicationVersions())
+		expectPreviousVersionImagesDeleted := func() {
+			for _, imageId := range []string{catalogModels.GenerateImageId(applicationID1), getApplicationVersionImageId(applicationID1, "v2")} {
+				mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(imageId).Return(http.StatusNoContent, nil)
+				mocksAndRouter.blobStoreApiMock.EXPECT().DeleteBlob(imageId).Return(http.StatusNoContent, nil)
+			}
+		}
+
+		Convey("When application has no instance", func() {
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).Return([]catalogModels.Instance{}, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().DeleteApplication(applicationID1).Return(http.StatusNoContent, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().DeleteImage(currentImageId).Return(http.StatusNoContent, nil)
+			expectPreviousVersionImagesDeleted()
+
+			response := commonHttp.SendRequest("DELETE", deleteURL, nil, mocksAndRouter.router, t)
+
+			Convey("application should be removed with images of its versions", func() {
+				So(response.Code, ShouldEqual, http.StatusNoContent)
+			})
+		})
+
+		Convey("When application has instance", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateRunning}
+			mocksAndRouter.catalogApiMock.EXPECT().GetApplication(applicationID1).Return(application, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().ListApplicationInstances(applicationID1).
+				Return([]catalogModels.Instance{instance}, http.StatusOK, nil)
+			mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil)
+			expectPreviousVersionImagesDeleted()
+
+			response := commonHttp.SendRequest("DELETE", deleteURL, nil, mocksAndRouter.router, t)
+
+			Convey("instance removal should be requested and images of previous versions removed", func() {
+				So(response.Code, ShouldEqual, http.StatusNoContent)
+			})
+		})
+	})
+}
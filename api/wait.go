@@ -0,0 +1,161 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gocraft/web"
+
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+	commonHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+	"github.com/trustedanalytics-ng/tap-go-common/util"
+)
+
+const waitQueryParameter = "wait"
+
+var waitPollInterval = time.Second
+
+// waitCondition reports whether awaited operation is finished and what should be returned to the user
+type waitCondition func() (result interface{}, done bool, status int, err error)
+
+// parseWaitTimeout returns 0 if wait query parameter is not provided, which means asynchronous mode
+func parseWaitTimeout(req *web.Request) (time.Duration, error) {
+	value := commonHttp.GetQueryParameterCaseInsensitive(req, waitQueryParameter)
+	if value == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s parameter %q: %v", waitQueryParameter, value, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("%s parameter has to be positive, got %q", waitQueryParameter, value)
+	}
+
+	maxTimeout, _ := util.GetUint32EnvValueOrDefault(MaxWaitTimeout, MaxWaitTimeoutDefault)
+	if timeout > time.Duration(maxTimeout)*time.Second {
+		return 0, fmt.Errorf("%s parameter cannot be longer than %ds", waitQueryParameter, maxTimeout)
+	}
+	return timeout, nil
+}
+
+func waitUntil(condition waitCondition, timeout time.Duration) (interface{}, int, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		result, done, status, err := condition()
+		if err != nil {
+			return nil, status, err
+		}
+		if done {
+			return result, status, nil
+		}
+		if time.Now().Add(waitPollInterval).After(deadline) {
+			return nil, http.StatusGatewayTimeout, fmt.Errorf("operation did not finish within %v", timeout)
+		}
+		time.Sleep(waitPollInterval)
+	}
+}
+
+func respondWhenConditionMet(rw web.ResponseWriter, timeout time.Duration, condition waitCondition) {
+	result, status, err := waitUntil(condition, timeout)
+	if err != nil {
+		commonHttp.GenericRespond(status, rw, err)
+		return
+	}
+	commonHttp.WriteJson(rw, result, status)
+}
+
+// instanceStateCondition is met when instance reaches one of target states or FAILURE
+func instanceStateCondition(instanceId string, targetStates ...catalogModels.InstanceState) waitCondition {
+	return func() (interface{}, bool, int, error) {
+		instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+		if err != nil {
+			return nil, false, status, fmt.Errorf("cannot fetch instance %q from Catalog: %v", instanceId, err)
+		}
+		if !isInstanceInOneOfStates(instance.State, append(targetStates, catalogModels.InstanceStateFailure)) {
+			logger.Debugf("Waiting for state %v of instance %q. Current state: %q", targetStates, instanceId, instance.State)
+			return nil, false, http.StatusOK, nil
+		}
+
+		result, err := getInstanceResponse(instance)
+		if err != nil {
+			return nil, false, getStatusError(err), err
+		}
+		return result, true, http.StatusOK, nil
+	}
+}
+
+// instanceRemovedCondition is met when instance does not exist in Catalog anymore
+func instanceRemovedCondition(instanceId string) waitCondition {
+	return func() (interface{}, bool, int, error) {
+		instance, status, err := BrokerConfig.CatalogApi.GetInstance(instanceId)
+		if status == http.StatusNotFound {
+			return "", true, http.StatusNoContent, nil
+		}
+		if err != nil {
+			return nil, false, status, fmt.Errorf("cannot fetch instance %q from Catalog: %v", instanceId, err)
+		}
+		if instance.State == catalogModels.InstanceStateFailure {
+			result, err := getInstanceResponse(instance)
+			if err != nil {
+				return nil, false, getStatusError(err), err
+			}
+			return result, true, http.StatusOK, nil
+		}
+		return nil, false, http.StatusOK, nil
+	}
+}
+
+// applicationStateCondition is used when application instance may not exist yet, e.g. during image build
+func applicationStateCondition(applicationId string, targetStates ...catalogModels.InstanceState) waitCondition {
+	return func() (interface{}, bool, int, error) {
+		application, err := getApplicationInstance(applicationId)
+		if err != nil {
+			return nil, false, getStatusError(err), err
+		}
+		if !isInstanceInOneOfStates(application.State, append(targetStates, catalogModels.InstanceStateFailure)) {
+			logger.Debugf("Waiting for state %v of application %q. Current state: %q", targetStates, applicationId, application.State)
+			return nil, false, http.StatusOK, nil
+		}
+		return application, true, http.StatusOK, nil
+	}
+}
+
+func getInstanceResponse(instance catalogModels.Instance) (interface{}, error) {
+	if instance.Type == catalogModels.InstanceTypeApplication {
+		return getApplicationInstance(instance.ClassId)
+	}
+
+	service, _, err := BrokerConfig.CatalogApi.GetService(instance.ClassId)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch service %q from Catalog: %v", instance.ClassId, err)
+	}
+	return ConvertToApiServiceInstance(service, instance)
+}
+
+func isInstanceInOneOfStates(state catalogModels.InstanceState, states []catalogModels.InstanceState) bool {
+	for _, s := range states {
+		if state == s {
+			return true
+		}
+	}
+	return false
+}
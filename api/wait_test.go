@@ -0,0 +1,178 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gocraft/web"
+	"github.com/golang/mock/gomock"
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+func TestStopServiceInstanceWithWait(t *testing.T) {
+	stopURL := fmt.Sprintf("/api/%s/services/%s/stop", apiPrefix, instanceID1)
+	waitPollInterval = time.Millisecond
+
+	instanceWithState := func(state catalogModels.InstanceState) catalogModels.Instance {
+		return catalogModels.Instance{
+			Id:       instanceID1,
+			Type:     catalogModels.InstanceTypeService,
+			ClassId:  serviceID1,
+			State:    state,
+			Metadata: []catalogModels.Metadata{{Id: catalogModels.OFFERING_PLAN_ID, Value: planID1}},
+		}
+	}
+
+	// every case gets its own mocks, so expectations of one case cannot be consumed by another
+	prepareStopRequest := func() mocksAndRouter {
+		mocksAndRouter := prepareMocksAndRouter(t)
+		mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).
+			Return(instanceWithState(catalogModels.InstanceStateStopReq), http.StatusOK, nil)
+		return mocksAndRouter
+	}
+
+	Convey(fmt.Sprintf("Test %s", stopURL), t, func() {
+		Convey("When wait parameter is invalid", func() {
+			mocksAndRouter := prepareMocksAndRouter(t)
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			response := SendPut(stopURL+"?wait=abc", nil, mocksAndRouter.router)
+
+			Convey("status code should be 400", func() {
+				So(response.Code, ShouldEqual, http.StatusBadRequest)
+			})
+		})
+
+		Convey("When wait parameter is provided and instance reaches target state", func() {
+			mocksAndRouter := prepareStopRequest()
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			service := catalogModels.Service{Id: serviceID1, Name: serviceName1, Plans: []catalogModels.ServicePlan{{Id: planID1, Name: planName1}}}
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+					Return(instanceWithState(catalogModels.InstanceStateStopReq), http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+					Return(instanceWithState(catalogModels.InstanceStateStopped), http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetService(serviceID1).Return(service, http.StatusOK, nil),
+			)
+
+			response := SendPut(stopURL+"?wait=1s", nil, mocksAndRouter.router)
+
+			Convey("final instance should be returned", func() {
+				So(response.Code, ShouldEqual, http.StatusOK)
+				result := models.ServiceInstance{}
+				readAndAssertJson(response, &result)
+				So(result.Id, ShouldEqual, instanceID1)
+				So(result.State, ShouldEqual, catalogModels.InstanceStateStopped)
+			})
+		})
+
+		Convey("When wait parameter is provided and instance does not reach target state in time", func() {
+			mocksAndRouter := prepareStopRequest()
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+				Return(instanceWithState(catalogModels.InstanceStateStopReq), http.StatusOK, nil).MinTimes(1)
+
+			response := SendPut(stopURL+"?wait=20ms", nil, mocksAndRouter.router)
+
+			Convey("status code should be 504", func() {
+				So(response.Code, ShouldEqual, http.StatusGatewayTimeout)
+			})
+		})
+
+		Convey("When wait parameter is provided and Catalog returns error while waiting", func() {
+			mocksAndRouter := prepareStopRequest()
+			defer mocksAndRouter.mockCtrl.Finish()
+
+			mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+				Return(catalogModels.Instance{}, http.StatusInternalServerError, errors.New("error"))
+
+			response := SendPut(stopURL+"?wait=1s", nil, mocksAndRouter.router)
+
+			Convey("status code should be 500", func() {
+				So(response.Code, ShouldEqual, http.StatusInternalServerError)
+			})
+		})
+	})
+}
+
+func TestDeleteServiceInstanceWithWait(t *testing.T) {
+	mocksAndRouter := prepareMocksAndRouter(t)
+	deleteURL := fmt.Sprintf("/api/%s/services/%s?wait=1m", apiPrefix, instanceID1)
+	waitPollInterval = time.Millisecond
+
+	Convey(fmt.Sprintf("Test %s", deleteURL), t, func() {
+		Convey("When instance is removed from Catalog", func() {
+			instance := catalogModels.Instance{Id: instanceID1, State: catalogModels.InstanceStateStopped}
+			gomock.InOrder(
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().ListInstances().Return([]catalogModels.Instance{instance}, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().UpdateInstance(instanceID1, gomock.Any()).Return(instance, http.StatusOK, nil),
+				mocksAndRouter.catalogApiMock.EXPECT().GetInstance(instanceID1).
+					Return(catalogModels.Instance{}, http.StatusNotFound, errors.New(keyNotFoundMessage)),
+			)
+
+			req, _ := http.NewRequest("DELETE", deleteURL, nil)
+			response := httptest.NewRecorder()
+			mocksAndRouter.router.ServeHTTP(response, req)
+
+			Convey("status code should be 204", func() {
+				So(response.Code, ShouldEqual, http.StatusNoContent)
+			})
+		})
+
+		Reset(func() {
+			mocksAndRouter.mockCtrl.Finish()
+		})
+	})
+}
+
+func TestParseWaitTimeout(t *testing.T) {
+	testCases := []struct {
+		wait        string
+		expected    time.Duration
+		shouldError bool
+	}{
+		{"", 0, false},
+		{"30s", 30 * time.Second, false},
+		{"2m", 2 * time.Minute, false},
+		{"abc", 0, true},
+		{"-5s", 0, true},
+		{"24h", 0, true},
+	}
+
+	Convey("For set of test cases parseWaitTimeout should return proper responses", t, func() {
+		for _, tc := range testCases {
+			Convey(fmt.Sprintf("For wait %q", tc.wait), func() {
+				req, _ := http.NewRequest("PUT", "/?wait="+tc.wait, nil)
+				result, err := parseWaitTimeout(&web.Request{Request: req})
+				So(err != nil, ShouldEqual, tc.shouldError)
+				So(result, ShouldEqual, tc.expected)
+			})
+		}
+	})
+}
@@ -0,0 +1,108 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+type Filter struct {
+	From     int64
+	To       int64
+	Username string
+	// Limit keeps only the latest entries, 0 means no limit
+	Limit int
+}
+
+func (f Filter) Matches(entry models.AuditEntry) bool {
+	if entry.Timestamp < f.From || entry.Timestamp > f.To {
+		return false
+	}
+	return f.Username == "" || f.Username == entry.Username
+}
+
+type Sink interface {
+	Record(entry models.AuditEntry) error
+	Query(filter Filter) ([]models.AuditEntry, error)
+}
+
+// JsonLinesSink appends every entry as a single JSON line to local file
+type JsonLinesSink struct {
+	path  string
+	mutex sync.Mutex
+}
+
+func NewJsonLinesSink(path string) *JsonLinesSink {
+	return &JsonLinesSink{path: path}
+}
+
+func (s *JsonLinesSink) Record(entry models.AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func (s *JsonLinesSink) Query(filter Filter) ([]models.AuditEntry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	result := []models.AuditEntry{}
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry := models.AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if filter.Matches(entry) {
+			result = append(result, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit > 0 && len(result) > filter.Limit {
+		result = result[len(result)-filter.Limit:]
+	}
+	return result, nil
+}
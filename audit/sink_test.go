@@ -0,0 +1,72 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package audit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+func TestJsonLinesSink(t *testing.T) {
+	Convey("Test JsonLinesSink", t, func() {
+		dir, err := ioutil.TempDir("", "audit")
+		So(err, ShouldBeNil)
+		sink := NewJsonLinesSink(filepath.Join(dir, "audit.jsonl"))
+
+		Convey("When nothing was recorded", func() {
+			entries, err := sink.Query(Filter{To: 100})
+
+			Convey("empty list should be returned", func() {
+				So(err, ShouldBeNil)
+				So(entries, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When entries were recorded", func() {
+			recorded := []models.AuditEntry{
+				{Timestamp: 10, Username: "admin", Action: "POST /api/v1/services", Status: 202},
+				{Timestamp: 20, Username: "user", Action: "DELETE /api/v1/services/:serviceId", TargetId: "id", Status: 204},
+				{Timestamp: 30, Username: "admin", Action: "PUT /api/v1/services/:serviceId/stop", TargetId: "id", Status: 202},
+			}
+			for _, entry := range recorded {
+				So(sink.Record(entry), ShouldBeNil)
+			}
+
+			Convey("they should be filtered by time range and user", func() {
+				entries, err := sink.Query(Filter{From: 15, To: 100, Username: "admin"})
+				So(err, ShouldBeNil)
+				So(entries, ShouldResemble, recorded[2:])
+			})
+
+			Convey("only the latest should be returned when limit is set", func() {
+				entries, err := sink.Query(Filter{To: 100, Limit: 2})
+				So(err, ShouldBeNil)
+				So(entries, ShouldResemble, recorded[1:])
+			})
+		})
+
+		Reset(func() {
+			os.RemoveAll(dir)
+		})
+	})
+}
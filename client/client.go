@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"mime/multipart"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/trustedanalytics-ng/tap-api-service/models"
@@ -64,6 +65,7 @@ type TapApiServiceApi interface {
 	GetApplicationLogs(applicationId string) (map[string]string, error)
 	GetServiceLogs(serviceId string) (map[string]string, error)
 	GetInstanceCredentials(instanceId string) ([]containerBrokerModels.ContainerCredenials, error)
+	GetOperation(operationId string) (models.Operation, error)
 
 	ListApplicationInstances() ([]models.ApplicationInstance, error)
 	ListServiceInstances() ([]models.ServiceInstance, error)
@@ -83,17 +85,21 @@ type TapApiServiceApi interface {
 	DeleteInvitation(email string) error
 
 	ExposeService(serviceId string, exposed bool) ([]string, int, error)
+	OpenServiceTunnel(serviceId string, port int, localAddress string) (*Tunnel, error)
 
 	GetUsers() ([]userManagement.UaaUser, error)
+	GetCurrentUserPermissions() (models.UserPermissions, error)
 	ChangeCurrentUserPassword(password, newPassword string) error
 	DeleteUser(email string) error
 }
 
 type TapApiServiceApiOAuth2Connector struct {
-	Address   string
-	TokenType string
-	Token     string
-	Client    *http.Client
+	Address     string
+	TokenType   string
+	Token       string
+	Client      *http.Client
+	TokenSource TokenSource
+	tokenMutex  sync.Mutex
 }
 
 func SetLoggerLevel(level string) error {
@@ -119,6 +125,31 @@ func NewTapApiServiceApiWithOAuth2AndCustomSSLValidation(address, tokenType, tok
 	return
 }
 
+// NewTapApiServiceApiWithOAuth2AndTokenSource returns client which obtains new token from tokenSource
+// and repeats request when api-service responds with 401, e.g. because token expired
+func NewTapApiServiceApiWithOAuth2AndTokenSource(address, tokenType, token string, tokenSource TokenSource,
+	skipSSLValidation bool) (TapApiServiceApi, error) {
+
+	client, _, err := brokerHttp.GetHttpClientWithCustomSSLValidation(skipSSLValidation)
+	if err != nil {
+		return nil, err
+	}
+
+	connector := &TapApiServiceApiOAuth2Connector{
+		Address:     address,
+		TokenType:   tokenType,
+		Token:       token,
+		Client:      client,
+		TokenSource: tokenSource,
+	}
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	client.Transport = &tokenRefreshingTransport{connector: connector, base: base}
+	return connector, nil
+}
+
 func getAddressCommon(addr string, format string, args ...interface{}) string {
 	return fmt.Sprintf("%s/api/%s", addr, apiVer) + fmt.Sprintf(format, args...)
 }
@@ -140,7 +171,7 @@ func (c *TapApiServiceApiOAuth2Connector) getAddress(endpointFormat string, args
 
 func (c *TapApiServiceApiOAuth2Connector) getApiOAuth2Connector(endpointFormat string, args ...interface{}) brokerHttp.ApiConnector {
 	return brokerHttp.ApiConnector{
-		OAuth2: &brokerHttp.OAuth2{TokenType: c.TokenType, Token: c.Token},
+		OAuth2: c.getOAuth2(),
 		Client: c.Client,
 		Url:    c.getAddress(endpointFormat, args...),
 	}
@@ -236,6 +267,13 @@ func (c *TapApiServiceApiOAuth2Connector) GetServiceInstance(serviceId string) (
 	return *result, err
 }
 
+func (c *TapApiServiceApiOAuth2Connector) GetOperation(operationId string) (models.Operation, error) {
+	connector := c.getApiOAuth2Connector("/operations/%s", operationId)
+	result := &models.Operation{}
+	_, err := brokerHttp.GetModel(connector, http.StatusOK, result)
+	return *result, err
+}
+
 func (c *TapApiServiceApiOAuth2Connector) StartServiceInstance(instanceId string) (containerBrokerModels.MessageResponse, error) {
 	connector := c.getApiOAuth2Connector("/services/%s/start", instanceId)
 	result := &containerBrokerModels.MessageResponse{}
@@ -338,6 +376,13 @@ func (c *TapApiServiceApiOAuth2Connector) GetUsers() ([]userManagement.UaaUser,
 	return result, err
 }
 
+func (c *TapApiServiceApiOAuth2Connector) GetCurrentUserPermissions() (models.UserPermissions, error) {
+	connector := c.getApiOAuth2Connector("/users/current/permissions")
+	result := &models.UserPermissions{}
+	_, err := brokerHttp.GetModel(connector, http.StatusOK, result)
+	return *result, err
+}
+
 func (c *TapApiServiceApiOAuth2Connector) DeleteInvitation(email string) error {
 	connector := c.getApiOAuth2Connector("/users/invitations")
 	body := userManagement.InvitationRequest{
@@ -21,12 +21,14 @@ import (
 
 	"errors"
 
+	"github.com/trustedanalytics-ng/tap-api-service/models"
 	uaa "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
 	brokerHttp "github.com/trustedanalytics-ng/tap-go-common/http"
 )
 
 type TapApiServiceLoginApi interface {
 	Login() (uaa.LoginResponse, int, error)
+	RefreshToken(refreshToken string) (uaa.LoginResponse, int, error)
 	GetApiServiceHealth() error
 	GetLoginCredentials() (Address, Username, Password string)
 	Introduce() error
@@ -85,6 +87,13 @@ func (c *TapApiServiceApiBasicAuthConnector) Login() (uaa.LoginResponse, int, er
 	return *result, status, err
 }
 
+func (c *TapApiServiceApiBasicAuthConnector) RefreshToken(refreshToken string) (uaa.LoginResponse, int, error) {
+	connector := brokerHttp.ApiConnector{Client: c.Client, Url: c.getAddress("/login/refresh")}
+	result := &uaa.LoginResponse{}
+	status, err := brokerHttp.PostModel(connector, models.RefreshTokenRequest{RefreshToken: refreshToken}, http.StatusOK, result)
+	return *result, status, err
+}
+
 func (c *TapApiServiceApiBasicAuthConnector) GetApiServiceHealth() error {
 	connector := c.getApiBasicAuthConnector(fmt.Sprintf("%s/healthz", c.Address))
 	status, _, err := brokerHttp.RestGET(connector.Url, brokerHttp.GetBasicAuthHeader(connector.BasicAuth), connector.Client)
@@ -0,0 +1,139 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"errors"
+	"net/http"
+
+	uaa "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+	brokerHttp "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// TokenSource provides new access token when api-service rejects the current one
+type TokenSource interface {
+	RefreshToken() (tokenType, token string, err error)
+}
+
+type loginTokenSource struct {
+	loginApi     TapApiServiceLoginApi
+	refreshToken string
+}
+
+// NewLoginTokenSource returns TokenSource which exchanges refresh token for new access token
+// and logs in again with credentials of loginApi when refresh token is no longer valid
+func NewLoginTokenSource(loginApi TapApiServiceLoginApi, refreshToken string) TokenSource {
+	return &loginTokenSource{loginApi: loginApi, refreshToken: refreshToken}
+}
+
+func (s *loginTokenSource) RefreshToken() (string, string, error) {
+	if s.refreshToken != "" {
+		loginResp, _, err := s.loginApi.RefreshToken(s.refreshToken)
+		if err == nil {
+			return s.useLoginResponse(loginResp)
+		}
+		logger.Warning("Refreshing token failed, logging in again:", err)
+	}
+
+	loginResp, _, err := s.loginApi.Login()
+	if err != nil {
+		return "", "", err
+	}
+	return s.useLoginResponse(loginResp)
+}
+
+func (s *loginTokenSource) useLoginResponse(loginResp uaa.LoginResponse) (string, string, error) {
+	if loginResp.AccessToken == "" {
+		return "", "", errors.New("api-service returned empty access token")
+	}
+	if loginResp.RefreshToken != "" {
+		s.refreshToken = loginResp.RefreshToken
+	}
+	return loginResp.TokenType, loginResp.AccessToken, nil
+}
+
+// tokenRefreshingTransport repeats request rejected with 401 once, with token obtained from TokenSource
+type tokenRefreshingTransport struct {
+	connector *TapApiServiceApiOAuth2Connector
+	base      http.RoundTripper
+}
+
+func (t *tokenRefreshingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	if req.Body != nil && req.GetBody == nil {
+		// body was consumed and cannot be sent again
+		return resp, nil
+	}
+
+	authHeader, err := t.connector.refreshToken(req.Header.Get("Authorization"))
+	if err != nil {
+		logger.Error("Refreshing token failed:", err)
+		return resp, nil
+	}
+
+	retry := new(http.Request)
+	*retry = *req
+	retry.Header = http.Header{}
+	for key, values := range req.Header {
+		retry.Header[key] = values
+	}
+	retry.Header.Set("Authorization", authHeader)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+
+	resp.Body.Close()
+	return t.base.RoundTrip(retry)
+}
+
+// getBaseTransport returns transport of client, skipping token refreshing wrapper
+func getBaseTransport(client *http.Client) http.RoundTripper {
+	if transport, ok := client.Transport.(*tokenRefreshingTransport); ok {
+		return transport.base
+	}
+	return client.Transport
+}
+
+func (c *TapApiServiceApiOAuth2Connector) getOAuth2() *brokerHttp.OAuth2 {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+	return &brokerHttp.OAuth2{TokenType: c.TokenType, Token: c.Token}
+}
+
+// refreshToken returns Authorization header which should replace rejected one.
+// Token is not refreshed again if other request already replaced the rejected token.
+func (c *TapApiServiceApiOAuth2Connector) refreshToken(rejectedAuthHeader string) (string, error) {
+	c.tokenMutex.Lock()
+	defer c.tokenMutex.Unlock()
+
+	currentAuthHeader := brokerHttp.GetOAuth2Header(&brokerHttp.OAuth2{TokenType: c.TokenType, Token: c.Token})
+	if currentAuthHeader != rejectedAuthHeader {
+		return currentAuthHeader, nil
+	}
+
+	tokenType, token, err := c.TokenSource.RefreshToken()
+	if err != nil {
+		return "", err
+	}
+	c.TokenType = tokenType
+	c.Token = token
+	return brokerHttp.GetOAuth2Header(&brokerHttp.OAuth2{TokenType: c.TokenType, Token: c.Token}), nil
+}
@@ -0,0 +1,132 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+	uaa "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
+)
+
+type fakeTokenSource struct {
+	calls int
+	token string
+	err   error
+}
+
+func (s *fakeTokenSource) RefreshToken() (string, string, error) {
+	s.calls++
+	return "bearer", s.token, s.err
+}
+
+type fakeLoginApi struct {
+	TapApiServiceLoginApi
+	refreshErr error
+	logins     int
+}
+
+func (f *fakeLoginApi) RefreshToken(refreshToken string) (uaa.LoginResponse, int, error) {
+	if f.refreshErr != nil {
+		return uaa.LoginResponse{}, http.StatusUnauthorized, f.refreshErr
+	}
+	return uaa.LoginResponse{TokenType: "bearer", AccessToken: "refreshed-" + refreshToken, RefreshToken: "next"}, http.StatusOK, nil
+}
+
+func (f *fakeLoginApi) Login() (uaa.LoginResponse, int, error) {
+	f.logins++
+	return uaa.LoginResponse{TokenType: "bearer", AccessToken: "logged-in", RefreshToken: "fresh"}, http.StatusOK, nil
+}
+
+func TestTokenRefreshingClient(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Authorization") != "bearer valid" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		rw.Write([]byte(`{"cli_version": "0.8"}`))
+	}))
+	defer server.Close()
+
+	Convey("Test client with token source", t, func() {
+		requests = 0
+
+		Convey("When token expired and new one can be obtained", func() {
+			tokenSource := &fakeTokenSource{token: "valid"}
+			client, _ := NewTapApiServiceApiWithOAuth2AndTokenSource(server.URL, "bearer", "expired", tokenSource, false)
+
+			info, err := client.GetPlatformInfo()
+
+			Convey("request should be repeated with new token", func() {
+				So(err, ShouldBeNil)
+				So(info, ShouldResemble, models.PlatformInfo{CliVersion: "0.8"})
+				So(requests, ShouldEqual, 2)
+				So(tokenSource.calls, ShouldEqual, 1)
+				So(client.(*TapApiServiceApiOAuth2Connector).Token, ShouldEqual, "valid")
+			})
+		})
+
+		Convey("When new token cannot be obtained", func() {
+			tokenSource := &fakeTokenSource{err: errors.New("refresh token expired")}
+			client, _ := NewTapApiServiceApiWithOAuth2AndTokenSource(server.URL, "bearer", "expired", tokenSource, false)
+
+			_, err := client.GetPlatformInfo()
+
+			Convey("original 401 should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(requests, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestLoginTokenSource(t *testing.T) {
+	Convey("Test login token source", t, func() {
+		Convey("When refresh token is valid", func() {
+			loginApi := &fakeLoginApi{}
+			tokenSource := NewLoginTokenSource(loginApi, "first")
+
+			_, token, err := tokenSource.RefreshToken()
+			So(err, ShouldBeNil)
+			_, nextToken, err := tokenSource.RefreshToken()
+
+			Convey("tokens should be refreshed with rotated refresh token", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "refreshed-first")
+				So(nextToken, ShouldEqual, "refreshed-next")
+				So(loginApi.logins, ShouldEqual, 0)
+			})
+		})
+
+		Convey("When refresh token is rejected", func() {
+			loginApi := &fakeLoginApi{refreshErr: errors.New("invalid_grant")}
+			_, token, err := NewLoginTokenSource(loginApi, "expired").RefreshToken()
+
+			Convey("client should log in again", func() {
+				So(err, ShouldBeNil)
+				So(token, ShouldEqual, "logged-in")
+				So(loginApi.logins, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,128 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/trustedanalytics-ng/tap-api-service/utils"
+	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// Tunnel forwards every connection accepted on local address to service instance, until it is closed
+type Tunnel struct {
+	listener  net.Listener
+	url       string
+	connector *TapApiServiceApiOAuth2Connector
+	dialer    *websocket.Dialer
+}
+
+// OpenServiceTunnel starts listening on localAddress (e.g. "localhost:5432" or "localhost:0" for any free port).
+// Port 0 means that port of service instance is chosen by API service.
+func (c *TapApiServiceApiOAuth2Connector) OpenServiceTunnel(serviceId string, port int, localAddress string) (*Tunnel, error) {
+	address := c.getAddress("/services/%s/tunnel", serviceId)
+	if port > 0 {
+		address += fmt.Sprintf("?port=%d", port)
+	}
+	if strings.HasPrefix(address, "https://") {
+		address = "wss://" + strings.TrimPrefix(address, "https://")
+	} else {
+		address = "ws://" + strings.TrimPrefix(address, "http://")
+	}
+
+	dialer := &websocket.Dialer{HandshakeTimeout: commonHTTP.ConnectionTimeout}
+	if transport, ok := getBaseTransport(c.Client).(*http.Transport); ok {
+		dialer.Proxy = transport.Proxy
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	listener, err := net.Listen("tcp", localAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnel := &Tunnel{
+		listener:  listener,
+		url:       address,
+		connector: c,
+		dialer:    dialer,
+	}
+	go tunnel.serve()
+
+	logger.Infof("Forwarding connections from %v to service %s", listener.Addr(), serviceId)
+	return tunnel, nil
+}
+
+// Addr returns local address on which tunnel listens
+func (t *Tunnel) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Close stops accepting new connections, already forwarded connections are not interrupted
+func (t *Tunnel) Close() error {
+	return t.listener.Close()
+}
+
+func (t *Tunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				continue
+			}
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+func (t *Tunnel) forward(conn net.Conn) {
+	defer conn.Close()
+
+	ws, response, err := t.dial()
+	if err != nil {
+		if response != nil {
+			err = fmt.Errorf("%v, status: %d", err, response.StatusCode)
+		}
+		logger.Errorf("Cannot open tunnel %s: %v", t.url, err)
+		return
+	}
+	defer ws.Close()
+
+	utils.RelayTcpOverWebSocket(ws, conn)
+}
+
+// dial opens websocket with current token of connector, so every forwarded connection uses token
+// refreshed in the meantime. Handshake rejected with 401 is repeated once with token from TokenSource.
+func (t *Tunnel) dial() (*websocket.Conn, *http.Response, error) {
+	authHeader := commonHTTP.GetOAuth2Header(t.connector.getOAuth2())
+	ws, response, err := t.dialer.Dial(t.url, http.Header{"Authorization": {authHeader}})
+	if err == nil || response == nil || response.StatusCode != http.StatusUnauthorized || t.connector.TokenSource == nil {
+		return ws, response, err
+	}
+
+	authHeader, refreshErr := t.connector.refreshToken(authHeader)
+	if refreshErr != nil {
+		logger.Error("Refreshing token failed:", refreshErr)
+		return ws, response, err
+	}
+	return t.dialer.Dial(t.url, http.Header{"Authorization": {authHeader}})
+}
@@ -0,0 +1,106 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package client
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// startWebSocketEchoServer imitates tunnel endpoint of api-service which accepts only "bearer valid" token
+func startWebSocketEchoServer() *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "bearer valid" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		ws, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+		for {
+			messageType, message, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = ws.WriteMessage(messageType, message); err != nil {
+				return
+			}
+		}
+	}))
+}
+
+func sendThroughTunnel(tunnel *Tunnel, data string) (string, error) {
+	conn, err := net.Dial("tcp", tunnel.Addr().String())
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if _, err = conn.Write([]byte(data)); err != nil {
+		return "", err
+	}
+	response := make([]byte, len(data))
+	_, err = io.ReadFull(conn, response)
+	return string(response), err
+}
+
+func TestOpenServiceTunnel(t *testing.T) {
+	server := startWebSocketEchoServer()
+	defer server.Close()
+
+	Convey("Test service tunnel", t, func() {
+		Convey("When token was replaced after tunnel had been opened", func() {
+			client, _ := NewTapApiServiceApiWithOAuth2(server.URL, "bearer", "expired")
+			connector := client.(*TapApiServiceApiOAuth2Connector)
+			tunnel, err := connector.OpenServiceTunnel("service-id", 0, "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer tunnel.Close()
+
+			connector.Token = "valid"
+			response, err := sendThroughTunnel(tunnel, "ping")
+
+			Convey("new connection should use current token", func() {
+				So(err, ShouldBeNil)
+				So(response, ShouldEqual, "ping")
+			})
+		})
+
+		Convey("When token expired and new one can be obtained", func() {
+			tokenSource := &fakeTokenSource{token: "valid"}
+			client, _ := NewTapApiServiceApiWithOAuth2AndTokenSource(server.URL, "bearer", "expired", tokenSource, false)
+			tunnel, err := client.(*TapApiServiceApiOAuth2Connector).OpenServiceTunnel("service-id", 0, "127.0.0.1:0")
+			So(err, ShouldBeNil)
+			defer tunnel.Close()
+
+			response, err := sendThroughTunnel(tunnel, "ping")
+
+			Convey("connection should be opened with refreshed token", func() {
+				So(err, ShouldBeNil)
+				So(response, ShouldEqual, "ping")
+				So(tokenSource.calls, ShouldEqual, 1)
+			})
+		})
+	})
+}
@@ -0,0 +1,184 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container_stream_connector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	kubernetesApi "github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const podPhaseRunning = "Running"
+
+// execSubprotocols are offered to Kubernetes when client does not request any
+var execSubprotocols = []string{"v4.channel.k8s.io", "channel.k8s.io"}
+
+type ExecOptions struct {
+	Container string
+	Command   []string
+	Tty       bool
+}
+
+// ContainerStreamApi opens WebSocket streams to containers of instances through Kubernetes API server
+type ContainerStreamApi interface {
+	Exec(instanceId string, options ExecOptions, subprotocols []string) (*websocket.Conn, int, error)
+}
+
+// ContainerStreamConnector uses pods/exec subresource, so service account of api-service needs
+// permission to list pods and to create pods/exec in namespace of instances
+type ContainerStreamConnector struct {
+	Address   string
+	Namespace string
+	Token     string
+	Client    *http.Client
+	Dialer    *websocket.Dialer
+}
+
+type podList struct {
+	Items []pod `json:"items"`
+}
+
+type pod struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Containers []struct {
+			Name string `json:"name"`
+		} `json:"containers"`
+	} `json:"spec"`
+	Status struct {
+		Phase string `json:"phase"`
+	} `json:"status"`
+}
+
+func NewContainerStreamConnector(credentials kubernetesApi.Credentials) (*ContainerStreamConnector, error) {
+	client, transport, err := commonHTTP.GetHttpClientWithCa(credentials.CaPem)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &websocket.Dialer{
+		Proxy:            transport.Proxy,
+		TLSClientConfig:  transport.TLSClientConfig,
+		HandshakeTimeout: commonHTTP.ConnectionTimeout,
+	}
+	return &ContainerStreamConnector{Address: credentials.Address, Namespace: credentials.Namespace, Token: credentials.Token,
+		Client: client, Dialer: dialer}, nil
+}
+
+// Exec starts command in container of running pod of instance, stdin, stdout and stderr are carried
+// by messages of returned connection framed according to negotiated channel.k8s.io subprotocol
+func (c *ContainerStreamConnector) Exec(instanceId string, options ExecOptions, subprotocols []string) (*websocket.Conn, int, error) {
+	target, status, err := c.getRunningPod(instanceId)
+	if err != nil {
+		return nil, status, err
+	}
+
+	container := options.Container
+	if container == "" && len(target.Spec.Containers) > 0 {
+		container = target.Spec.Containers[0].Name
+	}
+	query := url.Values{}
+	query.Set("container", container)
+	query.Set("stdin", "true")
+	query.Set("stdout", "true")
+	// Kubernetes merges stderr into stdout of terminal and rejects separate stream
+	query.Set("stderr", strconv.FormatBool(!options.Tty))
+	query.Set("tty", strconv.FormatBool(options.Tty))
+	for _, arg := range options.Command {
+		query.Add("command", arg)
+	}
+	if len(subprotocols) == 0 {
+		subprotocols = execSubprotocols
+	}
+	return c.dial(fmt.Sprintf("/api/v1/namespaces/%s/pods/%s/exec?%s", c.Namespace, target.Metadata.Name, query.Encode()), subprotocols)
+}
+
+// getRunningPod picks running pod of instance, the one with lowest name if instance is scaled
+func (c *ContainerStreamConnector) getRunningPod(instanceId string) (pod, int, error) {
+	query := url.Values{}
+	query.Set("labelSelector", kubernetesApi.InstanceIdLabel+"="+instanceId)
+	request, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v1/namespaces/%s/pods?%s", c.Address, c.Namespace, query.Encode()), nil)
+	if err != nil {
+		return pod{}, http.StatusInternalServerError, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.Token)
+
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return pod{}, http.StatusBadGateway, fmt.Errorf("cannot connect to Kubernetes API: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(response.Body)
+		return pod{}, http.StatusBadGateway, fmt.Errorf("Kubernetes API responded with status %d when listing pods: %s", response.StatusCode, string(body))
+	}
+
+	pods := podList{}
+	if err := json.NewDecoder(response.Body).Decode(&pods); err != nil {
+		return pod{}, http.StatusBadGateway, fmt.Errorf("cannot parse pods listed by Kubernetes API: %v", err)
+	}
+	sort.Slice(pods.Items, func(i, j int) bool {
+		return pods.Items[i].Metadata.Name < pods.Items[j].Metadata.Name
+	})
+	for _, item := range pods.Items {
+		if item.Status.Phase == podPhaseRunning {
+			return item, http.StatusOK, nil
+		}
+	}
+	return pod{}, http.StatusNotFound, fmt.Errorf("instance %s has no running container", instanceId)
+}
+
+func (c *ContainerStreamConnector) dial(path string, subprotocols []string) (*websocket.Conn, int, error) {
+	address := c.Address
+	if strings.HasPrefix(address, "https://") {
+		address = "wss://" + strings.TrimPrefix(address, "https://")
+	} else if strings.HasPrefix(address, "http://") {
+		address = "ws://" + strings.TrimPrefix(address, "http://")
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+c.Token)
+
+	dialer := *c.Dialer
+	dialer.Subprotocols = subprotocols
+	conn, response, err := dialer.Dial(address+path, header)
+	if err != nil {
+		if response == nil {
+			return nil, http.StatusBadGateway, fmt.Errorf("cannot connect to Kubernetes API: %v", err)
+		}
+		body, _ := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		status := response.StatusCode
+		// other statuses, e.g. 403 for missing permission of service account, are not caused by client
+		if status != http.StatusBadRequest && status != http.StatusNotFound {
+			status = http.StatusBadGateway
+		}
+		return nil, status, fmt.Errorf("Kubernetes API responded with status %d: %s", response.StatusCode, string(body))
+	}
+	return conn, http.StatusSwitchingProtocols, nil
+}
@@ -0,0 +1,116 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package container_stream_connector
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	. "github.com/smartystreets/goconvey/convey"
+
+	kubernetesApi "github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+)
+
+const testPods = `{"items": [
+	{"metadata": {"name": "pod-c"}, "spec": {"containers": [{"name": "main"}]}, "status": {"phase": "Running"}},
+	{"metadata": {"name": "pod-a"}, "spec": {"containers": [{"name": "main"}]}, "status": {"phase": "Pending"}},
+	{"metadata": {"name": "pod-b"}, "spec": {"containers": [{"name": "main"}, {"name": "sidecar"}]}, "status": {"phase": "Running"}}
+]}`
+
+func prepareKubernetesServer(execStatus int) (*httptest.Server, *ContainerStreamConnector) {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/namespaces/tap/pods", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Authorization") != "Bearer token" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.URL.Query().Get("labelSelector") == "instance_id=instanceID1" {
+			rw.Write([]byte(testPods))
+			return
+		}
+		rw.Write([]byte(`{"items": []}`))
+	})
+	mux.HandleFunc("/api/v1/namespaces/tap/pods/pod-b/exec", func(rw http.ResponseWriter, req *http.Request) {
+		if execStatus != http.StatusSwitchingProtocols {
+			rw.WriteHeader(execStatus)
+			return
+		}
+		header := http.Header{}
+		header.Set("Sec-Websocket-Protocol", websocket.Subprotocols(req)[0])
+		conn, err := upgrader.Upgrade(rw, req, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteMessage(websocket.TextMessage, []byte(req.URL.RawQuery))
+	})
+
+	server := httptest.NewTLSServer(mux)
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	connector, err := NewContainerStreamConnector(kubernetesApi.Credentials{Address: server.URL, Namespace: "tap", Token: "token", CaPem: string(caPem)})
+	So(err, ShouldBeNil)
+	return server, connector
+}
+
+func TestExec(t *testing.T) {
+	Convey("Test Exec", t, func() {
+		Convey("When instance has running pod", func() {
+			server, connector := prepareKubernetesServer(http.StatusSwitchingProtocols)
+			defer server.Close()
+
+			conn, status, err := connector.Exec("instanceID1", ExecOptions{Command: []string{"ls", "-l"}, Tty: true}, nil)
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			Convey("command should run in first container of first running pod", func() {
+				So(status, ShouldEqual, http.StatusSwitchingProtocols)
+				So(conn.Subprotocol(), ShouldEqual, "v4.channel.k8s.io")
+				_, message, err := conn.ReadMessage()
+				So(err, ShouldBeNil)
+				So(string(message), ShouldEqual, "command=ls&command=-l&container=main&stderr=false&stdin=true&stdout=true&tty=true")
+			})
+		})
+
+		Convey("When instance has no running pod", func() {
+			server, connector := prepareKubernetesServer(http.StatusSwitchingProtocols)
+			defer server.Close()
+
+			_, status, err := connector.Exec("instanceID2", ExecOptions{Command: []string{"ls"}}, nil)
+
+			Convey("404 should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(status, ShouldEqual, http.StatusNotFound)
+			})
+		})
+
+		Convey("When service account is not allowed to exec", func() {
+			server, connector := prepareKubernetesServer(http.StatusForbidden)
+			defer server.Close()
+
+			_, status, err := connector.Exec("instanceID1", ExecOptions{Command: []string{"ls"}}, nil)
+
+			Convey("502 should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(status, ShouldEqual, http.StatusBadGateway)
+			})
+		})
+	})
+}
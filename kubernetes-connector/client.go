@@ -0,0 +1,240 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes_connector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// InstanceIdLabel is set on deployments and pods by templates of TAP offerings and applications
+	InstanceIdLabel = "instance_id"
+)
+
+// Credentials of service account mounted into api-service pod
+type Credentials struct {
+	Address   string
+	Namespace string
+	Token     string
+	CaPem     string
+}
+
+// GetInClusterCredentials uses namespace of api-service pod if namespace is empty
+func GetInClusterCredentials(namespace string) (Credentials, error) {
+	address := "https://" + net.JoinHostPort(os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT"))
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read service account token: %v", err)
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("cannot read Kubernetes CA certificate: %v", err)
+	}
+	if namespace == "" {
+		content, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return Credentials{}, fmt.Errorf("cannot read namespace of service account: %v", err)
+		}
+		namespace = strings.TrimSpace(string(content))
+	}
+	return Credentials{Address: address, Namespace: namespace, Token: strings.TrimSpace(string(token)), CaPem: string(ca)}, nil
+}
+
+// ContainerConfig is applied to first container of instance deployments, fields which are empty are left as they are
+type ContainerConfig struct {
+	Env map[string]string
+	// RemovedEnv are names of variables which were set by previous configuration
+	RemovedEnv []string
+	// MemoryLimit and StorageLimit are Kubernetes quantities, e.g. 256Mi
+	MemoryLimit  string
+	StorageLimit string
+	Command      []string
+	// ResetCommand brings back command of image, it is used if Command is empty
+	ResetCommand bool
+	Ports        []int
+	RemovedPorts []int
+}
+
+type KubernetesApi interface {
+	// UpdateInstanceContainers patches deployments of instance, Kubernetes rolls their pods out with new configuration
+	UpdateInstanceContainers(instanceId string, config ContainerConfig) (int, error)
+}
+
+type KubernetesConnector struct {
+	Address   string
+	Namespace string
+	Token     string
+	Client    *http.Client
+}
+
+func NewKubernetesConnector(credentials Credentials) (*KubernetesConnector, error) {
+	client, _, err := commonHTTP.GetHttpClientWithCa(credentials.CaPem)
+	if err != nil {
+		return nil, err
+	}
+	return &KubernetesConnector{Address: credentials.Address, Namespace: credentials.Namespace, Token: credentials.Token, Client: client}, nil
+}
+
+type deploymentList struct {
+	Items []deployment `json:"items"`
+}
+
+type deployment struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		Template struct {
+			Spec struct {
+				Containers []struct {
+					Name string `json:"name"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"template"`
+	} `json:"spec"`
+}
+
+func (c *KubernetesConnector) UpdateInstanceContainers(instanceId string, config ContainerConfig) (int, error) {
+	query := url.Values{}
+	query.Set("labelSelector", InstanceIdLabel+"="+instanceId)
+	deployments := deploymentList{}
+	if status, err := c.request("GET", fmt.Sprintf("/apis/extensions/v1beta1/namespaces/%s/deployments?%s", c.Namespace, query.Encode()),
+		"", nil, &deployments); err != nil {
+		return status, err
+	}
+	if len(deployments.Items) == 0 {
+		return http.StatusNotFound, fmt.Errorf("instance %s has no deployment", instanceId)
+	}
+
+	for _, item := range deployments.Items {
+		if len(item.Spec.Template.Spec.Containers) == 0 {
+			continue
+		}
+		patch := makeContainerPatch(item.Spec.Template.Spec.Containers[0].Name, config)
+		if status, err := c.request("PATCH", fmt.Sprintf("/apis/extensions/v1beta1/namespaces/%s/deployments/%s", c.Namespace, item.Metadata.Name),
+			"application/strategic-merge-patch+json", patch, nil); err != nil {
+			return status, err
+		}
+	}
+	return http.StatusOK, nil
+}
+
+// makeContainerPatch returns strategic merge patch, which merges env and ports by their keys,
+// so that entries provided by template, e.g. of bound instances, are kept
+func makeContainerPatch(containerName string, config ContainerConfig) map[string]interface{} {
+	container := map[string]interface{}{"name": containerName}
+
+	env := []map[string]interface{}{}
+	for name, value := range config.Env {
+		env = append(env, map[string]interface{}{"name": name, "value": value})
+	}
+	for _, name := range config.RemovedEnv {
+		if _, found := config.Env[name]; !found {
+			env = append(env, map[string]interface{}{"name": name, "$patch": "delete"})
+		}
+	}
+	if len(env) > 0 {
+		container["env"] = env
+	}
+
+	limits := map[string]interface{}{}
+	if config.MemoryLimit != "" {
+		limits["memory"] = config.MemoryLimit
+	}
+	if config.StorageLimit != "" {
+		limits["ephemeral-storage"] = config.StorageLimit
+	}
+	if len(limits) > 0 {
+		container["resources"] = map[string]interface{}{"limits": limits}
+	}
+
+	if len(config.Command) > 0 {
+		container["command"] = config.Command
+	} else if config.ResetCommand {
+		container["command"] = nil
+	}
+
+	ports := []map[string]interface{}{}
+	desiredPorts := map[int]bool{}
+	for _, port := range config.Ports {
+		desiredPorts[port] = true
+		ports = append(ports, map[string]interface{}{"containerPort": port, "protocol": "TCP"})
+	}
+	for _, port := range config.RemovedPorts {
+		if !desiredPorts[port] {
+			ports = append(ports, map[string]interface{}{"containerPort": port, "$patch": "delete"})
+		}
+	}
+	if len(ports) > 0 {
+		container["ports"] = ports
+	}
+
+	return map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{container},
+				},
+			},
+		},
+	}
+}
+
+func (c *KubernetesConnector) request(method, path, contentType string, body, result interface{}) (int, error) {
+	var content []byte
+	if body != nil {
+		var err error
+		if content, err = json.Marshal(body); err != nil {
+			return http.StatusInternalServerError, err
+		}
+	}
+	request, err := http.NewRequest(method, c.Address+path, bytes.NewReader(content))
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	request.Header.Set("Authorization", "Bearer "+c.Token)
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	response, err := c.Client.Do(request)
+	if err != nil {
+		return http.StatusBadGateway, fmt.Errorf("cannot connect to Kubernetes API: %v", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		responseBody, _ := ioutil.ReadAll(response.Body)
+		return http.StatusBadGateway, fmt.Errorf("Kubernetes API responded with status %d to %s %s: %s", response.StatusCode, method, path, string(responseBody))
+	}
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			return http.StatusBadGateway, fmt.Errorf("cannot parse response of Kubernetes API: %v", err)
+		}
+	}
+	return http.StatusOK, nil
+}
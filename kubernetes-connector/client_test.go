@@ -0,0 +1,100 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kubernetes_connector
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const testDeployments = `{"items": [
+	{"metadata": {"name": "app-deployment"}, "spec": {"template": {"spec": {"containers": [{"name": "app"}, {"name": "sidecar"}]}}}}
+]}`
+
+func prepareKubernetesServer(patches *[]map[string]interface{}) (*httptest.Server, *KubernetesConnector) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/apis/extensions/v1beta1/namespaces/tap/deployments", func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Query().Get("labelSelector") == "instance_id=instanceID1" {
+			rw.Write([]byte(testDeployments))
+			return
+		}
+		rw.Write([]byte(`{"items": []}`))
+	})
+	mux.HandleFunc("/apis/extensions/v1beta1/namespaces/tap/deployments/app-deployment", func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method != "PATCH" || req.Header.Get("Content-Type") != "application/strategic-merge-patch+json" ||
+			req.Header.Get("Authorization") != "Bearer token" {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		patch := map[string]interface{}{}
+		json.NewDecoder(req.Body).Decode(&patch)
+		*patches = append(*patches, patch)
+		rw.Write([]byte(`{}`))
+	})
+
+	server := httptest.NewTLSServer(mux)
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	connector, err := NewKubernetesConnector(Credentials{Address: server.URL, Namespace: "tap", Token: "token", CaPem: string(caPem)})
+	So(err, ShouldBeNil)
+	return server, connector
+}
+
+func TestUpdateInstanceContainers(t *testing.T) {
+	Convey("Test UpdateInstanceContainers", t, func() {
+		patches := []map[string]interface{}{}
+		server, connector := prepareKubernetesServer(&patches)
+		defer server.Close()
+
+		Convey("When instance has deployment", func() {
+			status, err := connector.UpdateInstanceContainers("instanceID1", ContainerConfig{
+				Env:          map[string]string{"KEY": "value"},
+				RemovedEnv:   []string{"KEY", "OLD"},
+				MemoryLimit:  "512Mi",
+				ResetCommand: true,
+				Ports:        []int{8080},
+			})
+
+			Convey("first container should be patched merging env and ports by their keys", func() {
+				So(err, ShouldBeNil)
+				So(status, ShouldEqual, http.StatusOK)
+				So(patches, ShouldHaveLength, 1)
+
+				content, _ := json.Marshal(patches[0])
+				So(string(content), ShouldEqual, `{"spec":{"template":{"spec":{"containers":[{`+
+					`"command":null,`+
+					`"env":[{"name":"KEY","value":"value"},{"$patch":"delete","name":"OLD"}],`+
+					`"name":"app",`+
+					`"ports":[{"containerPort":8080,"protocol":"TCP"}],`+
+					`"resources":{"limits":{"memory":"512Mi"}}}]}}}}`)
+			})
+		})
+
+		Convey("When instance has no deployment", func() {
+			status, err := connector.UpdateInstanceContainers("instanceID2", ContainerConfig{MemoryLimit: "512Mi"})
+
+			Convey("404 should be returned", func() {
+				So(err, ShouldNotBeNil)
+				So(status, ShouldEqual, http.StatusNotFound)
+			})
+		})
+	})
+}
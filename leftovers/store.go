@@ -0,0 +1,128 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package leftovers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+// Store remembers entities which could not be removed from Template Repository and Blob Store.
+// Those cannot be listed, so orphans cleanup learns about them only from here.
+type Store interface {
+	// Add records entity, recording the same entity again keeps the first record
+	Add(orphan models.Orphan) error
+	List() ([]models.Orphan, error)
+	// Remove forgets entity, it is not an error if entity was not recorded
+	Remove(orphanType models.OrphanType, id string) error
+}
+
+// JsonFileStore keeps entities in memory and rewrites local file on every change
+type JsonFileStore struct {
+	path    string
+	mutex   sync.Mutex
+	orphans []models.Orphan
+	loaded  bool
+}
+
+func NewJsonFileStore(path string) *JsonFileStore {
+	return &JsonFileStore{path: path}
+}
+
+func (s *JsonFileStore) Add(orphan models.Orphan) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	if s.find(orphan.Type, orphan.Id) >= 0 {
+		return nil
+	}
+	s.orphans = append(s.orphans, orphan)
+	return s.save()
+}
+
+func (s *JsonFileStore) List() ([]models.Orphan, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return append([]models.Orphan{}, s.orphans...), nil
+}
+
+func (s *JsonFileStore) Remove(orphanType models.OrphanType, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return err
+	}
+	idx := s.find(orphanType, id)
+	if idx < 0 {
+		return nil
+	}
+	s.orphans = append(s.orphans[:idx], s.orphans[idx+1:]...)
+	return s.save()
+}
+
+func (s *JsonFileStore) find(orphanType models.OrphanType, id string) int {
+	for i, orphan := range s.orphans {
+		if orphan.Type == orphanType && orphan.Id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *JsonFileStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.orphans = []models.Orphan{}
+		s.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &s.orphans); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+// save writes file atomically, so that crash does not leave entities half written
+func (s *JsonFileStore) save() error {
+	content, err := json.Marshal(s.orphans)
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
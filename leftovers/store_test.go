@@ -0,0 +1,74 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package leftovers
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+func TestJsonFileStore(t *testing.T) {
+	Convey("Test JsonFileStore", t, func() {
+		dir, err := ioutil.TempDir("", "leftovers")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "leftovers.json")
+		store := NewJsonFileStore(path)
+
+		blob := models.Orphan{Type: models.OrphanTypeBlob, Id: "app_appID1", Reason: "first", CreatedOn: 100}
+		So(store.Add(blob), ShouldBeNil)
+
+		Convey("When the same entity is added again", func() {
+			So(store.Add(models.Orphan{Type: models.OrphanTypeBlob, Id: "app_appID1", Reason: "second"}), ShouldBeNil)
+
+			Convey("the first record should be kept", func() {
+				orphans, err := store.List()
+				So(err, ShouldBeNil)
+				So(orphans, ShouldResemble, []models.Orphan{blob})
+			})
+		})
+
+		Convey("When template with the same id is added", func() {
+			template := models.Orphan{Type: models.OrphanTypeTemplate, Id: "app_appID1"}
+			So(store.Add(template), ShouldBeNil)
+
+			Convey("both entities should survive restart", func() {
+				orphans, err := NewJsonFileStore(path).List()
+				So(err, ShouldBeNil)
+				So(orphans, ShouldResemble, []models.Orphan{blob, template})
+			})
+		})
+
+		Convey("When entity is removed", func() {
+			So(store.Remove(models.OrphanTypeBlob, blob.Id), ShouldBeNil)
+
+			Convey("it should not be listed", func() {
+				orphans, err := store.List()
+				So(err, ShouldBeNil)
+				So(orphans, ShouldBeEmpty)
+			})
+
+			Convey("removing it again should not fail", func() {
+				So(store.Remove(models.OrphanTypeBlob, blob.Id), ShouldBeNil)
+			})
+		})
+	})
+}
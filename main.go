@@ -17,13 +17,19 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"sync"
 
 	"github.com/gocraft/web"
 
 	"github.com/trustedanalytics-ng/tap-api-service/api"
+	"github.com/trustedanalytics-ng/tap-api-service/audit"
+	containerStreamApi "github.com/trustedanalytics-ng/tap-api-service/container-stream-connector"
+	kubernetesApi "github.com/trustedanalytics-ng/tap-api-service/kubernetes-connector"
+	"github.com/trustedanalytics-ng/tap-api-service/leftovers"
 	"github.com/trustedanalytics-ng/tap-api-service/models"
+	"github.com/trustedanalytics-ng/tap-api-service/serviceaccounts"
 	uaaApi "github.com/trustedanalytics-ng/tap-api-service/uaa-connector"
 	userManagementApi "github.com/trustedanalytics-ng/tap-api-service/user-management-connector"
 	blobStoreApi "github.com/trustedanalytics-ng/tap-blob-store/client"
@@ -44,6 +50,10 @@ func main() {
 
 	initServices()
 
+	go api.CollectMetricsPeriodically()
+	go api.ResumeApplicationVersionSwitches()
+	go api.ApplyApplicationsRuntimeConfig()
+
 	router := setupRouter()
 
 	httpGoCommon.StartServer(router)
@@ -70,6 +80,21 @@ func initServices() {
 		logger.Fatal("Can't connect with tap-container-broker! ", err)
 	}
 
+	kubernetesCredentials, err := kubernetesApi.GetInClusterCredentials(os.Getenv("KUBERNETES_NAMESPACE"))
+	if err != nil {
+		logger.Fatal("Can't read Kubernetes API credentials! ", err)
+	}
+
+	containerStreamConnector, err := getContainerStreamConnector(kubernetesCredentials)
+	if err != nil {
+		logger.Fatal("Can't connect with Kubernetes API! ", err)
+	}
+
+	kubernetesConnector, err := kubernetesApi.NewKubernetesConnector(kubernetesCredentials)
+	if err != nil {
+		logger.Fatal("Can't connect with Kubernetes API! ", err)
+	}
+
 	imageFactoryConnector, err := getImageFactoryConnector()
 	if err != nil {
 		logger.Fatal("Can't connect with tap-image-factory! ", err)
@@ -85,14 +110,39 @@ func initServices() {
 		logger.Fatal("Can't connect with user-management! ", err)
 	}
 
+	accessPolicy, err := api.LoadAccessPolicy(os.Getenv("ACCESS_POLICY_FILE"))
+	if err != nil {
+		logger.Fatal("Can't load access policy! ", err)
+	}
+
+	// audit log kept in working directory of the container would be lost with it
+	auditLogFile := os.Getenv("AUDIT_LOG_FILE")
+	if auditLogFile == "" {
+		logger.Fatal("AUDIT_LOG_FILE is not set! It has to point to file on persistent volume")
+	}
+	leftoversFile := os.Getenv("LEFTOVERS_FILE")
+	if leftoversFile == "" {
+		logger.Fatal("LEFTOVERS_FILE is not set! It has to point to file on persistent volume")
+	}
+	serviceAccountsFile := os.Getenv("SERVICE_ACCOUNTS_FILE")
+	if serviceAccountsFile == "" {
+		logger.Fatal("SERVICE_ACCOUNTS_FILE is not set! It has to point to file on persistent volume")
+	}
+
 	api.BrokerConfig = &api.Config{}
 	api.BrokerConfig.TemplateRepositoryApi = templateRepositoryConnector
 	api.BrokerConfig.CatalogApi = catalogAPI
 	api.BrokerConfig.ContainerBrokerApi = containerBrokerConnector
+	api.BrokerConfig.ContainerStreamApi = containerStreamConnector
+	api.BrokerConfig.KubernetesApi = kubernetesConnector
 	api.BrokerConfig.BlobStoreApi = blobStoreConnector
 	api.BrokerConfig.ImageFactoryApi = imageFactoryConnector
 	api.BrokerConfig.UaaApi = uaaConnector
 	api.BrokerConfig.UserManagementApiFactory = userManagementConnectorFactory
+	api.BrokerConfig.AuditSink = audit.NewJsonLinesSink(auditLogFile)
+	api.BrokerConfig.AccessPolicy = accessPolicy
+	api.BrokerConfig.ServiceAccountStore = serviceaccounts.NewJsonFileStore(serviceAccountsFile)
+	api.BrokerConfig.LeftoversStore = leftovers.NewJsonFileStore(leftoversFile)
 }
 
 func setupRouter() *web.Router {
@@ -126,6 +176,11 @@ func getContainerBrokerConnector() (*containerBrokerApi.TapContainerBrokerApiCon
 	return containerBrokerApi.NewTapContainerBrokerApiWithBasicAuth("https://"+address, username, password)
 }
 
+// getContainerStreamConnector uses Kubernetes API server, as Container Broker has no exec endpoint
+func getContainerStreamConnector(credentials kubernetesApi.Credentials) (*containerStreamApi.ContainerStreamConnector, error) {
+	return containerStreamApi.NewContainerStreamConnector(credentials)
+}
+
 func getBlobStoreConnector() (*blobStoreApi.TapBlobStoreApiConnector, error) {
 	address, username, password, err := util.GetConnectionParametersFromEnv("BLOB_STORE")
 	if err != nil {
@@ -142,10 +197,18 @@ func getImageFactoryConnector() (*imageFactoryApi.TapImageFactoryApiConnector, e
 	return imageFactoryApi.NewTapImageFactoryApiWithBasicAuth("https://"+address, username, password)
 }
 
-func getUaaConnector() (*uaaApi.UaaConnector, error) {
+func getUaaConnector() (uaaApi.UaaApi, error) {
 	client := os.Getenv("SSO_CLIENT")
 	secret := os.Getenv("SSO_SECRET")
-	return uaaApi.NewUaaBasicAuth(client, secret)
+
+	switch provider := util.GetEnvValueOrDefault("IDENTITY_PROVIDER", "uaa"); provider {
+	case "uaa":
+		return uaaApi.NewUaaBasicAuth(client, secret)
+	case "oidc":
+		return uaaApi.NewOidcConnector(os.Getenv("OIDC_ISSUER_URL"), client, secret)
+	default:
+		return nil, fmt.Errorf("unsupported IDENTITY_PROVIDER: %s", provider)
+	}
 }
 
 func getUserManagementConnectorFactory() (*userManagementApi.UserManagementApiConnectorFactory, error) {
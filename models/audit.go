@@ -0,0 +1,27 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+type AuditEntry struct {
+	Timestamp   int64  `json:"timestamp"`
+	Username    string `json:"username"`
+	Action      string `json:"action"`
+	TargetId    string `json:"targetId,omitempty"`
+	OperationId string `json:"operationId,omitempty"`
+	Summary     string `json:"summary"`
+	Status      int    `json:"status"`
+}
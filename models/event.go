@@ -0,0 +1,34 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+type EventKind string
+
+const (
+	EventKindInstance EventKind = "instance"
+	EventKindImage    EventKind = "image"
+)
+
+// EventTypeImage can be used in events type filter next to catalog instance types
+const EventTypeImage = "IMAGE"
+
+type StateChangeEvent struct {
+	Index uint64    `json:"index"`
+	Kind  EventKind `json:"kind"`
+	Id    string    `json:"id"`
+	Type  string    `json:"type"`
+	State string    `json:"state"`
+}
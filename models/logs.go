@@ -0,0 +1,24 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+// LogLine is sent as data of server-sent event and as item of merged logs.
+// Instance is set only when logs of application are merged with logs of its bound services.
+type LogLine struct {
+	Instance  string `json:"instance,omitempty"`
+	Container string `json:"container"`
+	Line      string `json:"line"`
+}
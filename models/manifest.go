@@ -25,4 +25,27 @@ type Manifest struct {
 	Instances int                      `json:"instances"`
 	Bindings  []string                 `json:"bindings"`
 	Metadata  []catalogModels.Metadata `json:"metadata"`
+	// Blob is name of form field with application blob, "blob" is used if not set
+	Blob string `json:"blob,omitempty"`
+	ApplicationRuntimeConfig
+}
+
+// ManifestDocument is either single application manifest or list of them under "applications" key
+type ManifestDocument struct {
+	Manifest
+	Applications []Manifest `json:"applications,omitempty"`
+}
+
+type CreatedApplication struct {
+	Application catalogModels.Application `json:"application"`
+	OperationId string                    `json:"operationId"`
+}
+
+// ApplicationRuntimeConfig is part of manifest which can be changed after application is created
+type ApplicationRuntimeConfig struct {
+	Env       map[string]string `json:"env,omitempty"`
+	Memory    string            `json:"memory,omitempty"`
+	DiskQuota string            `json:"disk_quota,omitempty"`
+	Command   string            `json:"command,omitempty"`
+	Ports     []int             `json:"ports,omitempty"`
 }
@@ -0,0 +1,67 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+type PlatformMetrics struct {
+	Timestamp                   int64          `json:"timestamp"`
+	OrganizationsCount          int            `json:"organizations_count"`
+	ApplicationsCount           int            `json:"applications_count"`
+	ServiceInstancesCount       int            `json:"service_instances_count"`
+	MemoryUsage                 int            `json:"memory_usage"`
+	LatestEvents                int            `json:"latest_eventes"`
+	Components                  int            `json:"components"`
+	Replicas                    int            `json:"replicas"`
+	ServiceInstancesPerOffering map[string]int `json:"service_instances_per_offering"`
+	InstanceStates              map[string]int `json:"instance_states"`
+	ApplicationStates           map[string]int `json:"application_states"`
+	ImageStates                 map[string]int `json:"image_states"`
+	// Organizations holds usage per organization id, entities without organization are under empty id
+	Organizations map[string]*OrganizationUsage `json:"-"`
+}
+
+type OrganizationUsage struct {
+	ServiceInstancesCount int
+	MemoryUsage           int
+	ApplicationStates     map[string]int
+}
+
+type OrganizationMetrics struct {
+	Timestamp                int64  `json:"timestamp"`
+	OrganizationId           string `json:"organization_id"`
+	Name                     string `json:"name"`
+	Status                   string `json:"status"`
+	ApplicationsRunningCount int    `json:"applications_running_count"`
+	ApplicationsFailedCount  int    `json:"applications_failed_count"`
+	ServicesCount            int    `json:"services_count"`
+	ServicesUsagePercentage  int    `json:"services_usage_percentage"`
+	UsersCount               string `json:"users_count"`
+	MemoryUsage              string `json:"memory_usage"`
+	MemoryUsagePercentage    int    `json:"memory_usage_percentage"`
+	CpuUsage                 string `json:"cpu_usage"`
+	CpuUsagePercentage       int    `json:"cpu_usage_percentage"`
+	PublicDatasetsCount      string `json:"public_datasets_count"`
+	PrivateDatasetsCount     string `json:"private_datasets_count"`
+}
+
+type Metric struct {
+	Name   string           `json:"name"`
+	Values []RawMetricValue `json:"values"`
+}
+
+type RawMetricValue struct {
+	Timestamp string      `json:"timestamp"`
+	Value     interface{} `json:"value"`
+}
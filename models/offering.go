@@ -30,6 +30,7 @@ type Offering struct {
 	Description    string                   `json:"description"`
 	Version        string                   `json:"version"`
 	Bindable       bool                     `json:"bindable"`
+	PlanUpdateable bool                     `json:"planUpdateable"`
 	Id             string                   `json:"id"`
 	Tags           []string                 `json:"tags"`
 	State          string                   `json:"state"`
@@ -45,6 +46,8 @@ type OfferingPlan struct {
 	OfferingId  string `json:"offeringId"`
 	Id          string `json:"id"`
 	Active      bool   `json:"active"`
+	// ParametersSchema is JSON Schema of parameters accepted when instance of the plan is created
+	ParametersSchema json.RawMessage `json:"parametersSchema,omitempty"`
 }
 
 type simpleKubernetesBody struct {
@@ -0,0 +1,67 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+type OperationState string
+
+const (
+	OperationStatePending   OperationState = "PENDING"
+	OperationStateSucceeded OperationState = "SUCCEEDED"
+	OperationStateFailed    OperationState = "FAILED"
+)
+
+type OperationType string
+
+const (
+	OperationTypeCreateApplication OperationType = "CREATE_APPLICATION"
+	OperationTypeCreateService     OperationType = "CREATE_SERVICE"
+	OperationTypeUpdateService     OperationType = "UPDATE_SERVICE"
+	OperationTypeCreateOffering    OperationType = "CREATE_OFFERING"
+	OperationTypeDeleteOffering    OperationType = "DELETE_OFFERING"
+	OperationTypeDeleteInstance    OperationType = "DELETE_INSTANCE"
+	OperationTypeStart             OperationType = "START"
+	OperationTypeStop              OperationType = "STOP"
+	OperationTypeRestart           OperationType = "RESTART"
+	OperationTypeScale             OperationType = "SCALE"
+	OperationTypeRedeploy          OperationType = "REDEPLOY"
+	OperationTypeRollback          OperationType = "ROLLBACK"
+)
+
+type OperationTargetType string
+
+const (
+	OperationTargetApplication OperationTargetType = "APPLICATION"
+	OperationTargetInstance    OperationTargetType = "INSTANCE"
+	OperationTargetOffering    OperationTargetType = "OFFERING"
+)
+
+type Operation struct {
+	Id         string              `json:"id"`
+	Type       OperationType       `json:"type"`
+	State      OperationState      `json:"state"`
+	TargetType OperationTargetType `json:"targetType"`
+	TargetId   string              `json:"targetId"`
+	Reason     string              `json:"reason,omitempty"`
+	CreatedBy  string              `json:"createdBy"`
+	CreatedOn  int64               `json:"createdOn"`
+	UpdatedOn  int64               `json:"updatedOn"`
+	FinishedOn int64               `json:"finishedOn,omitempty"`
+}
+
+type OperationAcceptedResponse struct {
+	Message     string `json:"message"`
+	OperationId string `json:"operationId"`
+}
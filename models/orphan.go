@@ -0,0 +1,41 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+type OrphanType string
+
+const (
+	OrphanTypeImage       OrphanType = "IMAGE"
+	OrphanTypeApplication OrphanType = "APPLICATION"
+	OrphanTypeInstance    OrphanType = "INSTANCE"
+	OrphanTypeTemplate    OrphanType = "TEMPLATE"
+	OrphanTypeBlob        OrphanType = "BLOB"
+)
+
+// Orphan is entity left behind by creation flow which failed before rollback was introduced or whose rollback failed
+type Orphan struct {
+	Type      OrphanType `json:"type"`
+	Id        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Reason    string     `json:"reason"`
+	CreatedOn int64      `json:"createdOn"`
+	Error     string     `json:"error,omitempty"`
+}
+
+type OrphansCleanupResponse struct {
+	Removed []Orphan `json:"removed"`
+	Failed  []Orphan `json:"failed"`
+}
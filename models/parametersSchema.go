@@ -0,0 +1,45 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+const (
+	ParameterTypeString  = "string"
+	ParameterTypeInteger = "integer"
+	ParameterTypeNumber  = "number"
+	ParameterTypeBoolean = "boolean"
+)
+
+// ParametersSchema is JSON Schema of object holding parameters of service instance.
+// As parameters are stored as instance metadata, only flat objects with scalar properties are supported.
+type ParametersSchema struct {
+	Type                 string                     `json:"type"`
+	Properties           map[string]ParameterSchema `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties *bool                      `json:"additionalProperties"`
+}
+
+type ParameterSchema struct {
+	Type        string        `json:"type"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Default     interface{}   `json:"default"`
+	Enum        []interface{} `json:"enum"`
+	Minimum     *float64      `json:"minimum"`
+	Maximum     *float64      `json:"maximum"`
+	MinLength   *int          `json:"minLength"`
+	MaxLength   *int          `json:"maxLength"`
+	Pattern     string        `json:"pattern"`
+}
@@ -0,0 +1,68 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+// Permission allows an action on API resources. Permissions are granted to UAA scopes by AccessPolicy.
+type Permission string
+
+const (
+	PermissionAll Permission = "*"
+
+	PermissionPlatformRead              Permission = "platform.read"
+	PermissionOfferingsRead             Permission = "offerings.read"
+	PermissionOfferingsWrite            Permission = "offerings.write"
+	PermissionOfferingsApplicationWrite Permission = "offerings.application.write"
+	PermissionApplicationsRead          Permission = "applications.read"
+	PermissionApplicationsWrite         Permission = "applications.write"
+	PermissionApplicationsExec          Permission = "applications.exec"
+	PermissionServicesRead              Permission = "services.read"
+	PermissionServicesWrite             Permission = "services.write"
+	PermissionServicesExec              Permission = "services.exec"
+	PermissionServicesCredentialsRead   Permission = "services.credentials.read"
+	PermissionOrganizationsRead         Permission = "organizations.read"
+	PermissionOrganizationsWrite        Permission = "organizations.write"
+	PermissionUsersRead                 Permission = "users.read"
+	PermissionUsersDelete               Permission = "users.delete"
+	PermissionUsersInvite               Permission = "users.invite"
+	PermissionUsersInvitationsManage    Permission = "users.invitations.manage"
+	PermissionMetricsRead               Permission = "metrics.read"
+	PermissionEventsRead                Permission = "events.read"
+	PermissionOperationsRead            Permission = "operations.read"
+	PermissionQuotasRead                Permission = "quotas.read"
+	PermissionAuditRead                 Permission = "audit.read"
+	PermissionOrphansRead               Permission = "orphans.read"
+	PermissionOrphansDelete             Permission = "orphans.delete"
+	PermissionServiceAccountsManage     Permission = "service_accounts.manage"
+	// PermissionAllResourcesManage lets user access applications and services owned by other users
+	PermissionAllResourcesManage Permission = "resources.all.manage"
+)
+
+// AccessPolicy grants permissions to users having given UAA scopes (groups).
+// Permission ending with ".*" grants all permissions with that prefix, "*" grants all permissions.
+type AccessPolicy struct {
+	Roles []AccessPolicyRole `json:"roles"`
+}
+
+type AccessPolicyRole struct {
+	Scopes      []string     `json:"scopes"`
+	Permissions []Permission `json:"permissions"`
+}
+
+type UserPermissions struct {
+	Username    string       `json:"username"`
+	Scopes      []string     `json:"scopes"`
+	Permissions []Permission `json:"permissions"`
+}
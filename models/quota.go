@@ -0,0 +1,84 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package models
+
+type QuotaScope string
+
+const (
+	QuotaScopeUser         QuotaScope = "USER"
+	QuotaScopeOrganization QuotaScope = "ORGANIZATION"
+)
+
+type QuotaResource string
+
+const (
+	QuotaResourceApplications            QuotaResource = "applications"
+	QuotaResourceServiceInstancesPerPlan QuotaResource = "serviceInstancesPerPlan"
+	QuotaResourceReplicas                QuotaResource = "replicas"
+	QuotaResourceMemory                  QuotaResource = "memoryMB"
+)
+
+// QuotaLimits holds maximal usage of resources, 0 means unlimited
+type QuotaLimits struct {
+	Applications            int              `json:"applications"`
+	ServiceInstancesPerPlan int              `json:"serviceInstancesPerPlan"`
+	ServiceInstancesByPlan  []PlanQuotaLimit `json:"serviceInstancesByPlan"`
+	Replicas                int              `json:"replicas"`
+	MemoryMB                int              `json:"memoryMB"`
+}
+
+// PlanQuotaLimit overrides ServiceInstancesPerPlan limit for single plan of offering
+type PlanQuotaLimit struct {
+	OfferingName string `json:"offeringName"`
+	PlanName     string `json:"planName"`
+	Limit        int    `json:"limit"`
+}
+
+type PlanUsage struct {
+	OfferingId string `json:"offeringId"`
+	PlanId     string `json:"planId"`
+	Count      int    `json:"count"`
+}
+
+type QuotaUsage struct {
+	Applications     int         `json:"applications"`
+	ServiceInstances []PlanUsage `json:"serviceInstances"`
+	Replicas         int         `json:"replicas"`
+	MemoryMB         int         `json:"memoryMB"`
+}
+
+type Quota struct {
+	Scope  QuotaScope  `json:"scope"`
+	Id     string      `json:"id"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+}
+
+type QuotasResponse struct {
+	MaxReplicasPerApplication int     `json:"maxReplicasPerApplication"`
+	Quotas                    []Quota `json:"quotas"`
+}
+
+type QuotaExceededResponse struct {
+	Message   string        `json:"message"`
+	Scope     QuotaScope    `json:"scope"`
+	Id        string        `json:"id"`
+	Resource  QuotaResource `json:"resource"`
+	Limit     int           `json:"limit"`
+	Usage     int           `json:"usage"`
+	Requested int           `json:"requested"`
+}
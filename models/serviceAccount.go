@@ -0,0 +1,59 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+// ServiceAccount is non-human principal used by automation. Its API keys are granted permissions
+// by AccessPolicy in the same way as UAA scopes of users.
+type ServiceAccount struct {
+	Id          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+	CreatedBy   string   `json:"createdBy"`
+	CreatedOn   int64    `json:"createdOn"`
+	Keys        []ApiKey `json:"keys"`
+}
+
+type ApiKey struct {
+	Id          string   `json:"id"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes"`
+	CreatedBy   string   `json:"createdBy"`
+	CreatedOn   int64    `json:"createdOn"`
+	// ExpiresOn equal to 0 means key never expires
+	ExpiresOn int64 `json:"expiresOn"`
+	RevokedOn int64 `json:"revokedOn"`
+}
+
+type ServiceAccountCreateRequest struct {
+	Name        string   `json:"name" validate:"nonzero"`
+	Description string   `json:"description"`
+	Scopes      []string `json:"scopes" validate:"nonzero"`
+}
+
+type ApiKeyCreateRequest struct {
+	Description string `json:"description"`
+	// Scopes have to be subset of service account scopes, all of them are granted if empty
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is lifetime of key in seconds, 0 means key never expires
+	ExpiresIn int64 `json:"expiresIn" validate:"min=0"`
+}
+
+// ApiKeyCreateResponse holds secret key, which is returned only once and cannot be retrieved later
+type ApiKeyCreateResponse struct {
+	ApiKey
+	Key string `json:"key"`
+}
@@ -42,6 +42,13 @@ type ServiceInstanceRequest struct {
 	Metadata   []catalogModels.Metadata         `json:"metadata" validate:"nonzero"`
 }
 
+// ServiceInstanceUpdateRequest changes plan and/or parameters of service instance.
+// Parameter with empty value is removed from instance.
+type ServiceInstanceUpdateRequest struct {
+	PlanName string                   `json:"planName"`
+	Metadata []catalogModels.Metadata `json:"metadata"`
+}
+
 func FilterServiceInstancesByName(services []ServiceInstance, serviceName string) []ServiceInstance {
 	serviceName = strings.ToUpper(serviceName)
 	return filterServiceInstanceItems(services, func(service ServiceInstance) bool {
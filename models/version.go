@@ -0,0 +1,33 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+package models
+
+import (
+	catalogModels "github.com/trustedanalytics-ng/tap-catalog/models"
+)
+
+// ApplicationVersion is identified by version generated when its blob was pushed
+type ApplicationVersion struct {
+	Version   string                   `json:"version"`
+	State     catalogModels.ImageState `json:"state"`
+	CreatedOn int64                    `json:"createdOn"`
+	CreatedBy string                   `json:"createdBy"`
+	Current   bool                     `json:"current"`
+}
+
+type RollbackRequest struct {
+	Version string `json:"version" validate:"nonzero"`
+}
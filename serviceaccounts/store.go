@@ -0,0 +1,261 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serviceaccounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twinj/uuid"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+// keyPrefix makes API keys recognizable, e.g. by secret scanners
+const keyPrefix = "tap"
+
+var ErrInvalidKey = errors.New("invalid, expired or revoked API key")
+
+type Store interface {
+	CreateAccount(account models.ServiceAccount) (models.ServiceAccount, error)
+	ListAccounts() ([]models.ServiceAccount, error)
+	GetAccount(accountId string) (models.ServiceAccount, error)
+	DeleteAccount(accountId string) error
+	// CreateKey returns created key and its secret value, which is not stored
+	CreateKey(accountId string, key models.ApiKey) (models.ApiKey, string, error)
+	RevokeKey(accountId, keyId string) error
+	// Authenticate returns account and key matching secret value, or ErrInvalidKey
+	Authenticate(secret string) (models.ServiceAccount, models.ApiKey, error)
+}
+
+type storedAccount struct {
+	Account models.ServiceAccount `json:"account"`
+	// KeyHashes holds SHA-256 of secret part of every key, by key id
+	KeyHashes map[string]string `json:"keyHashes"`
+}
+
+// JsonFileStore keeps accounts in memory and rewrites local file on every change
+type JsonFileStore struct {
+	path     string
+	mutex    sync.Mutex
+	accounts []storedAccount
+	loaded   bool
+}
+
+func NewJsonFileStore(path string) *JsonFileStore {
+	return &JsonFileStore{path: path}
+}
+
+func (s *JsonFileStore) CreateAccount(account models.ServiceAccount) (models.ServiceAccount, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return account, err
+	}
+	for _, stored := range s.accounts {
+		if stored.Account.Name == account.Name {
+			return account, fmt.Errorf("service account %q already exists", account.Name)
+		}
+	}
+
+	account.Id = uuid.NewV4().String()
+	account.CreatedOn = time.Now().Unix()
+	account.Keys = []models.ApiKey{}
+	s.accounts = append(s.accounts, storedAccount{Account: account, KeyHashes: map[string]string{}})
+	return account, s.save()
+}
+
+func (s *JsonFileStore) ListAccounts() ([]models.ServiceAccount, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	result := []models.ServiceAccount{}
+	for _, stored := range s.accounts {
+		result = append(result, stored.Account)
+	}
+	return result, nil
+}
+
+func (s *JsonFileStore) GetAccount(accountId string) (models.ServiceAccount, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	idx, err := s.find(accountId)
+	if err != nil {
+		return models.ServiceAccount{}, err
+	}
+	return s.accounts[idx].Account, nil
+}
+
+func (s *JsonFileStore) DeleteAccount(accountId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	idx, err := s.find(accountId)
+	if err != nil {
+		return err
+	}
+	s.accounts = append(s.accounts[:idx], s.accounts[idx+1:]...)
+	return s.save()
+}
+
+func (s *JsonFileStore) CreateKey(accountId string, key models.ApiKey) (models.ApiKey, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	idx, err := s.find(accountId)
+	if err != nil {
+		return key, "", err
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return key, "", err
+	}
+	key.Id = strings.Replace(uuid.NewV4().String(), "-", "", -1)
+	key.CreatedOn = time.Now().Unix()
+
+	stored := &s.accounts[idx]
+	stored.Account.Keys = append(stored.Account.Keys, key)
+	stored.KeyHashes[key.Id] = hashSecret(secret)
+	if err := s.save(); err != nil {
+		return key, "", err
+	}
+	return key, strings.Join([]string{keyPrefix, key.Id, secret}, "."), nil
+}
+
+func (s *JsonFileStore) RevokeKey(accountId, keyId string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	idx, err := s.find(accountId)
+	if err != nil {
+		return err
+	}
+	keys := s.accounts[idx].Account.Keys
+	for i := range keys {
+		if keys[i].Id == keyId {
+			if keys[i].RevokedOn == 0 {
+				keys[i].RevokedOn = time.Now().Unix()
+			}
+			return s.save()
+		}
+	}
+	return fmt.Errorf("API key %q not found", keyId)
+}
+
+func (s *JsonFileStore) Authenticate(secret string) (models.ServiceAccount, models.ApiKey, error) {
+	parts := strings.Split(secret, ".")
+	if len(parts) != 3 || parts[0] != keyPrefix {
+		return models.ServiceAccount{}, models.ApiKey{}, ErrInvalidKey
+	}
+	keyId, keySecret := parts[1], parts[2]
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.load(); err != nil {
+		return models.ServiceAccount{}, models.ApiKey{}, err
+	}
+	now := time.Now().Unix()
+	for _, stored := range s.accounts {
+		hash, found := stored.KeyHashes[keyId]
+		if !found {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(keySecret))) != 1 {
+			return models.ServiceAccount{}, models.ApiKey{}, ErrInvalidKey
+		}
+		for _, key := range stored.Account.Keys {
+			if key.Id == keyId && key.RevokedOn == 0 && (key.ExpiresOn == 0 || key.ExpiresOn > now) {
+				return stored.Account, key, nil
+			}
+		}
+	}
+	return models.ServiceAccount{}, models.ApiKey{}, ErrInvalidKey
+}
+
+func (s *JsonFileStore) find(accountId string) (int, error) {
+	if err := s.load(); err != nil {
+		return -1, err
+	}
+	for i, stored := range s.accounts {
+		if stored.Account.Id == accountId {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("service account %q not found", accountId)
+}
+
+func (s *JsonFileStore) load() error {
+	if s.loaded {
+		return nil
+	}
+	content, err := ioutil.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.accounts = []storedAccount{}
+		s.loaded = true
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(content, &s.accounts); err != nil {
+		return err
+	}
+	s.loaded = true
+	return nil
+}
+
+// save writes file atomically, so that crash does not leave accounts half written
+func (s *JsonFileStore) save() error {
+	content, err := json.Marshal(s.accounts)
+	if err != nil {
+		return err
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path)
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func hashSecret(secret string) string {
+	hash := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,96 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package serviceaccounts
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+
+	"github.com/trustedanalytics-ng/tap-api-service/models"
+)
+
+func TestJsonFileStore(t *testing.T) {
+	Convey("Test JsonFileStore", t, func() {
+		dir, err := ioutil.TempDir("", "serviceaccounts")
+		So(err, ShouldBeNil)
+		path := filepath.Join(dir, "service_accounts.json")
+		store := NewJsonFileStore(path)
+
+		account, err := store.CreateAccount(models.ServiceAccount{Name: "ci", Scopes: []string{"tap.user"}})
+		So(err, ShouldBeNil)
+
+		Convey("When account with the same name is created", func() {
+			_, err := store.CreateAccount(models.ServiceAccount{Name: "ci"})
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When key is created", func() {
+			key, secret, err := store.CreateKey(account.Id, models.ApiKey{Description: "pipeline"})
+			So(err, ShouldBeNil)
+
+			Convey("it should authenticate account", func() {
+				authenticated, authenticatedKey, err := store.Authenticate(secret)
+				So(err, ShouldBeNil)
+				So(authenticated.Id, ShouldEqual, account.Id)
+				So(authenticatedKey.Id, ShouldEqual, key.Id)
+			})
+
+			Convey("it should survive restart, but its secret should not be stored", func() {
+				content, err := ioutil.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(string(content), ShouldNotContainSubstring, secret[len(keyPrefix)+len(key.Id)+2:])
+
+				_, _, err = NewJsonFileStore(path).Authenticate(secret)
+				So(err, ShouldBeNil)
+			})
+
+			Convey("it should be rejected after revocation", func() {
+				So(store.RevokeKey(account.Id, key.Id), ShouldBeNil)
+				_, _, err := store.Authenticate(secret)
+				So(err, ShouldEqual, ErrInvalidKey)
+			})
+
+			Convey("it should be rejected after account is deleted", func() {
+				So(store.DeleteAccount(account.Id), ShouldBeNil)
+				_, _, err := store.Authenticate(secret)
+				So(err, ShouldEqual, ErrInvalidKey)
+			})
+
+			Convey("tampered secret should be rejected", func() {
+				_, _, err := store.Authenticate(secret[:len(secret)-1] + "x")
+				So(err, ShouldEqual, ErrInvalidKey)
+			})
+		})
+
+		Convey("When key expired", func() {
+			_, secret, err := store.CreateKey(account.Id, models.ApiKey{ExpiresOn: time.Now().Add(-time.Minute).Unix()})
+			So(err, ShouldBeNil)
+
+			Convey("it should be rejected", func() {
+				_, _, err := store.Authenticate(secret)
+				So(err, ShouldEqual, ErrInvalidKey)
+			})
+		})
+	})
+}
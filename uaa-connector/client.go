@@ -22,9 +22,28 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"strconv"
+	"strings"
+	"time"
 
 	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+	commonLogger "github.com/trustedanalytics-ng/tap-go-common/logger"
+)
+
+var logger, _ = commonLogger.InitLogger("uaa-connector")
+
+const (
+	// TokenValidationRemote sends every token to SSO_CHECK_TOKEN_URI
+	TokenValidationRemote = "remote"
+	// TokenValidationLocal verifies tokens only with signing keys of issuer
+	TokenValidationLocal = "local"
+	// TokenValidationLocalWithFallback verifies tokens locally and uses SSO_CHECK_TOKEN_URI
+	// only when signing keys are unavailable or token is signed with unsupported algorithm
+	TokenValidationLocalWithFallback = "local_with_fallback"
+
+	tokenKeysTTL                = time.Hour
+	tokenKeysMinRefetchInterval = 30 * time.Second
 )
 
 type LoginResponse struct {
@@ -52,18 +71,21 @@ type TapJWTToken struct {
 	Exp       int64    `json:"exp"`
 	Iss       string   `json:"iss"`
 	Zid       string   `json:"zid"`
-	Aud       []string `json:"aud"`
+	Aud       Audience `json:"aud"`
 }
 
 type UaaApi interface {
 	Login(username, password string) (*LoginResponse, int, error)
+	RefreshToken(refreshToken string) (*LoginResponse, int, error)
 	ValidateOauth2Token(token string) (*TapJWTToken, error)
 }
 
 type UaaConnector struct {
-	ClientId     string
-	ClientSecret string
-	Client       *http.Client
+	ClientId        string
+	ClientSecret    string
+	Client          *http.Client
+	TokenValidation string
+	verifier        *tokenVerifier
 }
 
 func NewUaaBasicAuth(clientId, clientSecret string) (*UaaConnector, error) {
@@ -71,7 +93,72 @@ func NewUaaBasicAuth(clientId, clientSecret string) (*UaaConnector, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &UaaConnector{clientId, clientSecret, client}, nil
+
+	tokenValidation := os.Getenv("SSO_TOKEN_VALIDATION")
+	if tokenValidation == "" {
+		tokenValidation = TokenValidationLocalWithFallback
+	}
+	switch tokenValidation {
+	case TokenValidationRemote, TokenValidationLocal, TokenValidationLocalWithFallback:
+	default:
+		return nil, errors.New("Unsupported SSO_TOKEN_VALIDATION value: " + tokenValidation)
+	}
+
+	connector := &UaaConnector{ClientId: clientId, ClientSecret: clientSecret, Client: client, TokenValidation: tokenValidation}
+	if tokenValidation != TokenValidationRemote {
+		tokenKeysURL, err := getTokenKeysURL()
+		if err != nil {
+			if tokenValidation == TokenValidationLocal {
+				return nil, err
+			}
+			logger.Warning("Tokens will be checked remotely:", err)
+			return connector, nil
+		}
+		connector.verifier = &tokenVerifier{
+			keys: newTokenKeysCache(func() ([]TokenKey, error) {
+				return fetchTokenKeys(tokenKeysURL, client)
+			}, tokenKeysTTL, tokenKeysMinRefetchInterval),
+			issuer:    os.Getenv("SSO_TOKEN_ISSUER"),
+			audiences: splitList(os.Getenv("SSO_TOKEN_AUDIENCE")),
+			now:       time.Now,
+		}
+	}
+	return connector, nil
+}
+
+// getTokenKeysURL returns SSO_TOKEN_KEYS_URI or token_keys endpoint derived from SSO_TOKEN_URI
+func getTokenKeysURL() (string, error) {
+	if tokenKeysURL := os.Getenv("SSO_TOKEN_KEYS_URI"); tokenKeysURL != "" {
+		return tokenKeysURL, nil
+	}
+	return deriveTokenKeysURL(os.Getenv("SSO_TOKEN_URI"))
+}
+
+// deriveTokenKeysURL places token_keys next to oauth directory of token endpoint,
+// so context path of UAA is kept, e.g. http://host/uaa/oauth/token -> http://host/uaa/token_keys
+func deriveTokenKeysURL(tokenEndpoint string) (string, error) {
+	tokenURL, err := url.Parse(tokenEndpoint)
+	if err != nil || tokenURL.Host == "" {
+		return "", errors.New("SSO_TOKEN_KEYS_URI is not set and cannot be derived from SSO_TOKEN_URI")
+	}
+	tokenPath := strings.TrimSuffix(tokenURL.Path, "/")
+	basePath := strings.TrimSuffix(tokenPath, "/oauth/token")
+	if basePath == tokenPath {
+		basePath = strings.TrimSuffix(path.Dir(tokenPath), ".")
+	}
+	tokenURL.Path = strings.TrimSuffix(basePath, "/") + "/token_keys"
+	tokenURL.RawQuery = ""
+	return tokenURL.String(), nil
+}
+
+func splitList(value string) []string {
+	result := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
 }
 
 func (u *UaaConnector) prepareUserManagementLoginURLEncodedPayload(username, password string) string {
@@ -85,14 +172,34 @@ func (u *UaaConnector) prepareUserManagementLoginURLEncodedPayload(username, pas
 	return payload.Encode()
 }
 
+func (u *UaaConnector) prepareUserManagementRefreshURLEncodedPayload(refreshToken string) string {
+	payload := url.Values{}
+	payload.Set("grant_type", "refresh_token")
+	payload.Set("client_id", u.ClientId)
+	payload.Set("client_secret", u.ClientSecret)
+	payload.Set("refresh_token", refreshToken)
+	return payload.Encode()
+}
+
 func (u *UaaConnector) Login(username, password string) (*LoginResponse, int, error) {
-	loginResp := LoginResponse{}
+	return u.requestToken(u.prepareUserManagementLoginURLEncodedPayload(username, password))
+}
 
-	uaaURL := os.Getenv("SSO_TOKEN_URI")
-	reqBody := u.prepareUserManagementLoginURLEncodedPayload(username, password)
+// RefreshToken exchanges refresh token obtained from Login for new access token
+func (u *UaaConnector) RefreshToken(refreshToken string) (*LoginResponse, int, error) {
+	return u.requestToken(u.prepareUserManagementRefreshURLEncodedPayload(refreshToken))
+}
 
+func (u *UaaConnector) requestToken(reqBody string) (*LoginResponse, int, error) {
 	auth := commonHTTP.BasicAuth{User: u.ClientId, Password: u.ClientSecret}
-	status, resp, err := commonHTTP.RestUrlEncodedPOST(uaaURL, reqBody, commonHTTP.GetBasicAuthHeader(&auth), u.Client)
+	return requestToken(os.Getenv("SSO_TOKEN_URI"), reqBody, &auth, u.Client)
+}
+
+// requestToken sends OAuth2 token request authenticated with client credentials
+func requestToken(tokenURL, reqBody string, auth *commonHTTP.BasicAuth, client *http.Client) (*LoginResponse, int, error) {
+	loginResp := LoginResponse{}
+
+	status, resp, err := commonHTTP.RestUrlEncodedPOST(tokenURL, reqBody, commonHTTP.GetBasicAuthHeader(auth), client)
 	if err != nil {
 		return nil, status, err
 	} else if status != http.StatusOK {
@@ -114,6 +221,30 @@ func (u *UaaConnector) prepareUserManagementTokenURLEncodedPayload(token string)
 }
 
 func (u *UaaConnector) ValidateOauth2Token(token string) (*TapJWTToken, error) {
+	if u.verifier == nil {
+		return u.checkTokenRemotely(token)
+	}
+
+	jwtToken, err := u.verifier.verify(token)
+	if err == nil {
+		return jwtToken, nil
+	}
+	if u.TokenValidation == TokenValidationLocalWithFallback && canFallbackToRemoteCheck(err) {
+		logger.Warning("Local token verification not possible, falling back to remote check:", err)
+		return u.checkTokenRemotely(token)
+	}
+	return nil, err
+}
+
+func canFallbackToRemoteCheck(err error) bool {
+	switch err.(type) {
+	case keysUnavailableError, unsupportedAlgorithmError:
+		return true
+	}
+	return false
+}
+
+func (u *UaaConnector) checkTokenRemotely(token string) (*TapJWTToken, error) {
 	jwtToken := TapJWTToken{}
 
 	uaaURL := os.Getenv("SSO_CHECK_TOKEN_URI")
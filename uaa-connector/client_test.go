@@ -28,3 +28,34 @@ func TestNewUaaBasicAuth(t *testing.T) {
 		So(client.ClientSecret, ShouldEqual, "clientSecret")
 	})
 }
+
+func TestDeriveTokenKeysURL(t *testing.T) {
+	Convey("Test deriveTokenKeysURL", t, func() {
+		testCases := []struct {
+			tokenURL     string
+			tokenKeysURL string
+		}{
+			{"http://uaa.example.com/oauth/token", "http://uaa.example.com/token_keys"},
+			{"http://example.com/uaa/oauth/token", "http://example.com/uaa/token_keys"},
+			{"http://example.com/uaa/oauth/token/?x=1", "http://example.com/uaa/token_keys"},
+			{"http://example.com/auth/token", "http://example.com/auth/token_keys"},
+			{"http://example.com", "http://example.com/token_keys"},
+		}
+
+		for _, tc := range testCases {
+			Convey("For token endpoint "+tc.tokenURL, func() {
+				tokenKeysURL, err := deriveTokenKeysURL(tc.tokenURL)
+
+				Convey("token keys endpoint should be "+tc.tokenKeysURL, func() {
+					So(err, ShouldBeNil)
+					So(tokenKeysURL, ShouldEqual, tc.tokenKeysURL)
+				})
+			})
+		}
+
+		Convey("When token endpoint has no host error should be returned", func() {
+			_, err := deriveTokenKeysURL("/oauth/token")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,166 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uaa_connector
+
+import (
+	"crypto"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// expLeeway tolerates clock skew between issuer and api-service
+const expLeeway = 30 * time.Second
+
+var signatureHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+}
+
+// Audience accepts both single string and array of strings, as JWT spec allows either
+type Audience []string
+
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = Audience(multiple)
+	return nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// unsupportedAlgorithmError means token is signed in a way which cannot be verified locally
+type unsupportedAlgorithmError struct {
+	alg string
+}
+
+func (e unsupportedAlgorithmError) Error() string {
+	return fmt.Sprintf("unsupported token signing algorithm %q", e.alg)
+}
+
+type tokenVerifier struct {
+	keys      *tokenKeysCache
+	issuer    string
+	audiences []string
+	now       func() time.Time
+}
+
+// verify checks signature, expiry, issuer and audience of token and returns its claims
+func (v *tokenVerifier) verify(token string) (*TapJWTToken, error) {
+	payload, err := v.verifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := TapJWTToken{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %v", err)
+	}
+	if err := v.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// verifySignature returns decoded claims of token if it is signed with one of issuer keys
+func (v *tokenVerifier) verifySignature(token string) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token is not a signed JWT")
+	}
+
+	header := jwtHeader{}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %v", err)
+	}
+	hash, ok := signatureHashes[header.Alg]
+	if !ok {
+		return nil, unsupportedAlgorithmError{header.Alg}
+	}
+
+	key, err := v.keys.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := decodeBase64URL(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %v", err)
+	}
+	hasher := hash.New()
+	hasher.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, hash, hasher.Sum(nil), signature); err != nil {
+		return nil, errors.New("invalid token signature")
+	}
+
+	payload, err := decodeBase64URL(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token claims encoding: %v", err)
+	}
+	return payload, nil
+}
+
+func (v *tokenVerifier) verifyClaims(claims TapJWTToken) error {
+	if claims.Exp == 0 {
+		return errors.New("token has no expiration time")
+	}
+	if v.now().After(time.Unix(claims.Exp, 0).Add(expLeeway)) {
+		return errors.New("token expired")
+	}
+	if v.issuer != "" && claims.Iss != v.issuer {
+		return fmt.Errorf("token issued by unexpected issuer %q", claims.Iss)
+	}
+	if len(v.audiences) > 0 && !hasCommonAudience(claims.Aud, v.audiences) {
+		return errors.New("token is not intended for this audience")
+	}
+	return nil
+}
+
+func hasCommonAudience(tokenAudiences Audience, expectedAudiences []string) bool {
+	for _, tokenAudience := range tokenAudiences {
+		for _, expectedAudience := range expectedAudiences {
+			if tokenAudience == expectedAudience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeJWTPart(part string, result interface{}) error {
+	data, err := decodeBase64URL(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
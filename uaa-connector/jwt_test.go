@@ -0,0 +1,225 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uaa_connector
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+const (
+	testIssuer   = "http://uaa.example.com/oauth/token"
+	testAudience = "tap"
+)
+
+func encodeJWTPart(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func signTestToken(key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	signed := encodeJWTPart(jwtHeader{Alg: "RS256", Kid: kid, Typ: "JWT"}) + "." + encodeJWTPart(claims)
+	hash := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func toTokenKey(kid string, key *rsa.PrivateKey) TokenKey {
+	return TokenKey{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"user_name": "admin",
+		"iss":       testIssuer,
+		"aud":       []string{testAudience, "other"},
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestValidateOauth2TokenLocally(t *testing.T) {
+	key1, _ := rsa.GenerateKey(rand.Reader, 1024)
+	key2, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	servedKeys := []TokenKey{toTokenKey("key-1", key1)}
+	keysRequests := 0
+	keysServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		keysRequests++
+		json.NewEncoder(rw).Encode(tokenKeysResponse{Keys: servedKeys})
+	}))
+	defer keysServer.Close()
+
+	newConnector := func() *UaaConnector {
+		return &UaaConnector{
+			Client:          http.DefaultClient,
+			TokenValidation: TokenValidationLocal,
+			verifier: &tokenVerifier{
+				keys: newTokenKeysCache(func() ([]TokenKey, error) {
+					return fetchTokenKeys(keysServer.URL, http.DefaultClient)
+				}, time.Hour, 0),
+				issuer:    testIssuer,
+				audiences: []string{testAudience},
+				now:       time.Now,
+			},
+		}
+	}
+
+	Convey("Test ValidateOauth2Token with local verification", t, func() {
+		servedKeys = []TokenKey{toTokenKey("key-1", key1)}
+		keysRequests = 0
+		connector := newConnector()
+
+		Convey("When token is valid", func() {
+			token, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", validClaims()))
+
+			Convey("claims should be returned and keys fetched once", func() {
+				So(err, ShouldBeNil)
+				So(token.Username, ShouldEqual, "admin")
+				So(keysRequests, ShouldEqual, 1)
+
+				_, err = connector.ValidateOauth2Token(signTestToken(key1, "key-1", validClaims()))
+				So(err, ShouldBeNil)
+				So(keysRequests, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When token has single audience", func() {
+			claims := validClaims()
+			claims["aud"] = testAudience
+			_, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", claims))
+
+			Convey("it should be accepted", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When token is signed with other key", func() {
+			_, err := connector.ValidateOauth2Token(signTestToken(key2, "key-1", validClaims()))
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When token expired", func() {
+			claims := validClaims()
+			claims["exp"] = time.Now().Add(-time.Hour).Unix()
+			_, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", claims))
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When token comes from other issuer", func() {
+			claims := validClaims()
+			claims["iss"] = "http://other.example.com/oauth/token"
+			_, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", claims))
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When token is intended for other audience", func() {
+			claims := validClaims()
+			claims["aud"] = []string{"other"}
+			_, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", claims))
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When keys were rotated after they had been cached", func() {
+			_, err := connector.ValidateOauth2Token(signTestToken(key1, "key-1", validClaims()))
+			So(err, ShouldBeNil)
+
+			servedKeys = []TokenKey{toTokenKey("key-1", key1), toTokenKey("key-2", key2)}
+			_, err = connector.ValidateOauth2Token(signTestToken(key2, "key-2", validClaims()))
+
+			Convey("keys should be fetched again and token accepted", func() {
+				So(err, ShouldBeNil)
+				So(keysRequests, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestValidateOauth2TokenFallback(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	checkTokenServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(TapJWTToken{Username: "remote"})
+	}))
+	defer checkTokenServer.Close()
+	os.Setenv("SSO_CHECK_TOKEN_URI", checkTokenServer.URL)
+	defer os.Unsetenv("SSO_CHECK_TOKEN_URI")
+
+	newConnector := func(tokenValidation string) *UaaConnector {
+		return &UaaConnector{
+			Client:          http.DefaultClient,
+			TokenValidation: tokenValidation,
+			verifier: &tokenVerifier{
+				keys: newTokenKeysCache(func() ([]TokenKey, error) {
+					return fetchTokenKeys("http://127.0.0.1:1/token_keys", http.DefaultClient)
+				}, time.Hour, 0),
+				issuer: testIssuer,
+				now:    time.Now,
+			},
+		}
+	}
+
+	Convey("Test ValidateOauth2Token when token keys are unavailable", t, func() {
+		token := signTestToken(key, "key-1", validClaims())
+
+		Convey("When fallback is enabled", func() {
+			result, err := newConnector(TokenValidationLocalWithFallback).ValidateOauth2Token(token)
+
+			Convey("token should be checked remotely", func() {
+				So(err, ShouldBeNil)
+				So(result.Username, ShouldEqual, "remote")
+			})
+		})
+
+		Convey("When only local validation is allowed", func() {
+			_, err := newConnector(TokenValidationLocal).ValidateOauth2Token(token)
+
+			Convey("error should be returned", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
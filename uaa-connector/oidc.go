@@ -0,0 +1,248 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uaa_connector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+const (
+	defaultOidcScopes        = "openid"
+	defaultOidcUsernameClaim = "preferred_username"
+	defaultOidcEmailClaim    = "email"
+	defaultOidcRolesClaims   = "roles,scope"
+)
+
+// ClaimsMapping names claims of OpenID Connect token holding user data. Nested claims are separated by dots,
+// e.g. realm_access.roles for Keycloak realm roles. Roles are used as scopes by API access policy.
+type ClaimsMapping struct {
+	Username string
+	Email    string
+	Roles    []string
+}
+
+type oidcDiscovery struct {
+	Issuer        string `json:"issuer"`
+	TokenEndpoint string `json:"token_endpoint"`
+	JwksURI       string `json:"jwks_uri"`
+}
+
+// OidcConnector implements UaaApi with generic OpenID Connect provider, e.g. Keycloak
+type OidcConnector struct {
+	ClientId      string
+	ClientSecret  string
+	Client        *http.Client
+	Scopes        []string
+	Claims        ClaimsMapping
+	tokenEndpoint string
+	verifier      *tokenVerifier
+}
+
+// NewOidcConnector configures connector with discovery document of issuer
+func NewOidcConnector(issuerURL, clientId, clientSecret string) (*OidcConnector, error) {
+	client, _, err := commonHTTP.GetHttpClient()
+	if err != nil {
+		return nil, err
+	}
+
+	issuerURL = strings.TrimSuffix(issuerURL, "/")
+	discovery, err := fetchOidcDiscovery(issuerURL, client)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch OpenID Connect discovery document of %s: %v", issuerURL, err)
+	}
+
+	return &OidcConnector{
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		Client:       client,
+		Scopes:       splitList(getEnvOrDefault("OIDC_SCOPES", defaultOidcScopes)),
+		Claims: ClaimsMapping{
+			Username: getEnvOrDefault("OIDC_USERNAME_CLAIM", defaultOidcUsernameClaim),
+			Email:    getEnvOrDefault("OIDC_EMAIL_CLAIM", defaultOidcEmailClaim),
+			Roles:    splitList(getEnvOrDefault("OIDC_ROLES_CLAIMS", defaultOidcRolesClaims)),
+		},
+		tokenEndpoint: discovery.TokenEndpoint,
+		verifier: &tokenVerifier{
+			keys: newTokenKeysCache(func() ([]TokenKey, error) {
+				return fetchTokenKeys(discovery.JwksURI, client)
+			}, tokenKeysTTL, tokenKeysMinRefetchInterval),
+			issuer:    discovery.Issuer,
+			audiences: splitList(os.Getenv("OIDC_AUDIENCE")),
+			now:       time.Now,
+		},
+	}, nil
+}
+
+func getEnvOrDefault(name, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func fetchOidcDiscovery(issuerURL string, client *http.Client) (*oidcDiscovery, error) {
+	status, body, err := commonHTTP.RestGET(issuerURL+"/.well-known/openid-configuration", "", client)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, errors.New("Bad response status: " + strconv.Itoa(status))
+	}
+
+	discovery := &oidcDiscovery{}
+	if err := json.Unmarshal(body, discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != issuerURL {
+		return nil, fmt.Errorf("discovery document describes other issuer: %s", discovery.Issuer)
+	}
+	if discovery.TokenEndpoint == "" || discovery.JwksURI == "" {
+		return nil, errors.New("discovery document has no token_endpoint or jwks_uri")
+	}
+	return discovery, nil
+}
+
+func (o *OidcConnector) Login(username, password string) (*LoginResponse, int, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "password")
+	payload.Set("client_id", o.ClientId)
+	payload.Set("username", username)
+	payload.Set("password", password)
+	payload.Set("scope", strings.Join(o.Scopes, " "))
+	return o.requestToken(payload)
+}
+
+func (o *OidcConnector) RefreshToken(refreshToken string) (*LoginResponse, int, error) {
+	payload := url.Values{}
+	payload.Set("grant_type", "refresh_token")
+	payload.Set("client_id", o.ClientId)
+	payload.Set("refresh_token", refreshToken)
+	return o.requestToken(payload)
+}
+
+func (o *OidcConnector) requestToken(payload url.Values) (*LoginResponse, int, error) {
+	auth := commonHTTP.BasicAuth{User: o.ClientId, Password: o.ClientSecret}
+	return requestToken(o.tokenEndpoint, payload.Encode(), &auth, o.Client)
+}
+
+// ValidateOauth2Token verifies token with keys of provider and maps its claims according to ClaimsMapping
+func (o *OidcConnector) ValidateOauth2Token(token string) (*TapJWTToken, error) {
+	payload, err := o.verifier.verifySignature(token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %v", err)
+	}
+	jwtToken, err := o.mapClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+	if err := o.verifier.verifyClaims(*jwtToken); err != nil {
+		return nil, err
+	}
+	return jwtToken, nil
+}
+
+func (o *OidcConnector) mapClaims(claims map[string]interface{}) (*TapJWTToken, error) {
+	jwtToken := &TapJWTToken{
+		Jti:      getStringClaim(claims, "jti"),
+		Sub:      getStringClaim(claims, "sub"),
+		UserId:   getStringClaim(claims, "sub"),
+		Iss:      getStringClaim(claims, "iss"),
+		Azp:      getStringClaim(claims, "azp"),
+		ClientId: getStringClaim(claims, "azp"),
+		Username: getStringClaim(claims, o.Claims.Username),
+		Email:    getStringClaim(claims, o.Claims.Email),
+		Exp:      getIntClaim(claims, "exp"),
+		Iat:      getIntClaim(claims, "iat"),
+		Aud:      Audience(getStringsClaim(claims, "aud")),
+		Scope:    []string{},
+	}
+	if jwtToken.Username == "" {
+		return nil, fmt.Errorf("token has no %s claim", o.Claims.Username)
+	}
+
+	for _, rolesClaim := range o.Claims.Roles {
+		for _, role := range getStringsClaim(claims, rolesClaim) {
+			if !containsString(jwtToken.Scope, role) {
+				jwtToken.Scope = append(jwtToken.Scope, role)
+			}
+		}
+	}
+	return jwtToken, nil
+}
+
+func getClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+func getStringClaim(claims map[string]interface{}, path string) string {
+	value, _ := getClaim(claims, path).(string)
+	return value
+}
+
+func getIntClaim(claims map[string]interface{}, path string) int64 {
+	value, _ := getClaim(claims, path).(float64)
+	return int64(value)
+}
+
+// getStringsClaim accepts array of strings or space separated string, as used by scope claim
+func getStringsClaim(claims map[string]interface{}, path string) []string {
+	switch value := getClaim(claims, path).(type) {
+	case string:
+		return strings.Fields(value)
+	case []interface{}:
+		result := []string{}
+		for _, item := range value {
+			if str, ok := item.(string); ok {
+				result = append(result, str)
+			}
+		}
+		return result
+	}
+	return nil
+}
+
+func containsString(slice []string, value string) bool {
+	for _, item := range slice {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uaa_connector
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestOidcConnector(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 1024)
+
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	mux.HandleFunc("/.well-known/openid-configuration", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(oidcDiscovery{
+			Issuer:        server.URL,
+			TokenEndpoint: server.URL + "/protocol/openid-connect/token",
+			JwksURI:       server.URL + "/protocol/openid-connect/certs",
+		})
+	})
+	mux.HandleFunc("/protocol/openid-connect/certs", func(rw http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(rw).Encode(tokenKeysResponse{Keys: []TokenKey{toTokenKey("kc-1", key)}})
+	})
+	mux.HandleFunc("/protocol/openid-connect/token", func(rw http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if user, _, _ := r.BasicAuth(); user != "tap" || r.Form.Get("grant_type") != "password" || r.Form.Get("scope") != "openid" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(rw).Encode(LoginResponse{AccessToken: "token", TokenType: "bearer"})
+	})
+
+	os.Setenv("OIDC_ROLES_CLAIMS", "realm_access.roles,scope")
+	defer os.Unsetenv("OIDC_ROLES_CLAIMS")
+
+	keycloakClaims := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub":                "f1e2",
+			"iss":                server.URL,
+			"aud":                "account",
+			"exp":                time.Now().Add(time.Hour).Unix(),
+			"preferred_username": "jdoe",
+			"email":              "jdoe@example.com",
+			"scope":              "openid email",
+			"realm_access":       map[string]interface{}{"roles": []string{"tap.user", "offline_access"}},
+		}
+	}
+
+	Convey("Test OidcConnector", t, func() {
+		connector, err := NewOidcConnector(server.URL+"/", "tap", "secret")
+		So(err, ShouldBeNil)
+
+		Convey("Login should use password grant against token endpoint from discovery", func() {
+			response, status, err := connector.Login("jdoe", "password")
+			So(err, ShouldBeNil)
+			So(status, ShouldEqual, http.StatusOK)
+			So(response.AccessToken, ShouldEqual, "token")
+		})
+
+		Convey("When token is valid its claims should be mapped", func() {
+			jwtToken, err := connector.ValidateOauth2Token(signTestToken(key, "kc-1", keycloakClaims()))
+
+			So(err, ShouldBeNil)
+			So(jwtToken.Username, ShouldEqual, "jdoe")
+			So(jwtToken.Email, ShouldEqual, "jdoe@example.com")
+			So(jwtToken.UserId, ShouldEqual, "f1e2")
+			So(jwtToken.Scope, ShouldResemble, []string{"tap.user", "offline_access", "openid", "email"})
+		})
+
+		Convey("When token is issued by other issuer it should be rejected", func() {
+			claims := keycloakClaims()
+			claims["iss"] = "https://other.example.com/realms/tap"
+			_, err := connector.ValidateOauth2Token(signTestToken(key, "kc-1", claims))
+
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("When token has no username claim it should be rejected", func() {
+			claims := keycloakClaims()
+			delete(claims, "preferred_username")
+			_, err := connector.ValidateOauth2Token(signTestToken(key, "kc-1", claims))
+
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,200 @@
+/**
+ * Copyright (c) 2016 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package uaa_connector
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	commonHTTP "github.com/trustedanalytics-ng/tap-go-common/http"
+)
+
+// TokenKey is public key used by issuer to sign tokens, as returned by UAA token_keys (JWKS) endpoint
+type TokenKey struct {
+	Kty   string `json:"kty"`
+	Kid   string `json:"kid"`
+	Alg   string `json:"alg"`
+	Value string `json:"value"`
+	N     string `json:"n"`
+	E     string `json:"e"`
+}
+
+type tokenKeysResponse struct {
+	Keys []TokenKey `json:"keys"`
+}
+
+// keysUnavailableError means token could not be verified locally, because signing keys could not be fetched
+type keysUnavailableError struct {
+	err error
+}
+
+func (e keysUnavailableError) Error() string {
+	return fmt.Sprintf("cannot fetch token keys: %v", e.err)
+}
+
+// tokenKeysCache keeps signing keys of issuer. Keys are fetched again when they are older than ttl
+// or when token signed with unknown key arrives, but not more often than minRefetchInterval.
+type tokenKeysCache struct {
+	fetch              func() ([]TokenKey, error)
+	ttl                time.Duration
+	minRefetchInterval time.Duration
+
+	mutex     sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newTokenKeysCache(fetch func() ([]TokenKey, error), ttl, minRefetchInterval time.Duration) *tokenKeysCache {
+	return &tokenKeysCache{fetch: fetch, ttl: ttl, minRefetchInterval: minRefetchInterval}
+}
+
+// getKey returns key with given id. Token without key id can be verified only when issuer has single key.
+func (c *tokenKeysCache) getKey(kid string) (*rsa.PublicKey, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	if c.keys == nil || now.Sub(c.fetchedAt) > c.ttl {
+		if err := c.refresh(now); err != nil {
+			return nil, err
+		}
+	}
+
+	key, found := c.findKey(kid)
+	if !found && now.Sub(c.fetchedAt) >= c.minRefetchInterval {
+		// keys may have been rotated since they were fetched
+		if err := c.refresh(now); err != nil {
+			return nil, err
+		}
+		key, found = c.findKey(kid)
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown token key %q", kid)
+	}
+	return key, nil
+}
+
+func (c *tokenKeysCache) findKey(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, key := range c.keys {
+			return key, true
+		}
+	}
+	key, found := c.keys[kid]
+	return key, found
+}
+
+func (c *tokenKeysCache) refresh(now time.Time) error {
+	tokenKeys, err := c.fetch()
+	if err != nil {
+		return keysUnavailableError{err}
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, tokenKey := range tokenKeys {
+		key, err := parseTokenKey(tokenKey)
+		if err != nil {
+			logger.Warningf("Token key %q skipped: %v", tokenKey.Kid, err)
+			continue
+		}
+		keys[tokenKey.Kid] = key
+	}
+	if len(keys) == 0 {
+		return keysUnavailableError{errors.New("issuer returned no RSA keys")}
+	}
+
+	c.keys = keys
+	c.fetchedAt = now
+	return nil
+}
+
+// parseTokenKey reads RSA key from JWKS modulus and exponent or from PEM value used by UAA
+func parseTokenKey(tokenKey TokenKey) (*rsa.PublicKey, error) {
+	if tokenKey.Kty != "" && tokenKey.Kty != "RSA" {
+		return nil, fmt.Errorf("unsupported key type %q", tokenKey.Kty)
+	}
+
+	if tokenKey.N != "" && tokenKey.E != "" {
+		n, err := decodeBase64URL(tokenKey.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %v", err)
+		}
+		e, err := decodeBase64URL(tokenKey.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %v", err)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	}
+
+	block, _ := pem.Decode([]byte(tokenKey.Value))
+	if block == nil {
+		return nil, errors.New("key has neither modulus and exponent nor PEM value")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("PEM value is not RSA public key")
+	}
+	return rsaKey, nil
+}
+
+func decodeBase64URL(value string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(trimBase64Padding(value))
+}
+
+func trimBase64Padding(value string) string {
+	for len(value) > 0 && value[len(value)-1] == '=' {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
+func fetchTokenKeys(tokenKeysURL string, client *http.Client) ([]TokenKey, error) {
+	status, body, err := commonHTTP.RestGET(tokenKeysURL, "", client)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, errors.New("Bad response status: " + strconv.Itoa(status))
+	}
+
+	response := tokenKeysResponse{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Keys) == 0 {
+		// UAA configured with single key responds with the key itself
+		key := TokenKey{}
+		if err := json.Unmarshal(body, &key); err == nil && (key.Value != "" || key.N != "") {
+			response.Keys = append(response.Keys, key)
+		}
+	}
+	return response.Keys, nil
+}
@@ -55,6 +55,18 @@ func (_mr *_MockUaaApiRecorder) Login(arg0, arg1 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "Login", arg0, arg1)
 }
 
+func (_m *MockUaaApi) RefreshToken(refreshToken string) (*LoginResponse, int, error) {
+	ret := _m.ctrl.Call(_m, "RefreshToken", refreshToken)
+	ret0, _ := ret[0].(*LoginResponse)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockUaaApiRecorder) RefreshToken(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RefreshToken", arg0)
+}
+
 func (_m *MockUaaApi) ValidateOauth2Token(token string) (*TapJWTToken, error) {
 	ret := _m.ctrl.Call(_m, "ValidateOauth2Token", token)
 	ret0, _ := ret[0].(*TapJWTToken)
@@ -56,6 +56,22 @@ type UaaUser struct {
 	Username string `json:"username"`
 }
 
+type Organization struct {
+	Guid string `json:"guid"`
+	Name string `json:"name"`
+}
+
+type OrganizationRequest struct {
+	Name string `json:"name" validate:"nonzero"`
+}
+
+type OrganizationUserRequest struct {
+	Username string   `json:"username"`
+	Roles    []string `json:"roles"`
+}
+
+const organizationUserRole = "user"
+
 type UserManagementFactory interface {
 	GetConfiguredUserManagementConnector(authorization string) UserManagementApi
 }
@@ -68,6 +84,11 @@ type UserManagementApi interface {
 	GetInvitations() ([]string, int, error)
 	GetUsers() ([]UaaUser, int, error)
 	DeleteUserInvitation(email string) (int, error)
+	GetOrganizations() ([]Organization, int, error)
+	CreateOrganization(name string) (*Organization, int, error)
+	GetOrganizationUsers(orgId string) ([]UaaUser, int, error)
+	AddOrganizationUser(orgId, email string) (int, error)
+	RemoveOrganizationUser(orgId, email string) (int, error)
 }
 
 type UserManagementApiConnectorFactory struct {
@@ -187,7 +208,11 @@ func (u *UserManagementApiConnector) invitationExists(email string) bool {
 }
 
 func (u *UserManagementApiConnector) GetUsers() ([]UaaUser, int, error) {
-	connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs/%s/users", u.Address, defaultOrg))
+	return u.GetOrganizationUsers(defaultOrg)
+}
+
+func (u *UserManagementApiConnector) GetOrganizationUsers(orgId string) ([]UaaUser, int, error) {
+	connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs/%s/users", u.Address, orgId))
 
 	users := []UaaUser{}
 	status, err := brokerHttp.GetModel(connector, http.StatusOK, &users)
@@ -198,8 +223,8 @@ func (u *UserManagementApiConnector) GetUsers() ([]UaaUser, int, error) {
 	return users, status, nil
 }
 
-func (u *UserManagementApiConnector) getUserUUID(email string) string {
-	users, _, err := u.GetUsers()
+func (u *UserManagementApiConnector) getUserUUID(orgId, email string) string {
+	users, _, err := u.GetOrganizationUsers(orgId)
 	if err != nil {
 		return ""
 	}
@@ -228,10 +253,12 @@ func (u *UserManagementApiConnector) DeleteUserInvitation(email string) (int, er
 }
 
 func (u *UserManagementApiConnector) DeleteUser(email string) (int, error) {
-	connector := u.getApiConnector(fmt.Sprintf("%s/rest/invitations/%s", u.Address, email))
+	return u.RemoveOrganizationUser(defaultOrg, email)
+}
 
-	if uid := u.getUserUUID(email); uid != "" {
-		connector = u.getApiConnector(fmt.Sprintf("%s/rest/orgs/%s/users/%s", u.Address, defaultOrg, uid))
+func (u *UserManagementApiConnector) RemoveOrganizationUser(orgId, email string) (int, error) {
+	if uid := u.getUserUUID(orgId, email); uid != "" {
+		connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs/%s/users/%s", u.Address, orgId, uid))
 		status, err := brokerHttp.DeleteModel(connector, http.StatusOK)
 		if err != nil {
 			return status, err
@@ -250,3 +277,37 @@ func (u *UserManagementApiConnector) ChangeCurrentUserPassword(changePasswdReq C
 	connector := u.getApiConnector(fmt.Sprintf("%s/rest/users/current/password", u.Address))
 	return brokerHttp.PutModel(connector, req, http.StatusOK, "")
 }
+
+func (u *UserManagementApiConnector) GetOrganizations() ([]Organization, int, error) {
+	connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs", u.Address))
+
+	organizations := []Organization{}
+	status, err := brokerHttp.GetModel(connector, http.StatusOK, &organizations)
+	if err != nil {
+		return nil, status, err
+	}
+
+	return organizations, status, nil
+}
+
+func (u *UserManagementApiConnector) CreateOrganization(name string) (*Organization, int, error) {
+	connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs", u.Address))
+
+	organization := &Organization{}
+	status, err := brokerHttp.PostModel(connector, OrganizationRequest{Name: name}, http.StatusCreated, organization)
+	if err != nil {
+		return nil, status, err
+	}
+
+	return organization, status, nil
+}
+
+func (u *UserManagementApiConnector) AddOrganizationUser(orgId, email string) (int, error) {
+	connector := u.getApiConnector(fmt.Sprintf("%s/rest/orgs/%s/users", u.Address, orgId))
+
+	reqBody := OrganizationUserRequest{
+		Username: email,
+		Roles:    []string{organizationUserRole},
+	}
+	return brokerHttp.PostModel(connector, reqBody, http.StatusCreated, "")
+}
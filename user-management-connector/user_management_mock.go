@@ -153,3 +153,61 @@ func (_m *MockUserManagementApi) DeleteUserInvitation(email string) (int, error)
 func (_mr *_MockUserManagementApiRecorder) DeleteUserInvitation(arg0 interface{}) *gomock.Call {
 	return _mr.mock.ctrl.RecordCall(_mr.mock, "DeleteUserInvitation", arg0)
 }
+
+func (_m *MockUserManagementApi) GetOrganizations() ([]Organization, int, error) {
+	ret := _m.ctrl.Call(_m, "GetOrganizations")
+	ret0, _ := ret[0].([]Organization)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockUserManagementApiRecorder) GetOrganizations() *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetOrganizations")
+}
+
+func (_m *MockUserManagementApi) CreateOrganization(name string) (*Organization, int, error) {
+	ret := _m.ctrl.Call(_m, "CreateOrganization", name)
+	ret0, _ := ret[0].(*Organization)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockUserManagementApiRecorder) CreateOrganization(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "CreateOrganization", arg0)
+}
+
+func (_m *MockUserManagementApi) GetOrganizationUsers(orgId string) ([]UaaUser, int, error) {
+	ret := _m.ctrl.Call(_m, "GetOrganizationUsers", orgId)
+	ret0, _ := ret[0].([]UaaUser)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+func (_mr *_MockUserManagementApiRecorder) GetOrganizationUsers(arg0 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "GetOrganizationUsers", arg0)
+}
+
+func (_m *MockUserManagementApi) AddOrganizationUser(orgId string, email string) (int, error) {
+	ret := _m.ctrl.Call(_m, "AddOrganizationUser", orgId, email)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockUserManagementApiRecorder) AddOrganizationUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "AddOrganizationUser", arg0, arg1)
+}
+
+func (_m *MockUserManagementApi) RemoveOrganizationUser(orgId string, email string) (int, error) {
+	ret := _m.ctrl.Call(_m, "RemoveOrganizationUser", orgId, email)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+func (_mr *_MockUserManagementApiRecorder) RemoveOrganizationUser(arg0, arg1 interface{}) *gomock.Call {
+	return _mr.mock.ctrl.RecordCall(_mr.mock, "RemoveOrganizationUser", arg0, arg1)
+}
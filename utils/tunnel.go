@@ -0,0 +1,66 @@
+/**
+ * Copyright (c) 2017 Intel Corporation
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *    http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package utils
+
+import (
+	"io"
+	"net"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const tunnelBufferSize = 32 * 1024
+
+// RelayTcpOverWebSocket copies data of TCP connection as binary WebSocket messages in both directions,
+// until one of connections is closed. It is used on both ends of tunnel.
+func RelayTcpOverWebSocket(ws *websocket.Conn, tcp net.Conn) {
+	done := make(chan struct{}, 2)
+
+	go func() {
+		defer func() { done <- struct{}{} }()
+		for {
+			_, reader, err := ws.NextReader()
+			if err != nil {
+				return
+			}
+			if _, err := io.Copy(tcp, reader); err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		defer func() { done <- struct{}{} }()
+		buffer := make([]byte, tunnelBufferSize)
+		for {
+			n, err := tcp.Read(buffer)
+			if n > 0 {
+				if err := ws.WriteMessage(websocket.BinaryMessage, buffer[:n]); err != nil {
+					return
+				}
+			}
+			if err != nil {
+				closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+				ws.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+				return
+			}
+		}
+	}()
+
+	<-done
+}